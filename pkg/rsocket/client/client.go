@@ -16,49 +16,371 @@ import (
 var (
 	// ErrDisconnected is returned when use a disconnected client
 	ErrDisconnected = errors.New("disconnected")
+
+	// ErrStreamLost is returned for the streams in progress when the session could not be resumed.
+	ErrStreamLost = errors.New("stream lost, the session could not be resumed")
 )
 
 // Client API
 type Client interface {
 	proto.Requester
+	proto.MetadataPushSyncer
+	proto.StreamLister
+
+	// NewRequest composes a request with the options.
+	NewRequest() *proto.RequestBuilder
+
+	// ResumeToken returns the resume token of current session, or nil if resumption disabled.
+	ResumeToken() proto.Token
+
+	// CloseWithError tells the server why the client closes with an ERROR frame on stream 0, e.g. CONNECTION_CLOSE,
+	// fails the streams in progress with the error, then closes the connection once the frames queued written.
+	CloseWithError(ctx context.Context, err *proto.Error) error
 }
 
+// ResumeTokenPolicy decides the resume token of the new session once the server rejected the resumption.
+type ResumeTokenPolicy int
+
+const (
+	// ReuseResumeToken setups the new session with the original token.
+	ReuseResumeToken ResumeTokenPolicy = iota
+	// RotateResumeToken setups the new session with a new token.
+	RotateResumeToken
+)
+
 type rSocketClient struct {
 	*Dialer
 	proto.Requester
-	transport                  transport.Transport
-	streamIDs                  proto.StreamIDs
-	cancel                     context.CancelFunc
-	c                          *sync.Cond
-	LastReceivedClientPosition proto.Position
+	transport           transport.Transport
+	streamIDs           proto.StreamIDs
+	cancel              context.CancelFunc // Stops serving the client, guarded by c.L.
+	closed              bool               // The client is closed, maybe before served, guarded by c.L.
+	c                   *sync.Cond
+	confirmed           chan error
+	confirm             sync.Once
+	lease               *proto.Lease
+	resumeState         *proto.ResumptionState
+	resumeToken         proto.Token
+	fireAndForgetBuffer *proto.FireAndForgetBuffer // The requests resent once reconnected, or nil if disabled.
+	sender              *sessionSender             // Sends the frames of the requester on the connection of current session.
+	connection          *proto.Connection          // The connection of current session, or nil if never connected.
+	closing             bool                       // The client is closed with an error, which never reconnects.
 }
 
-var _ Client = (*rSocketClient)(nil)
+var (
+	_ Client                  = (*rSocketClient)(nil)
+	_ proto.Aborter           = (*rSocketClient)(nil)
+	_ proto.MetadataMimeTyper = (*rSocketClient)(nil)
+)
 
 func newClient(opts *Dialer, transport transport.Transport) *rSocketClient {
+	var fireAndForgetBuffer *proto.FireAndForgetBuffer
+
+	// The requests are confirmed delivered by the position of resumption, which is never acknowledged otherwise.
+	if opts.FireAndForgetBuffer > 0 && opts.Setup.ResumeToken != nil {
+		fireAndForgetBuffer = proto.NewFireAndForgetBuffer(opts.FireAndForgetBuffer)
+	}
+
 	return &rSocketClient{
 		opts,
 		nil,
 		transport,
 		proto.ClientStreamIDs(),
 		nil,
+		false,
 		sync.NewCond(new(sync.Mutex)),
-		0,
+		make(chan error, 1),
+		sync.Once{},
+		proto.NewLease(proto.RealClock),
+		newResumptionState(opts),
+		opts.Setup.ResumeToken,
+		fireAndForgetBuffer,
+		nil,
+		nil,
+		false,
+	}
+}
+
+// newResumptionState creates the state tracks the positions of a new session.
+func newResumptionState(opts *Dialer) *proto.ResumptionState {
+	if opts.ResumeBuffer > 0 {
+		return proto.NewResumptionState(proto.NewBoundedResumeBuffer(opts.ResumeBuffer))
+	}
+
+	return proto.NewResumptionState(proto.NewResumeBuffer())
+}
+
+// ResumeToken returns the resume token of current session, or nil if resumption disabled.
+func (client *rSocketClient) ResumeToken() proto.Token {
+	client.c.L.Lock()
+	defer client.c.L.Unlock()
+
+	return client.resumeToken
+}
+
+// renewSession starts a new session once the server rejected the resumption or the session is not resumable,
+// the frames retained for the previous session are dropped, and the streams in progress are failed with the reason.
+func (client *rSocketClient) renewSession(ctx context.Context, reason error) {
+	client.c.L.Lock()
+
+	// The requester sends frames on the previous connection, a new one is created for the new session.
+	requester := client.Requester
+	client.Requester = nil
+
+	if client.resumeToken != nil {
+		if client.ResumeTokenPolicy == RotateResumeToken {
+			client.resumeToken = frame.NewToken()
+		}
+
+		client.resumeState = newResumptionState(client.Dialer)
+	}
+
+	client.c.L.Unlock()
+
+	if requester != nil {
+		requester.(proto.Aborter).Abort(ctx, reason)
+	}
+}
+
+// requester returns the requester of current session, or ErrDisconnected while connecting or reconnecting.
+func (client *rSocketClient) requester() (proto.Requester, error) {
+	client.c.L.Lock()
+	defer client.c.L.Unlock()
+
+	if client.Requester == nil {
+		return nil, ErrDisconnected
+	}
+
+	return client.Requester, nil
+}
+
+// RequestStream sends a single request and get a response stream, or returns ErrDisconnected if not connected.
+func (client *rSocketClient) RequestStream(ctx context.Context, payload *proto.Payload) (*proto.PayloadStream, error) {
+	requester, err := client.requester()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return requester.RequestStream(ctx, payload)
+}
+
+// RequestChannel starts a channel, or returns ErrDisconnected if not connected.
+func (client *rSocketClient) RequestChannel(ctx context.Context, payloads *proto.PayloadStream) (*proto.PayloadStream, error) {
+	requester, err := client.requester()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return requester.RequestChannel(ctx, payloads)
+}
+
+// RequestResponse sends a single request and get a single response, or returns ErrDisconnected if not connected.
+func (client *rSocketClient) RequestResponse(ctx context.Context, payload *proto.Payload) (*proto.Payload, error) {
+	requester, err := client.requester()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return requester.RequestResponse(ctx, payload)
+}
+
+// MetadataPush sends metadata without response, or returns ErrDisconnected if not connected.
+func (client *rSocketClient) MetadataPush(ctx context.Context, metadata proto.Metadata) error {
+	requester, err := client.requester()
+
+	if err != nil {
+		return err
+	}
+
+	return requester.MetadataPush(ctx, metadata)
+}
+
+// MetadataPushSync sends metadata and wait the frame flushed, or returns ErrDisconnected if not connected.
+func (client *rSocketClient) MetadataPushSync(ctx context.Context, metadata proto.Metadata) error {
+	requester, err := client.requester()
+
+	if err != nil {
+		return err
+	}
+
+	if syncer, ok := requester.(proto.MetadataPushSyncer); ok {
+		return syncer.MetadataPushSync(ctx, metadata)
+	}
+
+	return requester.MetadataPush(ctx, metadata)
+}
+
+// NewRequest composes a request dispatched to the requester of the session when sent.
+func (client *rSocketClient) NewRequest() *proto.RequestBuilder {
+	return proto.NewRequest(client)
+}
+
+// MetadataMimeType returns the metadata MIME type sent with the SETUP frame.
+func (client *rSocketClient) MetadataMimeType() string {
+	return client.Setup.MetadataMimeType
+}
+
+// ActiveStreams returns a snapshot of the streams in progress, or nil if not connected or not tracked.
+func (client *rSocketClient) ActiveStreams() []proto.StreamInfo {
+	requester, err := client.requester()
+
+	if err != nil {
+		return nil
+	}
+
+	if lister, ok := requester.(proto.StreamLister); ok {
+		return lister.ActiveStreams()
+	}
+
+	return nil
+}
+
+// FireAndForget sends the request, and retains it to resend once reconnected if the buffer enabled.
+func (client *rSocketClient) FireAndForget(ctx context.Context, payload *proto.Payload) error {
+	requester, err := client.requester()
+
+	if err != nil {
+		return err
+	}
+
+	if err := requester.FireAndForget(ctx, payload); err != nil {
+		return err
+	}
+
+	client.flushFireAndForget(ctx, requester)
+	client.retainFireAndForget(payload)
+
+	return nil
+}
+
+// flushFireAndForget waits the request sent written if the buffer enabled,
+// the position of session is advanced by the request once written, rather than queued.
+func (client *rSocketClient) flushFireAndForget(ctx context.Context, requester proto.Requester) {
+	if client.fireAndForgetBuffer == nil {
+		return
+	}
+
+	if flusher, ok := requester.(proto.QueueFlusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			client.Debug("flush requests failed", zap.Error(err))
+		}
+	}
+}
+
+// retainFireAndForget retains the request sent at the position of current session if the buffer enabled.
+func (client *rSocketClient) retainFireAndForget(payload *proto.Payload) {
+	if client.fireAndForgetBuffer == nil {
+		return
+	}
+
+	client.c.L.Lock()
+	resumeState := client.resumeState
+	client.c.L.Unlock()
+
+	client.fireAndForgetBuffer.Retain(payload, resumeState.Position())
+}
+
+// resendFireAndForget resends the requests not confirmed delivered in the previous session,
+// the requests not resent are retained for the next session.
+func (client *rSocketClient) resendFireAndForget(ctx context.Context, requester proto.Requester) {
+	if client.fireAndForgetBuffer == nil {
+		return
+	}
+
+	payloads := client.fireAndForgetBuffer.Take()
+
+	for i, payload := range payloads {
+		if err := requester.FireAndForget(ctx, payload); err != nil {
+			client.Warn("resend requests failed", zap.Int("pending", len(payloads)-i), zap.Error(err))
+
+			for _, payload := range payloads[i:] {
+				client.retainFireAndForget(payload)
+			}
+
+			return
+		}
+
+		client.flushFireAndForget(ctx, requester)
+		client.retainFireAndForget(payload)
+	}
+}
+
+// confirmSetup reports the SETUP frame is accepted or not.
+func (client *rSocketClient) confirmSetup(err error) {
+	client.confirm.Do(func() {
+		client.confirmed <- err
+	})
+}
+
+// Abort fails the streams of current session with the error, e.g. the connection closed with an error.
+func (client *rSocketClient) Abort(ctx context.Context, err error) {
+	if requester, reqErr := client.requester(); reqErr == nil {
+		requester.(proto.Aborter).Abort(ctx, err)
 	}
 }
 
 // Disconnect the underlying transport.
 func (client *rSocketClient) Close() error {
-	if client.cancel != nil {
-		client.cancel()
+	client.c.L.Lock()
+	cancel := client.cancel
+	client.closed = true
+	client.c.L.Unlock()
+
+	if cancel != nil {
+		cancel()
 	}
 
 	return nil
 }
 
+// CloseWithError tells the server why the client closes with an ERROR frame on stream 0, e.g. CONNECTION_CLOSE,
+// fails the streams in progress with the error, then closes the connection once the frames queued written.
+func (client *rSocketClient) CloseWithError(ctx context.Context, err *proto.Error) error {
+	client.c.L.Lock()
+	connection := client.connection
+	client.closing = true
+	client.c.L.Unlock()
+
+	defer client.Close()
+
+	if connection == nil {
+		return ErrDisconnected
+	}
+
+	return connection.CloseWithError(ctx, err)
+}
+
+// isClosing returns true if the client is closed with an error, which never reconnects.
+func (client *rSocketClient) isClosing() bool {
+	client.c.L.Lock()
+	defer client.c.L.Unlock()
+
+	return client.closing
+}
+
 func (client *rSocketClient) Serve(ctx context.Context) (err error) {
-	ctx, client.cancel = context.WithCancel(ctx)
-	defer client.cancel()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client.c.L.Lock()
+	client.cancel = cancel
+	closed := client.closed
+	client.c.L.Unlock()
+
+	if closed {
+		// The client is closed before served.
+		cancel()
+	}
+	defer func() {
+		if err != nil {
+			client.confirmSetup(err)
+		} else {
+			client.confirmSetup(ctx.Err())
+		}
+	}()
 
 	var current, next State
 
@@ -72,15 +394,40 @@ func (client *rSocketClient) Serve(ctx context.Context) (err error) {
 		if err == nil {
 			current = next
 		} else {
-			defer current.Close()
+			// The connection is dropped, a new one is connected for the session resumed or renewed.
+			current.Close()
 
-			if err == context.Canceled {
+			if err == context.Canceled || client.isClosing() {
 				return nil
 			}
 
 			if err, ok := err.(*frame.Error); ok {
+				if _, resuming := current.(*waitResumeOkState); resuming {
+					// The server rejected or doesn't support the resumption, falls back to a fresh SETUP.
+					client.Debug("resume rejected", zap.Error(err))
+
+					client.renewSession(ctx, ErrStreamLost)
+
+					current = &connectState{}
+					continue
+				}
+
 				switch err.Code {
 				case frame.ErrInvalidSetup, frame.ErrUnsupportedSetup, frame.ErrRejectedSetup, frame.ErrRejectedResume:
+					if client.SetupConfirmation > 0 {
+						// the Dialer will report the rejection
+						return err
+					}
+
+					client.renewSession(ctx, ErrStreamLost)
+
+					current = &connectState{}
+					continue
+
+				case frame.ErrConnectionError, frame.ErrConnectionClose:
+					// The server terminated the session, the streams are lost with the connection.
+					client.renewSession(ctx, err)
+
 					current = &connectState{}
 					continue
 
@@ -89,7 +436,12 @@ func (client *rSocketClient) Serve(ctx context.Context) (err error) {
 				}
 			}
 
-			current = &connectState{client.Setup.ResumeToken}
+			if client.ResumeToken() == nil {
+				// The session is not resumable, the streams are lost with the connection.
+				client.renewSession(ctx, err)
+			}
+
+			current = &connectState{client.ResumeToken()}
 		}
 	}
 }
@@ -125,13 +477,43 @@ func (state *connectState) Next(ctx context.Context, client *rSocketClient) (nex
 		return
 	}
 
+	resumeToken := client.ResumeToken()
+
+	var resumableConn *proto.ResumableConn
+
+	if resumeToken != nil {
+		resumableConn = proto.NewResumableConn(conn, client.resumeState)
+		conn = resumableConn
+	}
+
+	if resumableConn != nil && client.fireAndForgetBuffer != nil {
+		conn = proto.NewFireAndForgetConn(conn, client.fireAndForgetBuffer)
+	}
+
 	keepaliveConn := proto.NewKeepaliveConn(conn, client.Keepalive)
 
-	if err = keepaliveConn.Serve(ctx); err != nil {
-		return
+	if resumableConn != nil {
+		keepaliveConn.Resumption = client.resumeState
 	}
 
-	conn = keepaliveConn
+	go keepaliveConn.Serve(ctx)
+
+	connection := proto.NewConnection(client.Logger, keepaliveConn)
+	connection.OnShutdown(proto.ShutdownKeepalive, keepaliveConn.Stop)
+	connection.OnAbort(client)
+
+	client.c.L.Lock()
+	client.connection = connection
+	client.c.L.Unlock()
+
+	conn = &sessionConn{connection}
+
+	defer func() {
+		if err != nil {
+			// The connection is never handed over to the next state.
+			conn.Close()
+		}
+	}()
 
 	if state.resumeToken == nil {
 		setupFrame := frame.NewSetupFrame(
@@ -139,7 +521,7 @@ func (state *connectState) Next(ctx context.Context, client *rSocketClient) (nex
 			client.Setup.Lease,
 			client.Keepalive.Interval,
 			client.Keepalive.MaxLifetime,
-			client.Setup.ResumeToken,
+			resumeToken,
 			client.Setup.MetadataMimeType,
 			client.Setup.DataMimeType,
 			client.Setup.Payload.HasMetadata,
@@ -151,24 +533,62 @@ func (state *connectState) Next(ctx context.Context, client *rSocketClient) (nex
 			return
 		}
 
-		if client.Setup.Lease {
-			next = &waitLeaseState{conn}
+		if client.SetupConfirmation > 0 {
+			next = &waitSetupState{conn}
+		} else if client.Setup.Lease {
+			next = &waitLeaseState{conn, nil}
 		} else {
 			next = &handleFramesState{conn, nil}
 		}
 	} else {
-		resumeFrame := frame.NewResumeFrame(
-			client.Setup.Version,
-			state.resumeToken,
-			0,
-			0,
-		)
+		resumeFrame := client.resumeState.ResumeFrame(client.Setup.Version, state.resumeToken)
 
 		if err = conn.Send(ctx, resumeFrame); err != nil {
 			return
 		}
 
-		next = &waitResumeOkState{conn}
+		next = &waitResumeOkState{conn, resumableConn}
+	}
+
+	return
+}
+
+type waitSetupState struct {
+	proto.Conn
+}
+
+func (state *waitSetupState) String() string {
+	return "WAIT_SETUP"
+}
+
+func (state *waitSetupState) Next(ctx context.Context, client *rSocketClient) (next State, err error) {
+	var f frame.Frame
+
+	confirmCtx, cancel := context.WithTimeout(ctx, client.SetupConfirmation)
+	f, err = state.Conn.Recv(confirmCtx)
+	cancel()
+
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		// no frame received, the SETUP is accepted
+		f, err = nil, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	if errorFrame, ok := f.(*frame.ErrorFrame); ok && errorFrame.StreamID() == 0 {
+		err = errorFrame.Err()
+
+		return
+	}
+
+	client.confirmSetup(nil)
+
+	if client.Setup.Lease {
+		next = &waitLeaseState{state.Conn, f}
+	} else {
+		next = &handleFramesState{state.Conn, f}
 	}
 
 	return
@@ -176,6 +596,7 @@ func (state *connectState) Next(ctx context.Context, client *rSocketClient) (nex
 
 type waitLeaseState struct {
 	proto.Conn
+	f frame.Frame
 }
 
 func (state *waitLeaseState) String() string {
@@ -183,22 +604,28 @@ func (state *waitLeaseState) String() string {
 }
 
 func (state *waitLeaseState) Next(ctx context.Context, client *rSocketClient) (next State, err error) {
-	var f frame.Frame
+	f := state.f
 
-	if f, err = state.Conn.Recv(ctx); err != nil {
-		return
+	if f == nil {
+		if f, err = state.Conn.Recv(ctx); err != nil {
+			return
+		}
 	}
 
 	switch f := f.(type) {
 	case *frame.LeaseFrame:
-		// TODO handle lease
-		f = nil
-		next = &handleFramesState{state.Conn, f}
+		if err = client.lease.Grant(f.TimeToLive, f.NumberOfRequests); err != nil {
+			return
+		}
+
+		next = &handleFramesState{state.Conn, nil}
 
 	case *frame.ErrorFrame:
 		err = f.Err()
 
 	default:
+		frame.Release(f)
+
 		connErr := frame.ErrConnectionError.WithMessage(fmt.Sprintf("unexpected frame: %s", f))
 
 		err = state.Conn.Send(ctx, frame.NewErrorFrame(0, connErr.Code, connErr.Data))
@@ -213,6 +640,7 @@ func (state *waitLeaseState) Next(ctx context.Context, client *rSocketClient) (n
 
 type waitResumeOkState struct {
 	proto.Conn
+	resumableConn *proto.ResumableConn // Resends the frames not received by the server once resumed.
 }
 
 func (state *waitResumeOkState) String() string {
@@ -228,7 +656,17 @@ func (state *waitResumeOkState) Next(ctx context.Context, client *rSocketClient)
 
 	switch f := f.(type) {
 	case *frame.ResumeOkFrame:
-		client.LastReceivedClientPosition = f.LastReceived
+		if err = state.resumableConn.Resend(ctx, f.LastReceived); err != nil {
+			// The frames not received by the server are lost, the session can't be resumed.
+			state.Conn.Close()
+
+			return
+		}
+
+		if client.sender != nil {
+			// The requester of the session resumed sends the frames on the new connection after the frames resent.
+			client.sender.switchTo(state.Conn)
+		}
 
 		next = &handleFramesState{state.Conn, nil}
 
@@ -236,6 +674,8 @@ func (state *waitResumeOkState) Next(ctx context.Context, client *rSocketClient)
 		err = f.Err()
 
 	default:
+		frame.Release(f)
+
 		connErr := frame.ErrConnectionError.WithMessage(fmt.Sprintf("unexpected frame: %s", f))
 
 		err = state.Conn.Send(ctx, frame.NewErrorFrame(0, connErr.Code, connErr.Data))
@@ -259,8 +699,39 @@ func (state *handleFramesState) String() string {
 
 func (state *handleFramesState) Next(ctx context.Context, client *rSocketClient) (next State, err error) {
 	if client.Requester == nil {
+		var opts []proto.RequesterOption
+
+		if client.Fragment.Enabled() {
+			opts = append(opts, proto.WithFragment(client.Fragment))
+		}
+
+		if client.StrictMetadata {
+			opts = append(opts, proto.WithStrictMetadata(client.Setup.MetadataMimeType))
+		} else {
+			opts = append(opts, proto.WithMetadataMimeType(client.Setup.MetadataMimeType))
+		}
+
+		if client.Setup.Lease {
+			opts = append(opts, proto.WithLease(client.lease))
+		}
+
+		if client.ErrorMapper != nil {
+			opts = append(opts, proto.WithErrorMapper(client.ErrorMapper))
+		}
+
+		if client.MaxConcurrentRequests > 0 {
+			opts = append(opts, proto.WithMaxConcurrentRequests(client.MaxConcurrentRequests))
+		}
+
+		client.sender = &sessionSender{conn: state.Conn}
+
+		requester := proto.NewRequester(client.Logger, client.sender, client.streamIDs, client.StreamRequestLimit, opts...)
+
+		// The requests lost with the previous connection are resent before any new request.
+		client.resendFireAndForget(ctx, requester)
+
 		client.c.L.Lock()
-		client.Requester = proto.NewRequester(client.Logger, state.Conn, client.streamIDs, client.StreamRequestLimit)
+		client.Requester = requester
 		client.c.L.Unlock()
 
 		client.c.Broadcast()
@@ -283,3 +754,62 @@ func (state *handleFramesState) Next(ctx context.Context, client *rSocketClient)
 
 	return
 }
+
+// sessionConn is the Connection of a session, which is dropped without the frames queued written once closed,
+// the client closes it gracefully with CloseWithError.
+type sessionConn struct {
+	*proto.Connection
+}
+
+var _ proto.Conn = (*sessionConn)(nil)
+
+func (conn *sessionConn) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := conn.Connection.Close(ctx); err != nil && err != context.Canceled {
+		return err
+	}
+
+	return nil
+}
+
+// sessionSender sends the frames on the connection of current session,
+// which is switched to the new connection once the session resumed.
+type sessionSender struct {
+	lock sync.RWMutex
+	conn proto.Conn
+}
+
+var _ proto.QueueFlusher = (*sessionSender)(nil)
+
+func (sender *sessionSender) switchTo(conn proto.Conn) {
+	sender.lock.Lock()
+	defer sender.lock.Unlock()
+
+	sender.conn = conn
+}
+
+func (sender *sessionSender) current() proto.Conn {
+	sender.lock.RLock()
+	defer sender.lock.RUnlock()
+
+	return sender.conn
+}
+
+// Send the frame on the connection of current session.
+func (sender *sessionSender) Send(ctx context.Context, f frame.Frame) error {
+	return sender.current().Send(ctx, f)
+}
+
+// Flush the frames buffered by the connection of current session.
+func (sender *sessionSender) Flush(ctx context.Context) error {
+	switch flusher := sender.current().(type) {
+	case proto.QueueFlusher:
+		return flusher.Flush(ctx)
+	case proto.Flusher:
+		return flusher.Flush()
+	default:
+		return nil
+	}
+}
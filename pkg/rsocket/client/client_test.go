@@ -0,0 +1,608 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type pipeConn struct {
+	proto.FrameSender
+	proto.FrameReceiver
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeConn(sender proto.FrameSender, receiver proto.FrameReceiver) *pipeConn {
+	return &pipeConn{FrameSender: sender, FrameReceiver: receiver, closed: make(chan struct{})}
+}
+
+func (conn *pipeConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+	})
+
+	return nil
+}
+
+// Send returns io.ErrClosedPipe once the connection closed, which simulates the socket dropped.
+func (conn *pipeConn) Send(ctx context.Context, f frame.Frame) error {
+	select {
+	case <-conn.closed:
+		return io.ErrClosedPipe
+	default:
+		return conn.FrameSender.Send(ctx, f)
+	}
+}
+
+// Recv returns io.EOF once a nil frame received or the connection closed, which simulates the connection lost.
+func (conn *pipeConn) Recv(parent context.Context) (frame.Frame, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-conn.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	f, err := conn.FrameReceiver.Recv(ctx)
+
+	if err == nil && f == nil {
+		return nil, io.EOF
+	}
+
+	if err != nil && parent.Err() == nil {
+		select {
+		case <-conn.closed:
+			return nil, io.EOF
+		default:
+		}
+	}
+
+	return f, err
+}
+
+// pipeTransport connects a new connection on the same pair of channels each time,
+// the connections dropped reject the frames sent.
+type pipeTransport struct {
+	requests  *proto.FrameChan
+	responses *proto.FrameChan
+	lock      sync.Mutex
+	conns     []*pipeConn
+}
+
+func (transport *pipeTransport) Connect(ctx context.Context) (proto.Conn, error) {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+
+	conn := newPipeConn(transport.requests, transport.responses)
+
+	transport.conns = append(transport.conns, conn)
+
+	return conn, nil
+}
+
+// connections returns the connections connected in order.
+func (transport *pipeTransport) connections() []*pipeConn {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+
+	return append([]*pipeConn(nil), transport.conns...)
+}
+
+func newPipeTransport() (transport *pipeTransport, requests *proto.FrameChan, responses *proto.FrameChan) {
+	requests = proto.NewFrameChan(4)
+	responses = proto.NewFrameChan(4)
+	transport = &pipeTransport{requests: requests, responses: responses}
+
+	return
+}
+
+func TestSetupConfirmation(t *testing.T) {
+	Convey("Given a dialer waits the SETUP confirmation", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, requests, responses := newPipeTransport()
+		dialer := newDialer(WithSetupConfirmation(100 * time.Millisecond))
+
+		Convey("When the server rejects the SETUP", func() {
+			go func() {
+				if f, err := requests.Recv(ctx); err == nil && f.Type() == frame.TypeSetup {
+					responses.Send(ctx, frame.NewErrorFrame(0, frame.ErrRejectedSetup, "go away"))
+				}
+			}()
+
+			client, err := dialer.connect(ctx, transport)
+
+			Convey("Then the rejection should be returned", func() {
+				So(client == nil, ShouldBeTrue)
+				So(err, ShouldResemble, frame.ErrRejectedSetup.WithMessage("go away"))
+			})
+		})
+
+		Convey("When the server accepts the SETUP silently", func() {
+			client, err := dialer.connect(ctx, transport)
+
+			Convey("Then the client should be connected", func() {
+				So(err, ShouldBeNil)
+				So(client == nil, ShouldBeFalse)
+
+				f, _ := requests.Recv(ctx)
+				So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+				So(client.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestResumeTokenPolicy(t *testing.T) {
+	for _, policy := range []ResumeTokenPolicy{ReuseResumeToken, RotateResumeToken} {
+		Convey(fmt.Sprintf("Given a dialer with resume token and policy #%d", policy), t, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			token := frame.NewToken()
+			transport, requests, responses := newPipeTransport()
+			dialer := newDialer(WithResumeToken(token), WithResumeTokenPolicy(policy), WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+			disconnect := func() {
+				So(responses.Send(ctx, nil), ShouldBeNil)
+			}
+
+			client, err := dialer.connect(ctx, transport)
+			So(err, ShouldBeNil)
+			defer client.Close()
+
+			f, _ := requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeSetup)
+			So(f.(*frame.SetupFrame).ResumeToken, ShouldResemble, token)
+
+			Convey("When the connection lost", func() {
+				disconnect()
+
+				f, _ := requests.Recv(ctx)
+				So(f.Type(), ShouldEqual, frame.TypeResume)
+				So(f.(*frame.ResumeFrame).Token, ShouldResemble, token)
+
+				Convey("Then the session accepted by server should keep the original token", func() {
+					So(responses.Send(ctx, frame.NewResumeOkFrame(0)), ShouldBeNil)
+
+					disconnect()
+
+					f, _ := requests.Recv(ctx)
+					So(f.Type(), ShouldEqual, frame.TypeResume)
+					So(f.(*frame.ResumeFrame).Token, ShouldResemble, token)
+					So(client.ResumeToken(), ShouldResemble, token)
+				})
+
+				Convey("Then the session rejected by server should be renewed with a fresh SETUP", func() {
+					So(responses.Send(ctx, frame.NewErrorFrame(0, frame.ErrRejectedResume, "unknown session")), ShouldBeNil)
+
+					f, _ := requests.Recv(ctx)
+					So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+					newToken := f.(*frame.SetupFrame).ResumeToken
+
+					if policy == RotateResumeToken {
+						So(newToken, ShouldNotResemble, token)
+					} else {
+						So(newToken, ShouldResemble, token)
+					}
+
+					So(client.ResumeToken(), ShouldResemble, newToken)
+				})
+			})
+		})
+	}
+}
+
+func TestResumeRejectedFallsBackToSetup(t *testing.T) {
+	for _, rejection := range []*frame.Error{
+		frame.ErrRejectedResume.WithMessage("unknown session"),
+		frame.ErrConnectionError.WithMessage("resumption not supported"),
+	} {
+		Convey(fmt.Sprintf("Given a resumable client with a request in progress, and server rejects RESUME with %s", rejection), t, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			transport, requests, responses := newPipeTransport()
+			dialer := newDialer(WithResumeToken(frame.NewToken()), WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+			c, err := dialer.connect(ctx, transport)
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			client := c.(*rSocketClient)
+
+			f, _ := requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+			client.c.L.Lock()
+			for client.Requester == nil {
+				client.c.Wait()
+			}
+			requester := client.Requester
+			client.c.L.Unlock()
+
+			result := make(chan error, 1)
+
+			go func() {
+				_, err := requester.RequestResponse(ctx, proto.Text("hello"))
+
+				result <- err
+			}()
+
+			f, _ = requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeRequestResponse)
+
+			Convey("When the connection lost and the resumption rejected", func() {
+				So(responses.Send(ctx, nil), ShouldBeNil)
+
+				f, _ := requests.Recv(ctx)
+				So(f.Type(), ShouldEqual, frame.TypeResume)
+
+				So(responses.Send(ctx, frame.NewErrorFrame(0, rejection.Code, rejection.Data)), ShouldBeNil)
+
+				Convey("Then the client should setup a new session, and the request should be lost", func() {
+					f, _ := requests.Recv(ctx)
+					So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+					So(<-result, ShouldEqual, ErrStreamLost)
+				})
+			})
+		})
+	}
+}
+
+func TestResumeResendsFramesNotReceived(t *testing.T) {
+	Convey("Given a resumable client with a request in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, requests, responses := newPipeTransport()
+		dialer := newDialer(WithResumeToken(frame.NewToken()), WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+		c, err := dialer.connect(ctx, transport)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		client := c.(*rSocketClient)
+
+		f, _ := requests.Recv(ctx)
+		So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+		client.c.L.Lock()
+		for client.Requester == nil {
+			client.c.Wait()
+		}
+		requester := client.Requester
+		client.c.L.Unlock()
+
+		result := make(chan *proto.Payload, 1)
+
+		go func() {
+			payload, _ := requester.RequestResponse(ctx, proto.Text("hello"))
+
+			result <- payload
+		}()
+
+		request, _ := requests.Recv(ctx)
+		So(request.Type(), ShouldEqual, frame.TypeRequestResponse)
+
+		Convey("When the connection lost before the server received the request", func() {
+			So(responses.Send(ctx, nil), ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeResume)
+
+			So(responses.Send(ctx, frame.NewResumeOkFrame(0)), ShouldBeNil)
+
+			Convey("Then the request should be resent once resumed, and completed on the new connection", func() {
+				f, _ := requests.Recv(ctx)
+				So(f, ShouldEqual, request)
+
+				So(responses.Send(ctx, frame.NewPayloadFrame(request.StreamID(), false, true, true, false, nil, []byte("world"))), ShouldBeNil)
+
+				payload := <-result
+				So(payload, ShouldNotBeNil)
+				So(payload.Text(), ShouldEqual, "world")
+			})
+		})
+	})
+}
+
+func TestRequestAfterResumeSentOnNewConnection(t *testing.T) {
+	Convey("Given a resumable client", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, requests, responses := newPipeTransport()
+		dialer := newDialer(WithResumeToken(frame.NewToken()), WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+		c, err := dialer.connect(ctx, transport)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		client := c.(*rSocketClient)
+
+		f, _ := requests.Recv(ctx)
+		So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+		Convey("When the connection lost and the session resumed", func() {
+			So(responses.Send(ctx, nil), ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeResume)
+
+			So(responses.Send(ctx, frame.NewResumeOkFrame(0)), ShouldBeNil)
+
+			// The KEEPALIVE echoed proves the RESUME_OK handled.
+			So(responses.Send(ctx, frame.NewKeepaliveFrame(true, 0, nil)), ShouldBeNil)
+
+			f, _ = requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeKeepalive)
+
+			Convey("Then the request should be sent on the new connection", func() {
+				result := make(chan error, 1)
+
+				go func() {
+					_, err := client.RequestResponse(ctx, proto.Text("hello"))
+
+					result <- err
+				}()
+
+				f, _ := requests.Recv(ctx)
+				So(f, ShouldNotBeNil)
+				So(f.Type(), ShouldEqual, frame.TypeRequestResponse)
+
+				conns := transport.connections()
+				So(conns, ShouldHaveLength, 2)
+
+				So(conns[0].Send(ctx, f), ShouldEqual, io.ErrClosedPipe)
+
+				So(responses.Send(ctx, frame.NewPayloadFrame(f.StreamID(), false, true, true, false, nil, []byte("world"))), ShouldBeNil)
+				So(<-result, ShouldBeNil)
+			})
+		})
+	})
+}
+
+// halfOpenTransport connects to a connection accepts the frames sent but never delivers a frame,
+// the reconnection blocks until cancelled.
+type halfOpenTransport struct {
+	connected bool
+}
+
+func (transport *halfOpenTransport) Connect(ctx context.Context) (proto.Conn, error) {
+	if transport.connected {
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}
+
+	transport.connected = true
+
+	return newPipeConn(proto.NewFrameChan(64), proto.NewFrameChan(0)), nil
+}
+
+func TestKeepaliveTimeoutFailsStreams(t *testing.T) {
+	Convey("Given a client with a stream in progress on a half-open connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		dialer := newDialer(WithKeepalive(10*time.Millisecond), WithMaxLifetime(50*time.Millisecond))
+
+		c, err := dialer.connect(ctx, &halfOpenTransport{})
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		client := c.(*rSocketClient)
+
+		client.c.L.Lock()
+		for client.Requester == nil {
+			client.c.Wait()
+		}
+		requester := client.Requester
+		client.c.L.Unlock()
+
+		stream, err := requester.RequestStream(ctx, proto.Text("hello"))
+		So(err, ShouldBeNil)
+
+		Convey("When no KEEPALIVE echoed in the max lifetime", func() {
+			_, err := stream.Recv(ctx)
+
+			Convey("Then the stream should fail with keepalive timeout", func() {
+				So(err, ShouldEqual, proto.ErrKeepaliveTimeout)
+			})
+		})
+	})
+}
+
+func TestFireAndForgetResentOnReconnect(t *testing.T) {
+	Convey("Given a resumable client retains the FIRE_AND_FORGET requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, requests, responses := newPipeTransport()
+		dialer := newDialer(WithFireAndForgetBuffer(4), WithResumeToken(frame.NewToken()), WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+		c, err := dialer.connect(ctx, transport)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		client := c.(*rSocketClient)
+
+		f, _ := requests.Recv(ctx)
+		So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+		client.c.L.Lock()
+		for client.Requester == nil {
+			client.c.Wait()
+		}
+		client.c.L.Unlock()
+
+		Convey("When the session lost after the requests sent and one of them confirmed", func() {
+			So(client.FireAndForget(ctx, proto.Text("delivered")), ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeRequestFireAndForget)
+
+			So(responses.Send(ctx, frame.NewKeepaliveFrame(false, proto.Position(f.Size()), nil)), ShouldBeNil)
+
+			So(client.FireAndForget(ctx, proto.Text("lost")), ShouldBeNil)
+
+			f, _ = requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeRequestFireAndForget)
+
+			So(responses.Send(ctx, nil), ShouldBeNil)
+
+			f, _ = requests.Recv(ctx)
+			So(f.Type(), ShouldEqual, frame.TypeResume)
+
+			So(responses.Send(ctx, frame.NewErrorFrame(0, frame.ErrRejectedResume, "unknown session")), ShouldBeNil)
+
+			Convey("Then the request not confirmed should be resent on the new session", func() {
+				f, _ := requests.Recv(ctx)
+				So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+				f, _ = requests.Recv(ctx)
+				So(f.Type(), ShouldEqual, frame.TypeRequestFireAndForget)
+				So(string(f.(*frame.RequestFireAndForgetFrame).Data), ShouldEqual, "lost")
+
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestFireAndForgetBufferRequiresResumption(t *testing.T) {
+	Convey("Given a client retains the FIRE_AND_FORGET requests without resume token", t, func() {
+		transport, _, _ := newPipeTransport()
+		client := newClient(newDialer(WithFireAndForgetBuffer(4)), transport)
+
+		Convey("Then the buffer should be disabled, since the server never confirms the position", func() {
+			So(client.fireAndForgetBuffer, ShouldBeNil)
+		})
+	})
+}
+
+func TestRequestOnDisconnectedClient(t *testing.T) {
+	Convey("Given a client without the requester of a session", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, _, _ := newPipeTransport()
+		client := newClient(newDialer(), transport)
+
+		Convey("When send the requests", func() {
+			_, responseErr := client.RequestResponse(ctx, proto.Text("hello"))
+			_, streamErr := client.RequestStream(ctx, proto.Text("hello"))
+			fireAndForgetErr := client.FireAndForget(ctx, proto.Text("hello"))
+			_, builderErr := client.NewRequest().Payload(proto.Text("hello")).Response(ctx)
+
+			Convey("Then the requests should fail with ErrDisconnected instead of panic", func() {
+				So(responseErr, ShouldEqual, ErrDisconnected)
+				So(streamErr, ShouldEqual, ErrDisconnected)
+				So(fireAndForgetErr, ShouldEqual, ErrDisconnected)
+				So(builderErr, ShouldEqual, ErrDisconnected)
+				So(client.ActiveStreams(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestCloseWhileServing(t *testing.T) {
+	Convey("Given a client starts to serve", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, _, _ := newPipeTransport()
+		client := newClient(newDialer(), transport)
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- client.Serve(ctx)
+		}()
+
+		Convey("When close the client concurrently", func() {
+			So(client.Close(), ShouldBeNil)
+
+			Convey("Then the client should stop serving", func() {
+				select {
+				case err := <-done:
+					So(err, ShouldBeNil)
+				case <-ctx.Done():
+					So(ctx.Err(), ShouldBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestCloseWithError(t *testing.T) {
+	Convey("Given a client with a stream in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport, requests, _ := newPipeTransport()
+		dialer := newDialer(WithKeepalive(time.Minute), WithMaxLifetime(time.Hour))
+
+		c, err := dialer.connect(ctx, transport)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		client := c.(*rSocketClient)
+
+		f, _ := requests.Recv(ctx)
+		So(f.Type(), ShouldEqual, frame.TypeSetup)
+
+		client.c.L.Lock()
+		for client.Requester == nil {
+			client.c.Wait()
+		}
+		client.c.L.Unlock()
+
+		stream, err := client.RequestStream(ctx, proto.Text("hello"))
+		So(err, ShouldBeNil)
+
+		f, _ = requests.Recv(ctx)
+		So(f.Type(), ShouldEqual, frame.TypeRequestStream)
+
+		Convey("When close the client with an error", func() {
+			reason := frame.ErrConnectionClose.WithMessage("bye")
+
+			So(client.CloseWithError(ctx, reason), ShouldBeNil)
+
+			Convey("Then the server should be told why", func() {
+				f, _ := requests.Recv(ctx)
+				So(f, ShouldNotBeNil)
+				So(f.StreamID(), ShouldEqual, 0)
+				So(f.(*frame.ErrorFrame).Err(), ShouldResemble, reason)
+			})
+
+			Convey("Then the stream should fail with the error", func() {
+				_, err := stream.Recv(ctx)
+				So(err, ShouldResemble, reason)
+			})
+
+			Convey("Then the client should not reconnect", func() {
+				<-client.confirmed
+
+				So(transport.connections(), ShouldHaveLength, 1)
+			})
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
 	"github.com/flier/rsocket-go/pkg/rsocket/proto"
 	"github.com/flier/rsocket-go/pkg/rsocket/transport"
 	"go.uber.org/zap"
@@ -36,6 +37,13 @@ func WithResumeToken(token proto.Token) DialOption {
 	}
 }
 
+// WithResumeTokenPolicy configure the resume token of the new session once the resumption rejected
+func WithResumeTokenPolicy(policy ResumeTokenPolicy) DialOption {
+	return func(dialer *Dialer) {
+		dialer.ResumeTokenPolicy = policy
+	}
+}
+
 // WithKeepalive configure keep-alive options
 func WithKeepalive(keepalive time.Duration) DialOption {
 	return func(dialer *Dialer) {
@@ -50,6 +58,20 @@ func WithMaxLifetime(maxLifetime time.Duration) DialOption {
 	}
 }
 
+// WithKeepaliveData configure the provider of data sent in each KEEPALIVE frame
+func WithKeepaliveData(provider func() []byte) DialOption {
+	return func(dialer *Dialer) {
+		dialer.Keepalive.Provider = provider
+	}
+}
+
+// OnKeepalive configure the observer of data received in KEEPALIVE frames
+func OnKeepalive(observer func(data []byte)) DialOption {
+	return func(dialer *Dialer) {
+		dialer.Keepalive.Observer = observer
+	}
+}
+
 // WithMetadataMimeType configure metadata payloads MIME type of RSocket
 func WithMetadataMimeType(metadataMimeType string) DialOption {
 	return func(dialer *Dialer) {
@@ -78,6 +100,42 @@ func WithFragment(mtu uint) DialOption {
 	}
 }
 
+// WithFragmentSize configure the fragment size of requester RSocket, which never exceeds the MTU
+func WithFragmentSize(size uint) DialOption {
+	return func(dialer *Dialer) {
+		dialer.Fragment.Size = size
+	}
+}
+
+// WithSetupConfirmation configure to wait the server accepts the SETUP frame before the client returned,
+// the server is assumed to accept it if no frame received in the timeout.
+func WithSetupConfirmation(timeout time.Duration) DialOption {
+	return func(dialer *Dialer) {
+		dialer.SetupConfirmation = timeout
+	}
+}
+
+// WithStrictMetadata configure to reject sending metadata if the metadata MIME type is not negotiated
+func WithStrictMetadata() DialOption {
+	return func(dialer *Dialer) {
+		dialer.StrictMetadata = true
+	}
+}
+
+// WithErrorMapper configure the translation of errors received by requester RSocket
+func WithErrorMapper(mapper proto.ErrorMapper) DialOption {
+	return func(dialer *Dialer) {
+		dialer.ErrorMapper = mapper
+	}
+}
+
+// WithMaxConcurrentRequests configure the limit of concurrent in-flight requests
+func WithMaxConcurrentRequests(n uint) DialOption {
+	return func(dialer *Dialer) {
+		dialer.MaxConcurrentRequests = n
+	}
+}
+
 // WithLease configure lease support
 func WithLease(ttl time.Duration, requests uint) DialOption {
 	return func(dialer *Dialer) {
@@ -87,6 +145,41 @@ func WithLease(ttl time.Duration, requests uint) DialOption {
 	}
 }
 
+// WithFireAndForgetBuffer configure to retain at most size FIRE_AND_FORGET requests recently sent,
+// which are resent on a new session if not confirmed delivered by the position in KEEPALIVE frames,
+// it takes effect only with the resume token, since the server without resumption never confirms the position
+func WithFireAndForgetBuffer(size int) DialOption {
+	return func(dialer *Dialer) {
+		dialer.FireAndForgetBuffer = size
+	}
+}
+
+// WithResumeBuffer configure to retain at most size frames sent to resume the session,
+// the session can't be resumed once the frames not acknowledged by the server dropped
+func WithResumeBuffer(size int) DialOption {
+	return func(dialer *Dialer) {
+		dialer.ResumeBuffer = size
+	}
+}
+
+// WithSocketOptions configure the socket options of TCP transport
+func WithSocketOptions(opts ...transport.SocketOption) DialOption {
+	return func(dialer *Dialer) {
+		dialer.SocketOptions = append(dialer.SocketOptions, opts...)
+	}
+}
+
+// WithAllocator configure the allocator of buffers of frames read,
+// the payloads received but not consumed are bounded by the allocator, e.g. a frame.BudgetAllocator
+func WithAllocator(allocator frame.Allocator) DialOption {
+	return WithSocketOptions(transport.WithAllocator(allocator))
+}
+
+// WithMetadataLimit configure to reject the frames received with metadata exceeds the limit
+func WithMetadataLimit(limit *frame.MetadataLimit) DialOption {
+	return WithSocketOptions(transport.WithMetadataLimit(limit))
+}
+
 // Dial connects to the target URL.
 func Dial(target *url.URL, opts ...DialOption) (clnt Client, err error) {
 	return newDialer(opts...).Dial(target)
@@ -100,11 +193,19 @@ func DialContext(ctx context.Context, target *url.URL, opts ...DialOption) (clnt
 // A Dialer contains options for connecting to a target URL.
 type Dialer struct {
 	*zap.Logger
-	Setup              *proto.SetupOption
-	Lease              *proto.LeaseOption
-	Keepalive          *proto.KeepaliveOption
-	Fragment           *proto.FragmentOption
-	StreamRequestLimit uint
+	Setup                 *proto.SetupOption
+	Lease                 *proto.LeaseOption
+	Keepalive             *proto.KeepaliveOption
+	Fragment              *proto.FragmentOption
+	StreamRequestLimit    uint
+	SetupConfirmation     time.Duration // Time to wait the server rejects the SETUP frame, or 0 if not wait.
+	StrictMetadata        bool
+	ErrorMapper           proto.ErrorMapper // Translates the errors received, or nil if not translate.
+	SocketOptions         []transport.SocketOption
+	MaxConcurrentRequests uint              // The limit of concurrent in-flight requests, or 0 if unlimited.
+	ResumeTokenPolicy     ResumeTokenPolicy // The resume token of the new session once the resumption rejected.
+	FireAndForgetBuffer   int               // The FIRE_AND_FORGET requests retained to resend, or 0 if disabled.
+	ResumeBuffer          int               // The frames retained to resume the session, or 0 if unbounded.
 }
 
 func newDialer(opts ...DialOption) *Dialer {
@@ -115,6 +216,14 @@ func newDialer(opts ...DialOption) *Dialer {
 		proto.NewKeepaliveOption(),
 		proto.NewFragmentOption(),
 		defaultStreamRequestLimit,
+		0,
+		false,
+		nil,
+		nil,
+		0,
+		ReuseResumeToken,
+		0,
+		0,
 	}
 
 	for _, opt := range opts {
@@ -133,15 +242,33 @@ func (dialer *Dialer) Dial(target *url.URL) (Client, error) {
 func (dialer *Dialer) DialContext(ctx context.Context, target *url.URL) (client Client, err error) {
 	var t transport.Transport
 
-	if t, err = transport.ForURI(dialer.Logger, target); err != nil {
+	if t, err = transport.ForURI(dialer.Logger, target, dialer.SocketOptions...); err != nil {
 		return
 	}
 
-	clnt := newClient(dialer, t)
+	return dialer.connect(ctx, t)
+}
+
+func (dialer *Dialer) connect(ctx context.Context, t transport.Transport) (Client, error) {
+	client := newClient(dialer, t)
+
+	go client.Serve(ctx)
 
-	go clnt.Serve(ctx)
+	if dialer.SetupConfirmation > 0 {
+		select {
+		case <-ctx.Done():
+			client.Close()
 
-	client = clnt
+			return nil, ctx.Err()
+
+		case err := <-client.confirmed:
+			if err != nil {
+				client.Close()
+
+				return nil, err
+			}
+		}
+	}
 
-	return
+	return client, nil
 }
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto/prototest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func dialEchoServer(ctx context.Context, behavior prototest.Behavior) *rSocketClient {
+	transport := prototest.NewTransport()
+	server := prototest.NewEchoServer(prototest.WithStreamBehavior(behavior))
+
+	go server.ServeTransport(ctx, transport)
+
+	c, err := newDialer().connect(ctx, transport)
+	So(err, ShouldBeNil)
+
+	client := c.(*rSocketClient)
+
+	client.c.L.Lock()
+	for client.Requester == nil {
+		client.c.Wait()
+	}
+	client.c.L.Unlock()
+
+	return client
+}
+
+func collect(ctx context.Context, stream *proto.PayloadStream) (texts []string, err error) {
+	err = stream.ForEach(ctx, func(payload *proto.Payload) error {
+		texts = append(texts, payload.Text())
+
+		return nil
+	})
+
+	return
+}
+
+func TestRoundTripWithEchoServer(t *testing.T) {
+	Convey("Given a client connected to an echo server", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client := dialEchoServer(ctx, prototest.Count(3))
+		defer client.Close()
+
+		Convey("When send a request", func() {
+			payload, err := client.RequestResponse(ctx, proto.Text("hello"))
+
+			Convey("Then the payload should be echoed", func() {
+				So(err, ShouldBeNil)
+				So(payload.Text(), ShouldEqual, "hello")
+			})
+		})
+
+		Convey("When send a request with the data MIME type differs from the connection", func() {
+			request, err := proto.Text("hello").WithDataMimeType("text/plain")
+			So(err, ShouldBeNil)
+
+			payload, err := client.RequestResponse(ctx, request)
+
+			Convey("Then the data MIME type should be round-tripped", func() {
+				So(err, ShouldBeNil)
+				So(payload.Text(), ShouldEqual, "hello")
+
+				mime, ok := payload.DataMimeType()
+				So(ok, ShouldBeTrue)
+				So(mime, ShouldEqual, "text/plain")
+				So(mime, ShouldNotEqual, client.Setup.DataMimeType)
+			})
+		})
+
+		Convey("When request a stream", func() {
+			stream, err := client.RequestStream(ctx, proto.Text("hello"))
+			So(err, ShouldBeNil)
+
+			texts, err := collect(ctx, stream)
+
+			Convey("Then the payloads should be counted", func() {
+				So(err, ShouldBeNil)
+				So(texts, ShouldResemble, []string{"0", "1", "2"})
+			})
+		})
+
+		Convey("When request a channel", func() {
+			stream, err := client.RequestChannel(ctx, textStream("foo", "bar"))
+			So(err, ShouldBeNil)
+
+			texts, err := collect(ctx, stream)
+
+			Convey("Then the payloads should be echoed", func() {
+				So(err, ShouldBeNil)
+				So(texts, ShouldResemble, []string{"foo", "bar"})
+			})
+		})
+	})
+
+	Convey("Given a client connected to an echo server fails the stream", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client := dialEchoServer(ctx, prototest.ErrorAfter(2, errors.New("boom")))
+		defer client.Close()
+
+		Convey("When request a stream", func() {
+			stream, err := client.RequestStream(ctx, proto.Text("hello"))
+			So(err, ShouldBeNil)
+
+			texts, err := collect(ctx, stream)
+
+			Convey("Then the error should be received after the payloads", func() {
+				So(texts, ShouldResemble, []string{"0", "1"})
+				So(err, ShouldResemble, frame.ErrApplicationError.WithMessage("boom"))
+			})
+		})
+	})
+}
+
+func TestRequestChannelTransform(t *testing.T) {
+	Convey("Given a client connected to an echo server", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client := dialEchoServer(ctx, prototest.Echo())
+		defer client.Close()
+
+		in := make(chan *proto.Payload)
+
+		go func() {
+			defer close(in)
+
+			for _, text := range []string{"a", "b", "c", "d", "e"} {
+				select {
+				case in <- proto.Text(text):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		Convey("When request a channel with a transform", func() {
+			stream, err := proto.RequestChannelTransform(ctx, client, in, func(payload *proto.Payload) (*proto.Payload, error) {
+				return proto.Text(strings.ToUpper(payload.Text())), nil
+			})
+			So(err, ShouldBeNil)
+
+			texts, err := collect(ctx, stream)
+
+			Convey("Then the payloads should be echoed and transformed", func() {
+				So(err, ShouldBeNil)
+				So(texts, ShouldResemble, []string{"A", "B", "C", "D", "E"})
+			})
+		})
+
+		Convey("When the transform fails", func() {
+			stream, err := proto.RequestChannelTransform(ctx, client, in, func(payload *proto.Payload) (*proto.Payload, error) {
+				if payload.Text() == "c" {
+					return nil, errors.New("boom")
+				}
+
+				return payload, nil
+			})
+			So(err, ShouldBeNil)
+
+			texts, err := collect(ctx, stream)
+
+			Convey("Then the channel should fail with the error after the payloads transformed", func() {
+				So(texts, ShouldResemble, []string{"a", "b"})
+				So(err, ShouldResemble, errors.New("boom"))
+			})
+		})
+	})
+}
+
+func textStream(texts ...string) *proto.PayloadStream {
+	stream, sink := proto.NewPayloadPipe(len(texts))
+
+	for _, text := range texts {
+		sink.Send(context.Background(), proto.Ok(proto.Text(text)))
+	}
+
+	sink.Close()
+
+	return stream
+}
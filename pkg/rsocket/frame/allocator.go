@@ -0,0 +1,67 @@
+package frame
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrMemoryExhausted is returned when read a frame exceeds the memory budget.
+var ErrMemoryExhausted = errors.New("memory budget exhausted")
+
+// Allocator allocates the buffers of frames read.
+//
+// The buffer of a PAYLOAD frame is held until the frame released by Release once consumed,
+// the buffers of other frames are released once the frames decoded.
+type Allocator interface {
+	// Allocate returns a buffer of size, or an error if not allowed.
+	Allocate(size int) ([]byte, error)
+
+	// Release returns the buffer allocated.
+	Release(buf []byte)
+}
+
+// BudgetAllocator allocates buffers within a memory budget, which can be shared across connections.
+type BudgetAllocator struct {
+	budget int64
+	used   int64
+}
+
+var _ Allocator = (*BudgetAllocator)(nil)
+
+// NewBudgetAllocator creates a BudgetAllocator allows at most budget bytes allocated at the same time.
+func NewBudgetAllocator(budget int64) *BudgetAllocator {
+	return &BudgetAllocator{budget, 0}
+}
+
+// Allocate returns a buffer of size, or ErrMemoryExhausted if exceeds the budget.
+func (allocator *BudgetAllocator) Allocate(size int) ([]byte, error) {
+	if atomic.AddInt64(&allocator.used, int64(size)) > allocator.budget {
+		atomic.AddInt64(&allocator.used, -int64(size))
+
+		return nil, ErrMemoryExhausted
+	}
+
+	return make([]byte, size), nil
+}
+
+// Release returns the buffer to the budget.
+func (allocator *BudgetAllocator) Release(buf []byte) {
+	atomic.AddInt64(&allocator.used, -int64(len(buf)))
+}
+
+// Used returns the bytes allocated and not released.
+func (allocator *BudgetAllocator) Used() int64 {
+	return atomic.LoadInt64(&allocator.used)
+}
+
+// releases holds the functions release the buffers of PAYLOAD frames read with an Allocator.
+var releases sync.Map
+
+// Release returns the buffer of frame read with an Allocator once the frame consumed,
+// it does nothing if the frame was not read with an Allocator or has been released.
+func Release(frame Frame) {
+	if release, ok := releases.LoadAndDelete(frame); ok {
+		release.(func())()
+	}
+}
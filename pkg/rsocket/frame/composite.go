@@ -0,0 +1,284 @@
+package frame
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompositeMetadataMimeType is the MIME type of the composite metadata.
+const CompositeMetadataMimeType = "message/x.rsocket.composite-metadata.v0"
+
+// WellKnownMimeFlag flags the byte encodes the ID of a well-known MIME type, or a well-known authentication type.
+const WellKnownMimeFlag = 0x80
+
+const mimeIDMask = 0x7F
+
+// ErrInvalidEntry is returned when append an entry with too long MIME type or content to the composite metadata.
+var ErrInvalidEntry = errors.New("invalid composite metadata entry")
+
+// ErrInvalidCompositeMetadata is returned when decode a malformed composite metadata.
+var ErrInvalidCompositeMetadata = errors.New("invalid composite metadata")
+
+// MaxMimeLength is the max length of MIME type encoded in the composite metadata.
+const MaxMimeLength = 0x80
+
+const maxContentLength = 0xFFFFFF
+
+// WellKnownMimeTypes maps the well-known MIME type ID to MIME type.
+var WellKnownMimeTypes = map[byte]string{
+	0x00: "application/avro",
+	0x01: "application/cbor",
+	0x02: "application/graphql",
+	0x03: "application/gzip",
+	0x04: "application/javascript",
+	0x05: "application/json",
+	0x06: "application/octet-stream",
+	0x07: "application/pdf",
+	0x08: "application/vnd.apache.thrift.binary",
+	0x09: "application/vnd.google.protobuf",
+	0x0A: "application/xml",
+	0x0B: "application/zip",
+	0x0C: "audio/aac",
+	0x0D: "audio/mp3",
+	0x0E: "audio/mp4",
+	0x0F: "audio/mpeg3",
+	0x10: "audio/mpeg",
+	0x11: "audio/ogg",
+	0x12: "audio/opus",
+	0x13: "audio/vorbis",
+	0x14: "image/bmp",
+	0x15: "image/gif",
+	0x16: "image/heic-sequence",
+	0x17: "image/heic",
+	0x18: "image/heif-sequence",
+	0x19: "image/heif",
+	0x1A: "image/jpeg",
+	0x1B: "image/png",
+	0x1C: "image/tiff",
+	0x1D: "multipart/mixed",
+	0x1E: "text/css",
+	0x1F: "text/csv",
+	0x20: "text/html",
+	0x21: "text/plain",
+	0x22: "text/xml",
+	0x23: "video/H264",
+	0x24: "video/H265",
+	0x25: "video/VP8",
+	0x26: "application/x-hessian",
+	0x27: "application/x-java-object",
+	0x28: "application/cloudevents+json",
+	0x29: "application/x-capnp",
+	0x2A: "application/x-flatbuffers",
+	0x7A: "message/x.rsocket.mime-type.v0",
+	0x7B: "message/x.rsocket.accept-mime-types.v0",
+	0x7C: "message/x.rsocket.authentication.v0",
+	0x7D: "message/x.rsocket.tracing-zipkin.v0",
+	0x7E: "message/x.rsocket.routing.v0",
+	0x7F: CompositeMetadataMimeType,
+}
+
+// WellKnownMime is the ID of a MIME type in the WellKnownMimeTypes.
+type WellKnownMime byte
+
+// LookupWellKnownMime returns the well-known MIME type of the MIME type name.
+func LookupWellKnownMime(mime string) (WellKnownMime, bool) {
+	id, ok := WellKnownMimeID(mime)
+
+	return WellKnownMime(id), ok
+}
+
+// Known indicates the ID is assigned to a MIME type.
+func (mime WellKnownMime) Known() bool {
+	_, ok := WellKnownMimeTypes[byte(mime)]
+
+	return ok
+}
+
+func (mime WellKnownMime) String() string {
+	if name, ok := WellKnownMimeTypes[byte(mime)]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("WellKnownMime(0x%02X)", byte(mime))
+}
+
+// AppendEntry returns a copy of the composite metadata with the entry appended,
+// the MIME type is encoded as the well-known MIME type ID if possible.
+func (metadata Metadata) AppendEntry(mime string, content []byte) (Metadata, error) {
+	if len(mime) == 0 || len(mime) > MaxMimeLength {
+		return nil, ErrInvalidEntry
+	}
+
+	if id, ok := WellKnownMimeID(mime); ok {
+		return metadata.appendEntry([]byte{WellKnownMimeFlag | id}, content)
+	}
+
+	return metadata.appendEntry(append([]byte{byte(len(mime) - 1)}, mime...), content)
+}
+
+// AppendWellKnownEntry returns a copy of the composite metadata with the entry of well-known MIME type ID appended,
+// the ID may be reserved but not assigned to a MIME type yet.
+func (metadata Metadata) AppendWellKnownEntry(id WellKnownMime, content []byte) (Metadata, error) {
+	if byte(id) > mimeIDMask {
+		return nil, ErrInvalidEntry
+	}
+
+	return metadata.appendEntry([]byte{WellKnownMimeFlag | byte(id)}, content)
+}
+
+// appendEntry returns a copy of the composite metadata with the entry of encoded MIME type appended.
+func (metadata Metadata) appendEntry(mime []byte, content []byte) (Metadata, error) {
+	if len(content) > maxContentLength {
+		return nil, ErrInvalidEntry
+	}
+
+	buf := make([]byte, len(metadata), len(metadata)+len(mime)+uint24Size+len(content))
+
+	copy(buf, metadata)
+
+	buf = append(buf, mime...)
+	buf = append(buf, byte(len(content)>>16), byte(len(content)>>8), byte(len(content)))
+	buf = append(buf, content...)
+
+	return Metadata(buf), nil
+}
+
+// WellKnownMimeID returns the well-known MIME type ID of the MIME type.
+func WellKnownMimeID(mime string) (byte, bool) {
+	for id, wellKnown := range WellKnownMimeTypes {
+		if wellKnown == mime {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// Entry scans the composite metadata for the content of first entry with the well-known MIME type ID,
+// the entries after it are never parsed.
+func (metadata Metadata) Entry(mimeID byte) ([]byte, bool) {
+	return metadata.findEntry(func(id byte, mime string) bool {
+		return mime == "" && id == mimeID
+	})
+}
+
+// StringEntry scans the composite metadata for the content of first entry with the MIME type,
+// which matches both the explicit MIME type and the well-known MIME type ID of it.
+func (metadata Metadata) StringEntry(mime string) ([]byte, bool) {
+	return metadata.findEntry(func(id byte, entryMime string) bool {
+		if entryMime == "" {
+			entryMime = WellKnownMimeTypes[id]
+		}
+
+		return entryMime == mime
+	})
+}
+
+// findEntry scans the entries until one matches the well-known MIME type ID or the explicit MIME type,
+// or returns false if not found or the composite metadata is malformed.
+func (metadata Metadata) findEntry(match func(id byte, mime string) bool) (found []byte, ok bool) {
+	metadata.scanEntries(func(id byte, mime string, content []byte) bool {
+		if match(id, mime) {
+			found, ok = content, true
+		}
+
+		return !ok
+	})
+
+	return
+}
+
+// scanEntries calls the function with each entry until it returns false,
+// the MIME type is empty if encoded as the well-known MIME type ID.
+func (metadata Metadata) scanEntries(fn func(id byte, mime string, content []byte) bool) error {
+	buf := []byte(metadata)
+
+	for len(buf) > 0 {
+		var id byte
+		var mime string
+
+		if buf[0]&WellKnownMimeFlag != 0 {
+			id = buf[0] & mimeIDMask
+			buf = buf[1:]
+		} else {
+			n := int(buf[0]) + 1
+
+			if len(buf) < 1+n {
+				return ErrInvalidCompositeMetadata
+			}
+
+			mime = string(buf[1 : 1+n])
+			buf = buf[1+n:]
+		}
+
+		if len(buf) < uint24Size {
+			return ErrInvalidCompositeMetadata
+		}
+
+		size := int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+		buf = buf[uint24Size:]
+
+		if len(buf) < size {
+			return ErrInvalidCompositeMetadata
+		}
+
+		if !fn(id, mime, buf[:size]) {
+			return nil
+		}
+
+		buf = buf[size:]
+	}
+
+	return nil
+}
+
+// CompositeEntry is an entry of the composite metadata.
+type CompositeEntry struct {
+	MimeType string
+	Content  []byte
+	MimeID   WellKnownMime // The well-known MIME type ID if MimeType is empty, e.g. an ID reserved but unknown.
+}
+
+// CompositeMetadata is the entries of a composite metadata in order.
+type CompositeMetadata []CompositeEntry
+
+// Encode the entries as a composite metadata, the well-known MIME types are encoded with ID.
+func (composite CompositeMetadata) Encode() (metadata Metadata, err error) {
+	for _, entry := range composite {
+		if entry.MimeType == "" {
+			metadata, err = metadata.AppendWellKnownEntry(entry.MimeID, entry.Content)
+		} else {
+			metadata, err = metadata.AppendEntry(entry.MimeType, entry.Content)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// DecodeCompositeMetadata decodes the entries of composite metadata, returns ErrInvalidCompositeMetadata if malformed,
+// the entry with an unknown well-known MIME type ID is passed through with the ID only.
+func DecodeCompositeMetadata(metadata Metadata) (composite CompositeMetadata, err error) {
+	err = metadata.scanEntries(func(id byte, mime string, content []byte) bool {
+		if mime == "" {
+			mime = WellKnownMimeTypes[id]
+		}
+
+		if mime == "" {
+			composite = append(composite, CompositeEntry{"", content, WellKnownMime(id)})
+		} else {
+			composite = append(composite, CompositeEntry{mime, content, 0})
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
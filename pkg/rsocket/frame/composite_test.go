@@ -0,0 +1,171 @@
+package frame
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func compositeEntry(mime interface{}, content []byte) []byte {
+	var buf []byte
+
+	switch mime := mime.(type) {
+	case byte:
+		buf = append(buf, WellKnownMimeFlag|mime)
+	case string:
+		buf = append(buf, byte(len(mime)-1))
+		buf = append(buf, mime...)
+	}
+
+	buf = append(buf, byte(len(content)>>16), byte(len(content)>>8), byte(len(content)))
+
+	return append(buf, content...)
+}
+
+func TestCompositeMetadataEntry(t *testing.T) {
+	Convey("Given a composite metadata with routing and custom entries", t, func() {
+		routing := []byte("\x05hello\x05world")
+
+		var metadata Metadata
+
+		metadata = append(metadata, compositeEntry(byte(0x05), []byte(`{"foo":"bar"}`))...)
+		metadata = append(metadata, compositeEntry(byte(0x7E), routing)...)
+		metadata = append(metadata, compositeEntry("application/x.custom", []byte("custom"))...)
+
+		Convey("When encode the same entries", func() {
+			encoded, err := Metadata(nil).AppendEntry("application/json", []byte(`{"foo":"bar"}`))
+			So(err, ShouldBeNil)
+
+			encoded, err = encoded.AppendEntry("message/x.rsocket.routing.v0", routing)
+			So(err, ShouldBeNil)
+
+			encoded, err = encoded.AppendEntry("application/x.custom", []byte("custom"))
+			So(err, ShouldBeNil)
+
+			Convey("Then the well-known MIME types should be encoded with ID", func() {
+				So(encoded, ShouldResemble, metadata)
+			})
+		})
+
+		Convey("When lookup the routing entry with the well-known MIME type ID", func() {
+			content, ok := metadata.Entry(0x7E)
+
+			Convey("Then the routing tags should be returned", func() {
+				So(ok, ShouldBeTrue)
+				So(content, ShouldResemble, routing)
+			})
+		})
+
+		Convey("When lookup the routing entry with the MIME type", func() {
+			content, ok := metadata.StringEntry("message/x.rsocket.routing.v0")
+
+			Convey("Then the routing tags should be returned", func() {
+				So(ok, ShouldBeTrue)
+				So(content, ShouldResemble, routing)
+			})
+		})
+
+		Convey("When lookup the custom entry with the explicit MIME type", func() {
+			content, ok := metadata.StringEntry("application/x.custom")
+
+			Convey("Then the custom content should be returned", func() {
+				So(ok, ShouldBeTrue)
+				So(content, ShouldResemble, []byte("custom"))
+			})
+		})
+
+		Convey("When lookup an absent entry", func() {
+			_, byID := metadata.Entry(0x7C)
+			_, byMime := metadata.StringEntry("text/plain")
+
+			Convey("Then nothing should be found", func() {
+				So(byID, ShouldBeFalse)
+				So(byMime, ShouldBeFalse)
+			})
+		})
+
+		Convey("When decode all the entries", func() {
+			composite, err := DecodeCompositeMetadata(metadata)
+
+			Convey("Then the entries should be decoded in order with the MIME types", func() {
+				So(err, ShouldBeNil)
+				So(composite, ShouldResemble, CompositeMetadata{
+					{"application/json", []byte(`{"foo":"bar"}`), 0},
+					{"message/x.rsocket.routing.v0", routing, 0},
+					{"application/x.custom", []byte("custom"), 0},
+				})
+
+				Convey("And the entries should be encoded to the same composite metadata", func() {
+					encoded, err := composite.Encode()
+
+					So(err, ShouldBeNil)
+					So(encoded, ShouldResemble, metadata)
+				})
+			})
+		})
+
+		Convey("When the composite metadata is truncated", func() {
+			truncated := metadata[:len(metadata)-1]
+
+			Convey("Then the entries before the truncated one should be found", func() {
+				_, ok := truncated.Entry(0x7E)
+				So(ok, ShouldBeTrue)
+
+				_, ok = truncated.StringEntry("application/x.custom")
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then the decoding should be failed", func() {
+				_, err := DecodeCompositeMetadata(truncated)
+
+				So(err, ShouldEqual, ErrInvalidCompositeMetadata)
+			})
+		})
+
+		Convey("When an entry has an unknown well-known MIME type ID", func() {
+			unknown := append(Metadata(compositeEntry(byte(0x50), []byte("reserved"))), metadata...)
+
+			Convey("Then the entry should be passed through with the ID", func() {
+				composite, err := DecodeCompositeMetadata(unknown)
+
+				So(err, ShouldBeNil)
+				So(composite, ShouldHaveLength, 4)
+				So(composite[0], ShouldResemble, CompositeEntry{"", []byte("reserved"), 0x50})
+
+				Convey("And the entries should be encoded to the same composite metadata", func() {
+					encoded, err := composite.Encode()
+
+					So(err, ShouldBeNil)
+					So(encoded, ShouldResemble, unknown)
+				})
+			})
+		})
+	})
+}
+
+func TestWellKnownMime(t *testing.T) {
+	Convey("Given the well-known MIME types", t, func() {
+		Convey("Then the MIME type should be looked up by name", func() {
+			mime, ok := LookupWellKnownMime("application/json")
+
+			So(ok, ShouldBeTrue)
+			So(mime, ShouldEqual, WellKnownMime(0x05))
+			So(mime.String(), ShouldEqual, "application/json")
+		})
+
+		Convey("Then the MIME type should be looked up by ID", func() {
+			So(WellKnownMime(0x7E).Known(), ShouldBeTrue)
+			So(WellKnownMime(0x7E).String(), ShouldEqual, "message/x.rsocket.routing.v0")
+			So(WellKnownMime(0x29).String(), ShouldEqual, "application/x-capnp")
+			So(WellKnownMime(0x2A).String(), ShouldEqual, "application/x-flatbuffers")
+		})
+
+		Convey("Then the unassigned ID or unknown name should not be found", func() {
+			_, ok := LookupWellKnownMime("application/x.custom")
+
+			So(ok, ShouldBeFalse)
+			So(WellKnownMime(0x50).Known(), ShouldBeFalse)
+			So(WellKnownMime(0x50).String(), ShouldEqual, "WellKnownMime(0x50)")
+		})
+	})
+}
@@ -0,0 +1,29 @@
+package frame
+
+import (
+	"bytes"
+)
+
+// Encode encodes the frame into a single buffer, which allocated once with the size of frame.
+func Encode(frame Frame) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, frame.Size()))
+
+	if _, err := frame.WriteTo(buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes a frame from the buffer encoded by Encode.
+func Decode(buf []byte) (Frame, error) {
+	r := bytes.NewReader(buf)
+
+	header, err := readHeader(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readFrame(r, header)
+}
@@ -0,0 +1,222 @@
+package frame
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncode(t *testing.T) {
+	Convey("Given frames of each type", t, func() {
+		frames := []Frame{
+			NewSetupFrame(V1, true, time.Second, time.Minute, NewToken(), "application/json", "text/plain", true, Metadata("foo"), []byte("bar")),
+			&LeaseFrame{&Header{0, TypeLease, FlagMetadata}, time.Second, 10, Metadata("foo")},
+			NewKeepaliveFrame(true, 123, []byte("ping")),
+			NewRequestResponseFrame(1, false, true, Metadata("foo"), []byte("bar")),
+			NewRequestFireAndForgetFrame(1, false, false, nil, []byte("bar")),
+			NewRequestStreamFrame(1, false, 8, true, Metadata("foo"), []byte("bar")),
+			NewRequestChannelFrame(1, false, false, 8, true, Metadata("foo"), []byte("bar")),
+			NewRequestNFrame(1, 8),
+			NewCancelFrame(1),
+			NewPayloadFrame(1, false, true, true, true, Metadata("foo"), []byte("bar")),
+			NewErrorFrame(1, ErrApplicationError, "failed"),
+			NewMetadataPushFrame(Metadata("foo")),
+			NewResumeFrame(V1, NewToken(), 123, 456),
+			&ResumeOkFrame{&Header{0, TypeResumeOk, 0}, 123},
+			&ExtensionFrame{&Header{1, TypeExtension, FlagIgnore | FlagMetadata}, 0x100, Metadata("foo"), []byte("ext")},
+		}
+
+		Convey("When encode the frames", func() {
+			for _, f := range frames {
+				buf, err := Encode(f)
+
+				So(err, ShouldBeNil)
+
+				Convey("Then the encoded "+f.Type().String()+" frame should be the same as wrote", func() {
+					var wrote bytes.Buffer
+
+					n, err := f.WriteTo(&wrote)
+
+					So(err, ShouldBeNil)
+					So(buf, ShouldResemble, wrote.Bytes())
+					So(n, ShouldEqual, f.Size())
+					So(len(buf), ShouldEqual, f.Size())
+				})
+			}
+		})
+	})
+}
+
+func TestDecode(t *testing.T) {
+	Convey("Given an encoded frame", t, func() {
+		buf, err := Encode(NewPayloadFrame(1, false, true, true, true, Metadata("foo"), []byte("bar")))
+
+		So(err, ShouldBeNil)
+
+		Convey("When decode the buffer", func() {
+			f, err := Decode(buf)
+
+			Convey("Then the frame should be reconstructed", func() {
+				So(err, ShouldBeNil)
+				So(f.Type(), ShouldEqual, TypePayload)
+				So(f.StreamID(), ShouldEqual, StreamID(1))
+				So(f.(*PayloadFrame).Metadata, ShouldResemble, Metadata("foo"))
+				So(f.(*PayloadFrame).Data, ShouldResemble, []byte("bar"))
+			})
+		})
+
+		Convey("When decode a truncated buffer", func() {
+			_, err := Decode(buf[:3])
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDecodeRequestChannelFrame(t *testing.T) {
+	Convey("Given REQUEST_CHANNEL frames with an initial payload", t, func() {
+		cases := []struct {
+			name     string
+			complete bool
+		}{
+			{"in progress", false},
+			{"completed", true},
+		}
+
+		for _, c := range cases {
+			buf, err := Encode(NewRequestChannelFrame(3, false, c.complete, 8, true, Metadata("foo"), []byte("bar")))
+			So(err, ShouldBeNil)
+
+			Convey("When decode the "+c.name+" frame", func() {
+				f, err := Decode(buf)
+				So(err, ShouldBeNil)
+
+				Convey("Then the initial payload and requests should be reconstructed", func() {
+					request, ok := f.(*RequestChannelFrame)
+
+					So(ok, ShouldBeTrue)
+					So(request.StreamID(), ShouldEqual, StreamID(3))
+					So(request.InitialRequests, ShouldEqual, 8)
+					So(request.HasMetadata(), ShouldBeTrue)
+					So(request.Metadata, ShouldResemble, Metadata("foo"))
+					So(request.Data, ShouldResemble, []byte("bar"))
+					So(request.Follows(), ShouldBeFalse)
+					So(request.Complete(), ShouldEqual, c.complete)
+				})
+			})
+		}
+	})
+}
+
+func TestDecodeExtensionFrame(t *testing.T) {
+	Convey("Given an EXT frame with an extended type, metadata and data", t, func() {
+		buf, err := Encode(NewExtensionFrame(5, 0xCAFE, true, Metadata("foo"), []byte("bar")))
+		So(err, ShouldBeNil)
+
+		Convey("When decode the frame", func() {
+			f, err := Decode(buf)
+			So(err, ShouldBeNil)
+
+			Convey("Then the extended type, metadata and data should be reconstructed", func() {
+				ext, ok := f.(*ExtensionFrame)
+
+				So(ok, ShouldBeTrue)
+				So(ext.StreamID(), ShouldEqual, StreamID(5))
+				So(ext.Flags(), ShouldEqual, FlagMetadata)
+				So(ext.ExtendedType, ShouldEqual, 0xCAFE)
+				So(ext.Metadata, ShouldResemble, Metadata("foo"))
+				So(ext.Data, ShouldResemble, []byte("bar"))
+			})
+		})
+	})
+
+	Convey("Given an EXT frame without metadata", t, func() {
+		buf, err := Encode(NewExtensionFrame(5, 0xCAFE, false, nil, []byte("bar")))
+		So(err, ShouldBeNil)
+
+		Convey("When decode the frame", func() {
+			f, err := Decode(buf)
+			So(err, ShouldBeNil)
+
+			Convey("Then the data should not be taken as metadata", func() {
+				ext := f.(*ExtensionFrame)
+
+				So(ext.HasMetadata(), ShouldBeFalse)
+				So(ext.Metadata, ShouldBeNil)
+				So(ext.Data, ShouldResemble, []byte("bar"))
+			})
+		})
+	})
+}
+
+func TestFrameSizes(t *testing.T) {
+	Convey("Given the frames with fixed fields only", t, func() {
+		Convey("Then the header size should be the exported constant", func() {
+			So(NewCancelFrame(1).Header.Size(), ShouldEqual, HeaderSize)
+			So(NewCancelFrame(1).Size(), ShouldEqual, HeaderSize)
+		})
+
+		Convey("Then the frame sizes should be the sum of fixed fields", func() {
+			So(NewKeepaliveFrame(true, 123, nil).Size(), ShouldEqual, HeaderSize+LastReceivedSize)
+			So(NewRequestNFrame(1, 8).Size(), ShouldEqual, HeaderSize+RequestNSize)
+			So(NewRequestStreamFrame(1, false, 8, false, nil, nil).Size(), ShouldEqual, HeaderSize+InitialRequestsSize)
+			So(NewErrorFrame(1, ErrApplicationError, "").Size(), ShouldEqual, HeaderSize+ErrorCodeSize)
+			So(NewLeaseFrame(time.Second, 10, nil).Size(), ShouldEqual, HeaderSize+TimeToLiveSize+NumberOfRequestsSize)
+		})
+
+		Convey("Then the encoded size should match the frame size", func() {
+			buf, err := Encode(NewRequestNFrame(1, 8))
+
+			So(err, ShouldBeNil)
+			So(len(buf), ShouldEqual, HeaderSize+RequestNSize)
+		})
+	})
+}
+
+func TestErrorFrameWithoutMessage(t *testing.T) {
+	Convey("Given an ERROR frame without message", t, func() {
+		f := NewErrorFrame(1, ErrRejected, "")
+
+		Convey("When decode the encoded frame", func() {
+			decoded, err := decodeFrame(f)
+
+			So(err, ShouldBeNil)
+
+			Convey("Then the message should be empty", func() {
+				errorFrame := decoded.(*ErrorFrame)
+
+				So(errorFrame.Code, ShouldEqual, ErrRejected)
+				So(errorFrame.Data, ShouldBeEmpty)
+
+				Convey("And the formatted error should be clean", func() {
+					So(errorFrame.Err().Error(), ShouldEqual, "ERROR[REJECTED]")
+					So(ErrRejected.WithMessage("for test").Error(), ShouldEqual, "ERROR[REJECTED] for test")
+				})
+			})
+		})
+	})
+}
+
+func TestErrorCodeClassification(t *testing.T) {
+	Convey("Given the error codes defined by the protocol", t, func() {
+		Convey("Then the codes on stream 0 should terminate the connection", func() {
+			for _, code := range []ErrorCode{
+				ErrInvalidSetup, ErrUnsupportedSetup, ErrRejectedSetup, ErrRejectedResume, ErrConnectionError, ErrConnectionClose,
+			} {
+				So(code.IsConnectionError(), ShouldBeTrue)
+				So(code.WithMessage("for test").IsConnectionError(), ShouldBeTrue)
+			}
+		})
+
+		Convey("Then the codes on a stream should only terminate the stream", func() {
+			for _, code := range []ErrorCode{ErrReserved, ErrApplicationError, ErrRejected, ErrCanceled, ErrInvalid, ErrExtension} {
+				So(code.IsConnectionError(), ShouldBeFalse)
+				So(code.WithMessage("for test").IsConnectionError(), ShouldBeFalse)
+			}
+		})
+	})
+}
@@ -2,12 +2,14 @@ package frame
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 )
 
-const errorCodeSize = uint32Size
+// ErrorCodeSize is the size of error code in ERROR frame.
+const ErrorCodeSize = uint32Size
 
 // ErrorCode is the type of Error.
 type ErrorCode uint32
@@ -36,6 +38,11 @@ const (
 	// Sender or Receiver of this frame MAY close the connection immediately
 	// without waiting for outstanding streams to terminate.
 	ErrConnectionError ErrorCode = 0x00000101
+	// ErrConnectionClose indicates the connection is being terminated.
+	// Stream ID MUST be 0.
+	// Sender or Receiver of this frame MUST wait for outstanding streams to terminate before closing the connection.
+	// New requests MAY not be accepted.
+	ErrConnectionClose ErrorCode = 0x00000102
 	// ErrApplicationError indicates application layer logic generating error.
 	// Stream ID MUST be non-0.
 	ErrApplicationError ErrorCode = 0x00000201
@@ -70,6 +77,8 @@ func (code ErrorCode) Error() string {
 		return "REJECTED_RESUME"
 	case ErrConnectionError:
 		return "CONNECTION_ERROR"
+	case ErrConnectionClose:
+		return "CONNECTION_CLOSE"
 	case ErrApplicationError:
 		return "APPLICATION_ERROR"
 	case ErrRejected:
@@ -90,6 +99,16 @@ func (code ErrorCode) WithMessage(msg string) *Error {
 	return &Error{Code: code, Data: msg}
 }
 
+// IsConnectionError reports whether the error code terminates the whole connection rather than a stream.
+func (code ErrorCode) IsConnectionError() bool {
+	switch code {
+	case ErrInvalidSetup, ErrUnsupportedSetup, ErrRejectedSetup, ErrRejectedResume, ErrConnectionError, ErrConnectionClose:
+		return true
+	default:
+		return false
+	}
+}
+
 // ErrorFrame reports error at connection or application level.
 type ErrorFrame struct {
 	*Header
@@ -131,9 +150,23 @@ type Error struct {
 }
 
 func (err *Error) Error() string {
+	if len(err.Data) == 0 {
+		return fmt.Sprintf("ERROR[%s]", err.Code)
+	}
+
 	return fmt.Sprintf("ERROR[%s] %s", err.Code, err.Data)
 }
 
+// IsConnectionError reports whether the error terminates the whole connection rather than a stream.
+func (err *Error) IsConnectionError() bool {
+	return err.Code.IsConnectionError()
+}
+
+// DecodeJSON decodes the data of error as JSON into v.
+func (err *Error) DecodeJSON(v interface{}) error {
+	return json.Unmarshal([]byte(err.Data), v)
+}
+
 // Err returns the formated error
 func (frame *ErrorFrame) Err() error {
 	return frame.Error
@@ -145,7 +178,7 @@ func (frame *ErrorFrame) String() string {
 
 // Size returns the encoded size of the frame.
 func (frame *ErrorFrame) Size() int {
-	return frame.Header.Size() + errorCodeSize + len(frame.Data)
+	return frame.Header.Size() + ErrorCodeSize + len(frame.Data)
 }
 
 // WriteTo writes the encoded frame to w.
@@ -162,7 +195,7 @@ func (frame *ErrorFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += errorCodeSize
+	wrote += ErrorCodeSize
 
 	if n, err = writeExact(w, []byte(frame.Data)); err != nil {
 		return
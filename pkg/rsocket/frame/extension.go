@@ -6,22 +6,45 @@ import (
 	"io/ioutil"
 )
 
-const extTypeSize = uint32Size
+// ExtTypeSize is the size of extended type in EXT frame.
+const ExtTypeSize = uint32Size
 
 // ExtensionFrame used to extend more frame types as well as extensions.
 type ExtensionFrame struct {
 	*Header
 	ExtendedType uint32
+	Metadata     Metadata
 	Data         []byte
 }
 
+// NewExtensionFrame creates an ExtensionFrame.
+func NewExtensionFrame(streamID StreamID, extendedType uint32, hasMetadata bool, metadata Metadata, data []byte) *ExtensionFrame {
+	var flags Flags
+
+	if hasMetadata {
+		flags.Set(FlagMetadata)
+	}
+
+	return &ExtensionFrame{
+		&Header{streamID, TypeExtension, flags},
+		extendedType,
+		metadata,
+		data,
+	}
+}
+
 func readExtensionFrame(r io.Reader, header *Header) (frame *ExtensionFrame, err error) {
 	var extType uint32
-	var data []byte
+	var metadata, data []byte
 
 	if err = binary.Read(r, binary.BigEndian, &extType); err != nil {
 		return
 	}
+	if header.HasMetadata() {
+		if metadata, err = readMetadata(r); err != nil {
+			return
+		}
+	}
 	if data, err = ioutil.ReadAll(r); err != nil {
 		return
 	}
@@ -29,6 +52,7 @@ func readExtensionFrame(r io.Reader, header *Header) (frame *ExtensionFrame, err
 	frame = &ExtensionFrame{
 		header,
 		extType,
+		metadata,
 		data,
 	}
 
@@ -37,7 +61,7 @@ func readExtensionFrame(r io.Reader, header *Header) (frame *ExtensionFrame, err
 
 // Size returns the encoded size of the frame.
 func (ext *ExtensionFrame) Size() int {
-	return ext.Header.Size() + extTypeSize + len(ext.Data)
+	return ext.Header.Size() + ExtTypeSize + ext.Metadata.Size() + len(ext.Data)
 }
 
 // WriteTo writes the encoded frame to w.
@@ -54,6 +78,14 @@ func (ext *ExtensionFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 
 	wrote += uint32Size
 
+	if ext.HasMetadata() {
+		if n, err = ext.Metadata.WriteTo(w); err != nil {
+			return
+		}
+
+		wrote += n
+	}
+
 	if n, err = writeExact(w, ext.Data); err != nil {
 		return
 	}
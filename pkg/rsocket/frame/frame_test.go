@@ -0,0 +1,21 @@
+package frame
+
+import (
+	"bytes"
+)
+
+func decodeFrame(f Frame) (Frame, error) {
+	var buf bytes.Buffer
+
+	if _, err := f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	header, err := readHeader(&buf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readFrame(&buf, header)
+}
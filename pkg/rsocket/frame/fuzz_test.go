@@ -0,0 +1,66 @@
+package frame
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func FuzzReadFrame(f *testing.F) {
+	for _, frame := range []Frame{
+		NewSetupFrame(V1, true, time.Second, time.Minute, NewToken(), "application/json", "text/plain", true, Metadata("foo"), []byte("bar")),
+		NewLeaseFrame(time.Second, 10, Metadata("foo")),
+		NewKeepaliveFrame(true, 123, []byte("ping")),
+		NewRequestResponseFrame(1, false, true, Metadata("foo"), []byte("bar")),
+		NewRequestStreamFrame(1, false, 8, true, Metadata("foo"), []byte("bar")),
+		NewRequestChannelFrame(1, false, false, 8, true, Metadata("foo"), []byte("bar")),
+		NewRequestNFrame(1, 8),
+		NewPayloadFrame(1, false, true, true, true, Metadata("foo"), []byte("bar")),
+		NewErrorFrame(1, ErrApplicationError, "failed"),
+		NewMetadataPushFrame(Metadata("foo")),
+		NewResumeFrame(V1, NewToken(), 123, 456),
+	} {
+		var buf bytes.Buffer
+
+		if _, err := NewWriter(zap.NewNop(), &buf).WriteFrame(frame); err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		if frame, err := NewReader(zap.NewNop(), bytes.NewReader(buf)).ReadFrame(); err == nil {
+			checkDecodedSize(t, frame, len(buf))
+		}
+
+		if frame, err := Decode(buf); err == nil {
+			checkDecodedSize(t, frame, len(buf))
+		}
+	})
+}
+
+// checkDecodedSize checks the fields of a frame never exceed the bytes decoded.
+func checkDecodedSize(t *testing.T, frame Frame, n int) {
+	if size := frame.Size(); size > n {
+		t.Fatalf("%s frame of %d bytes decoded from %d bytes", frame.Type(), size, n)
+	}
+}
+
+func TestDecodeTruncatedMetadata(t *testing.T) {
+	Convey("Given a PAYLOAD frame claims metadata larger than the buffer", t, func() {
+		buf, err := Encode(NewPayloadFrame(1, false, false, true, true, Metadata("foo"), nil))
+		So(err, ShouldBeNil)
+
+		buf[HeaderSize], buf[HeaderSize+1], buf[HeaderSize+2] = 0xFF, 0xFF, 0xFF
+
+		Convey("Then the frame should be rejected as incomplete", func() {
+			_, err := Decode(buf)
+
+			So(err, ShouldEqual, ErrIncomplete)
+		})
+	})
+}
@@ -20,9 +20,14 @@ type Header struct {
 	flags     Flags
 }
 
-const headerSize = streamIDSize + frameFlagSize
-const streamIDSize = uint32Size
-const frameFlagSize = uint16Size
+// HeaderSize is the size of frame header.
+const HeaderSize = StreamIDSize + FlagsSize
+
+// StreamIDSize is the size of stream ID in frame header.
+const StreamIDSize = uint32Size
+
+// FlagsSize is the size of frame type and flags in frame header.
+const FlagsSize = uint16Size
 const frameTypeShift = 10
 
 func readHeader(r io.Reader) (header *Header, err error) {
@@ -106,7 +111,7 @@ func (header *Header) String() string {
 
 // Size returns the encoded size of the header.
 func (header *Header) Size() int {
-	return headerSize
+	return HeaderSize
 }
 
 // WriteTo writes the header to w.
@@ -121,5 +126,5 @@ func (header *Header) WriteTo(w io.Writer) (int64, error) {
 		return 0, err
 	}
 
-	return headerSize, nil
+	return HeaderSize, nil
 }
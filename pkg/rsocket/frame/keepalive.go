@@ -9,7 +9,8 @@ import (
 // Position in the stream.
 type Position uint64
 
-const lastReceivedSize = uint64Size
+// LastReceivedSize is the size of last received position in KEEPALIVE and RESUME frames.
+const LastReceivedSize = uint64Size
 
 // KeepaliveFrame used to make connection keepalive.
 type KeepaliveFrame struct {
@@ -56,7 +57,7 @@ func readKeepaliveFrame(r io.Reader, header *Header) (frame *KeepaliveFrame, err
 
 // Size returns the encoded size of the frame.
 func (frame *KeepaliveFrame) Size() int {
-	return frame.Header.Size() + keepaliveSize + len(frame.Data)
+	return frame.Header.Size() + LastReceivedSize + len(frame.Data)
 }
 
 // WriteTo writes the encoded frame to w.
@@ -73,7 +74,7 @@ func (frame *KeepaliveFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += errorCodeSize
+	wrote += LastReceivedSize
 
 	if n, err = writeExact(w, []byte(frame.Data)); err != nil {
 		return
@@ -4,11 +4,26 @@ import (
 	"encoding/binary"
 	"io"
 	"io/ioutil"
+	"math"
 	"time"
 )
 
-const timeToLiveSize = uint32Size
-const numberOfRequestsSize = uint32Size
+// TimeToLiveSize is the size of time-to-live in LEASE frame.
+const TimeToLiveSize = uint32Size
+
+// NumberOfRequestsSize is the size of number of requests in LEASE frame.
+const NumberOfRequestsSize = uint32Size
+
+// MaxTimeToLive is the maximum time-to-live of a lease, which is encoded as milliseconds in uint32.
+const MaxTimeToLive = math.MaxUint32 * time.Millisecond
+
+// ErrInvalidLease is returned when encode or decode a LEASE frame with the time-to-live out of range.
+var ErrInvalidLease = ErrConnectionError.WithMessage("invalid lease")
+
+// ValidTimeToLive indicates the time-to-live is positive in milliseconds and fits in the LEASE frame.
+func ValidTimeToLive(ttl time.Duration) bool {
+	return ttl >= time.Millisecond && ttl <= MaxTimeToLive
+}
 
 // LeaseFrame sent by Responder to grant the ability to send requests.
 type LeaseFrame struct {
@@ -18,6 +33,22 @@ type LeaseFrame struct {
 	Metadata         Metadata
 }
 
+// NewLeaseFrame creates a LeaseFrame.
+func NewLeaseFrame(ttl time.Duration, numOfReqs uint32, metadata Metadata) *LeaseFrame {
+	var flags Flags
+
+	if metadata != nil {
+		flags.Set(FlagMetadata)
+	}
+
+	return &LeaseFrame{
+		&Header{0, TypeLease, flags},
+		ttl,
+		numOfReqs,
+		metadata,
+	}
+}
+
 func readLeaseFrame(r io.Reader, header *Header) (frame *LeaseFrame, err error) {
 	var ttl, numOfReqs uint32
 	var metadata Metadata
@@ -28,6 +59,9 @@ func readLeaseFrame(r io.Reader, header *Header) (frame *LeaseFrame, err error)
 	if err = binary.Read(r, binary.BigEndian, &numOfReqs); err != nil {
 		return
 	}
+	if ttl == 0 {
+		return nil, ErrInvalidLease
+	}
 	if header.HasMetadata() {
 		if metadata, err = ioutil.ReadAll(r); err != nil {
 			return
@@ -46,13 +80,19 @@ func readLeaseFrame(r io.Reader, header *Header) (frame *LeaseFrame, err error)
 
 // Size returns the encoded size of the frame.
 func (lease *LeaseFrame) Size() int {
-	return lease.Header.Size() + timeToLiveSize + numberOfRequestsSize + len(lease.Metadata)
+	return lease.Header.Size() + TimeToLiveSize + NumberOfRequestsSize + len(lease.Metadata)
 }
 
 // WriteTo writes the encoded frame to w.
+//
+// The frame is rejected with ErrInvalidLease before written if the time-to-live is out of range.
 func (lease *LeaseFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 	var n int64
 
+	if !ValidTimeToLive(lease.TimeToLive) {
+		return 0, ErrInvalidLease
+	}
+
 	if n, err = lease.Header.WriteTo(w); err != nil {
 		return
 	}
@@ -66,10 +106,10 @@ func (lease *LeaseFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += timeToLiveSize + numberOfRequestsSize
+	wrote += TimeToLiveSize + NumberOfRequestsSize
 
 	if lease.HasMetadata() {
-		if n, err = lease.Metadata.WriteTo(w); err != nil {
+		if n, err = writeExact(w, []byte(lease.Metadata)); err != nil {
 			return
 		}
 
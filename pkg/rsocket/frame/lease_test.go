@@ -0,0 +1,98 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLeaseFrameRoundTrip(t *testing.T) {
+	Convey("Given LEASE frames with the typical and boundary values", t, func() {
+		cases := []struct {
+			name     string
+			ttl      time.Duration
+			requests uint32
+			metadata Metadata
+		}{
+			{"typical", 30 * time.Second, 100, Metadata("foo")},
+			{"minimum", time.Millisecond, 0, nil},
+			{"maximum", MaxTimeToLive, math.MaxUint32, nil},
+		}
+
+		for _, c := range cases {
+			lease := NewLeaseFrame(c.ttl, c.requests, c.metadata)
+
+			Convey("When decode the encoded "+c.name+" frame", func() {
+				f, err := decodeFrame(lease)
+				So(err, ShouldBeNil)
+
+				Convey("Then the frame should be reconstructed", func() {
+					So(f, ShouldResemble, lease)
+				})
+			})
+		}
+	})
+
+	Convey("Given a LEASE frame encoded", t, func() {
+		var buf bytes.Buffer
+
+		_, err := NewLeaseFrame(1500*time.Millisecond, 0x01020304, nil).WriteTo(&buf)
+		So(err, ShouldBeNil)
+
+		Convey("Then the time-to-live and number of requests should be encoded as uint32 in big-endian", func() {
+			body := buf.Bytes()[HeaderSize:]
+
+			So(body, ShouldHaveLength, TimeToLiveSize+NumberOfRequestsSize)
+			So(binary.BigEndian.Uint32(body), ShouldEqual, 1500)
+			So(body[TimeToLiveSize:], ShouldResemble, []byte{0x01, 0x02, 0x03, 0x04})
+		})
+	})
+}
+
+func TestLeaseFrameWithInvalidTimeToLive(t *testing.T) {
+	Convey("Given LEASE frames with the time-to-live out of range", t, func() {
+		cases := []struct {
+			name string
+			ttl  time.Duration
+		}{
+			{"zero", 0},
+			{"sub-millisecond", time.Microsecond},
+			{"overflow", MaxTimeToLive + time.Millisecond},
+		}
+
+		for _, c := range cases {
+			Convey("When encode the "+c.name+" time-to-live", func() {
+				var buf bytes.Buffer
+
+				_, err := NewLeaseFrame(c.ttl, 10, nil).WriteTo(&buf)
+
+				Convey("Then it should be rejected before written", func() {
+					So(err, ShouldEqual, ErrInvalidLease)
+					So(buf.Len(), ShouldEqual, 0)
+				})
+			})
+		}
+
+		Convey("When decode a LEASE frame with zero time-to-live", func() {
+			var buf bytes.Buffer
+
+			_, err := (&Header{0, TypeLease, 0}).WriteTo(&buf)
+			So(err, ShouldBeNil)
+
+			buf.Write([]byte{0, 0, 0, 0, 0, 0, 0, 10})
+
+			header, err := readHeader(&buf)
+			So(err, ShouldBeNil)
+
+			_, err = readFrame(&buf, header)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrInvalidLease)
+			})
+		})
+	})
+}
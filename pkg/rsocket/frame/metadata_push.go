@@ -47,7 +47,7 @@ func (frame *MetadataPushFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 
 	var n int64
 
-	if n, err = frame.Metadata.WriteTo(w); err != nil {
+	if n, err = writeExact(w, []byte(frame.Metadata)); err != nil {
 		return
 	}
 
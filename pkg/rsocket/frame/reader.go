@@ -5,94 +5,317 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"io"
+	"io/ioutil"
 
 	"go.uber.org/zap"
 )
 
-const frameLengthSize = uint24Size
+// FrameLengthSize is the size of frame length prefixed on the stream transports.
+const FrameLengthSize = uint24Size
+
+// MaxFrameSize is the maximum size of a frame, which is limited by the 24-bit frame length.
+const MaxFrameSize = 1<<(FrameLengthSize*8) - 1
 
 // ReadFrameDumper dumps read frame
 var ReadFrameDumper io.Writer
 
+// ErrMetadataTooLarge is returned when read a frame with metadata exceeds the limit.
+var ErrMetadataTooLarge = ErrConnectionError.WithMessage("metadata too large")
+
+// ErrSetupTooLarge is returned when read a SETUP frame with metadata or data exceeds the limit.
+var ErrSetupTooLarge = ErrRejectedSetup.WithMessage("setup too large")
+
+// SetupLimit guards the size of metadata and data in the SETUP frame.
+type SetupLimit struct {
+	MaxMetadataSize int // The maximum size of metadata, or 0 if unlimited.
+	MaxDataSize     int // The maximum size of data, or 0 if unlimited.
+}
+
+func (limit *SetupLimit) metadataExceeded(size int) bool {
+	return limit != nil && limit.MaxMetadataSize > 0 && size > limit.MaxMetadataSize
+}
+
+func (limit *SetupLimit) dataExceeded(data []byte) bool {
+	return limit != nil && limit.MaxDataSize > 0 && len(data) > limit.MaxDataSize
+}
+
+// dataReader reads the data of SETUP frame up to one byte over the limit, which is enough to detect the excess.
+func (limit *SetupLimit) dataReader(r io.Reader) io.Reader {
+	if limit == nil || limit.MaxDataSize <= 0 {
+		return r
+	}
+
+	return io.LimitReader(r, int64(limit.MaxDataSize)+1)
+}
+
+// MetadataLimit guards the size of metadata in a frame.
+type MetadataLimit struct {
+	MaxSize  int     // The maximum size of metadata, or 0 if unlimited.
+	MaxRatio float64 // The maximum ratio of metadata to the frame, or 0 if unlimited.
+}
+
+// Check the metadata of frame in the limit.
+func (limit *MetadataLimit) Check(frame Frame) error {
+	metadata, ok := metadataOf(frame)
+
+	if !ok {
+		return nil
+	}
+
+	return limit.checkSize(frame.Type(), len(metadata), frame.Size())
+}
+
+// checkSize checks the size of metadata in the limit, the frame size includes the header.
+func (limit *MetadataLimit) checkSize(frameType Type, metadataSize, frameSize int) error {
+	if limit.MaxSize > 0 && metadataSize > limit.MaxSize {
+		return ErrMetadataTooLarge
+	}
+
+	// METADATA_PUSH frame only contains metadata
+	if limit.MaxRatio > 0 && frameType != TypeMetadataPush && float64(metadataSize) > limit.MaxRatio*float64(frameSize) {
+		return ErrMetadataTooLarge
+	}
+
+	return nil
+}
+
+// readMetadataSize reads the fields ahead of the metadata in the frame body,
+// returns the fields read and the size of metadata declared, or -1 if unknown until the frame decoded.
+func readMetadataSize(r io.Reader, header *Header, bodySize int) ([]byte, int, error) {
+	var offset int
+
+	switch header.Type() {
+	case TypeMetadataPush:
+		return nil, bodySize, nil
+
+	case TypeLease:
+		if !header.HasMetadata() || bodySize < TimeToLiveSize+NumberOfRequestsSize {
+			return nil, -1, nil
+		}
+
+		return nil, bodySize - TimeToLiveSize - NumberOfRequestsSize, nil
+
+	case TypeRequestResponse, TypeRequestFireAndForget, TypePayload:
+		offset = 0
+
+	case TypeRequestStream, TypeRequestChannel:
+		offset = RequestNSize
+
+	default:
+		return nil, -1, nil
+	}
+
+	if !header.HasMetadata() || bodySize < offset+uint24Size {
+		return nil, -1, nil
+	}
+
+	prefix, err := readExact(r, offset+uint24Size)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return prefix, int(prefix[offset])<<16 | int(prefix[offset+1])<<8 | int(prefix[offset+2]), nil
+}
+
+func metadataOf(frame Frame) (Metadata, bool) {
+	switch frame := frame.(type) {
+	case *SetupFrame:
+		return frame.Metadata, true
+	case *LeaseFrame:
+		return frame.Metadata, true
+	case *RequestResponseFrame:
+		return frame.Metadata, true
+	case *RequestFireAndForgetFrame:
+		return frame.Metadata, true
+	case *RequestStreamFrame:
+		return frame.Metadata, true
+	case *RequestChannelFrame:
+		return frame.Metadata, true
+	case *PayloadFrame:
+		return frame.Metadata, true
+	case *MetadataPushFrame:
+		return frame.Metadata, true
+	default:
+		return nil, false
+	}
+}
+
 // Reader implements convenience methods for reading frames from a RSocket connection.
 type Reader struct {
 	*zap.Logger
 	io.Reader
-	buf *bytes.Buffer
+	MetadataLimit *MetadataLimit // Rejects the frame with metadata exceeds the limit before it buffered if not nil.
+	Allocator     Allocator      // Allocates the buffer of frames read, or allocates from heap if nil, see Release.
+	SetupLimit    *SetupLimit    // Rejects the SETUP frame exceeds the limit before it buffered if not nil.
 }
 
 // NewReader returns a new Reader reading from r.
 func NewReader(logger *zap.Logger, r io.Reader) *Reader {
-	return &Reader{logger.Named("r"), r, nil}
+	return &Reader{logger.Named("r"), r, nil, nil, nil}
+}
+
+// readBody reads the frame body of size following the prefix read ahead, and returns a function releases the buffer.
+//
+// The frame body is skipped if the allocator refuses to allocate the buffer,
+// so the next frame still can be read.
+func (r *Reader) readBody(prefix []byte, size int) ([]byte, func(), error) {
+	var buf []byte
+	var err error
+
+	release := func() {}
+
+	if r.Allocator == nil {
+		if body, ok := r.Reader.(remaining); ok && body.Len() < size-len(prefix) {
+			return nil, nil, ErrIncomplete
+		}
+
+		buf = make([]byte, size)
+	} else {
+		if buf, err = r.Allocator.Allocate(size); err != nil {
+			if _, skipErr := io.CopyN(ioutil.Discard, r.Reader, int64(size-len(prefix))); skipErr != nil {
+				return nil, nil, skipErr
+			}
+
+			return nil, nil, err
+		}
+
+		release = func() { r.Allocator.Release(buf) }
+	}
+
+	copy(buf, prefix)
+
+	if _, err = io.ReadFull(r.Reader, buf[len(prefix):]); err != nil {
+		release()
+
+		return nil, nil, err
+	}
+
+	return buf, release, nil
 }
 
 // ReadFrame reads a frame from a RSocket connection.
 func (r *Reader) ReadFrame() (frame Frame, err error) {
 	for {
-		if r.buf == nil {
-			r.buf = bytes.NewBuffer(make([]byte, 0, frameLengthSize))
+		var size uint32
+		var buf, prefix []byte
+		var release func()
+		var header *Header
+
+		if size, err = readUInt24(r.Reader, binary.BigEndian); err != nil {
+			return
 		}
 
-		if r.buf.Len() < r.buf.Cap() {
-			buf := make([]byte, r.buf.Cap()-r.buf.Len())
+		if r.SetupLimit != nil || r.MetadataLimit != nil {
+			// The header is read ahead, so the frame exceeds the limit is rejected before it buffered.
+			limited := io.LimitReader(r.Reader, int64(size))
+
+			if header, err = readHeader(limited); err != nil {
+				return
+			}
 
-			var n int
+			if header.Type() == TypeSetup && r.SetupLimit != nil {
+				return r.readLimitedSetupFrame(limited, header)
+			}
 
-			n, err = r.Reader.Read(buf)
+			size -= HeaderSize
 
-			if err != nil {
-				return
+			if r.MetadataLimit != nil {
+				if prefix, err = r.checkMetadataSize(limited, header, int(size)); err != nil {
+					return
+				}
 			}
+		}
+
+		if buf, release, err = r.readBody(prefix, int(size)); err != nil {
+			return
+		}
+
+		body := bytes.NewBuffer(buf)
 
-			n, err = r.buf.Write(buf[:n])
+		if header == nil {
+			if header, err = readHeader(body); err != nil {
+				release()
 
-			if err != nil {
 				return
 			}
+		}
 
-			if n < len(buf) {
-				continue
-			}
+		r.Debug("read frame",
+			zap.Stringer("type", header.Type()),
+			zap.Binary("data", buf))
+
+		if ReadFrameDumper != nil {
+			hex.Dumper(ReadFrameDumper).Write(buf)
+
+			ReadFrameDumper.Write([]byte("\n"))
 		}
 
-		if r.buf.Cap() == frameLengthSize {
-			var len uint32
+		frame, err = readFrame(body, header)
 
-			len, err = readUInt24(r.buf, binary.BigEndian)
+		if err == ErrUnknownFrameType && header.CanIgnore() {
+			release()
 
-			if err != nil {
-				return
+			continue
+		}
+
+		if err == nil && r.MetadataLimit != nil {
+			if err = r.MetadataLimit.Check(frame); err != nil {
+				frame = nil
 			}
+		}
 
-			r.buf.Grow(int(len))
+		if err == nil && header.Type() == TypePayload && r.Allocator != nil {
+			// The buffer is held until the payload consumed, so the Allocator bounds the payloads buffered.
+			releases.Store(frame, release)
 		} else {
-			var header *Header
+			release()
+		}
 
-			header, err = readHeader(r.Reader)
+		return
+	}
+}
 
-			if err != nil {
-				return
-			}
+// checkMetadataSize checks the size of metadata declared before the frame body buffered,
+// and skips the rest of frame if rejected, so the following frames still can be read.
+func (r *Reader) checkMetadataSize(body io.Reader, header *Header, bodySize int) ([]byte, error) {
+	prefix, metadataSize, err := readMetadataSize(body, header, bodySize)
 
-			r.Debug("read frame",
-				zap.Stringer("type", header.Type()),
-				zap.Binary("data", r.buf.Bytes()))
+	if err != nil || metadataSize < 0 {
+		return prefix, err
+	}
 
-			if ReadFrameDumper != nil {
-				hex.Dumper(ReadFrameDumper).Write(r.buf.Bytes())
+	if err = r.MetadataLimit.checkSize(header.Type(), metadataSize, HeaderSize+bodySize); err != nil {
+		r.Warn("reject frame with metadata exceeds the limit", zap.Stringer("type", header.Type()))
 
-				WriteFrameDumper.Write([]byte("\n"))
-			}
+		if _, skipErr := io.Copy(ioutil.Discard, body); skipErr != nil {
+			return nil, skipErr
+		}
 
-			frame, err = readFrame(r.buf, header)
+		return nil, err
+	}
 
-			r.buf = nil
+	return prefix, nil
+}
 
-			if err == ErrUnknownFrameType && header.CanIgnore() {
-				continue
-			}
+// readLimitedSetupFrame reads the SETUP frame in the limit,
+// and skips the rest of frame if rejected, so the following frames still can be read.
+func (r *Reader) readLimitedSetupFrame(body io.Reader, header *Header) (Frame, error) {
+	frame, err := readSetupFrameWithLimit(body, header, r.SetupLimit)
 
-			return
+	if err == ErrSetupTooLarge {
+		r.Warn("reject SETUP frame exceeds the limit")
+
+		if _, skipErr := io.Copy(ioutil.Discard, body); skipErr != nil {
+			return nil, skipErr
 		}
+
+		return nil, err
 	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return frame, nil
 }
@@ -0,0 +1,294 @@
+package frame
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func TestReadFrameWithMetadataLimit(t *testing.T) {
+	Convey("Given frames wrote to a connection", t, func() {
+		var buf bytes.Buffer
+
+		w := NewWriter(zap.NewNop(), &buf)
+
+		_, err := w.WriteFrame(NewPayloadFrame(1, false, false, true, true, Metadata("foo"), []byte("hello world")))
+		So(err, ShouldBeNil)
+
+		_, err = w.WriteFrame(NewPayloadFrame(1, false, false, true, true, Metadata(bytes.Repeat([]byte("m"), 100)), []byte("hello")))
+		So(err, ShouldBeNil)
+
+		_, err = w.WriteFrame(NewMetadataPushFrame(Metadata(bytes.Repeat([]byte("m"), 100))))
+		So(err, ShouldBeNil)
+
+		r := NewReader(zap.NewNop(), &buf)
+
+		Convey("When read frames with a metadata ratio limit", func() {
+			r.MetadataLimit = &MetadataLimit{MaxRatio: 0.5}
+
+			Convey("Then the frame with metadata exceeds the limit should be rejected", func() {
+				f, err := r.ReadFrame()
+
+				So(err, ShouldBeNil)
+				So(f.(*PayloadFrame).Metadata, ShouldResemble, Metadata("foo"))
+				So(f.(*PayloadFrame).Data, ShouldResemble, []byte("hello world"))
+
+				f, err = r.ReadFrame()
+
+				So(f, ShouldBeNil)
+				So(err, ShouldEqual, ErrMetadataTooLarge)
+				So(err.(*Error).Code, ShouldEqual, ErrConnectionError)
+
+				f, err = r.ReadFrame()
+
+				So(err, ShouldBeNil)
+				So(f.Type(), ShouldEqual, TypeMetadataPush)
+			})
+		})
+
+		Convey("When read frames with a metadata size limit", func() {
+			r.MetadataLimit = &MetadataLimit{MaxSize: 64}
+
+			Convey("Then the frame with metadata exceeds the limit should be rejected", func() {
+				_, err := r.ReadFrame()
+				So(err, ShouldBeNil)
+
+				_, err = r.ReadFrame()
+				So(err, ShouldEqual, ErrMetadataTooLarge)
+
+				_, err = r.ReadFrame()
+				So(err, ShouldEqual, ErrMetadataTooLarge)
+			})
+		})
+	})
+}
+
+func TestReadFrameWithMetadataLimitBeforeBuffered(t *testing.T) {
+	Convey("Given frames with the metadata declared wrote to a connection", t, func() {
+		var buf bytes.Buffer
+
+		w := NewWriter(zap.NewNop(), &buf)
+
+		large := NewRequestStreamFrame(1, false, 8, true, Metadata(bytes.Repeat([]byte("m"), 100)), []byte("hello"))
+		small := NewRequestChannelFrame(3, false, false, 8, true, Metadata("foo"), []byte("hello"))
+
+		for _, f := range []Frame{large, small} {
+			_, err := w.WriteFrame(f)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("When read frames with a metadata limit and a memory budget less than the frame", func() {
+			allocator := NewBudgetAllocator(int64(small.Size()))
+
+			r := NewReader(zap.NewNop(), &buf)
+			r.MetadataLimit = &MetadataLimit{MaxSize: 64}
+			r.Allocator = allocator
+
+			Convey("Then the frame should be rejected by the metadata declared before it buffered", func() {
+				f, err := r.ReadFrame()
+				So(f, ShouldBeNil)
+				So(err, ShouldEqual, ErrMetadataTooLarge)
+				So(allocator.Used(), ShouldEqual, 0)
+
+				Convey("And the following frame still can be read", func() {
+					f, err := r.ReadFrame()
+					So(err, ShouldBeNil)
+					So(f, ShouldResemble, small)
+				})
+			})
+		})
+	})
+}
+
+func TestReadMaxSizeFrame(t *testing.T) {
+	Convey("Given a PAYLOAD frame of the maximum size", t, func() {
+		metadata := Metadata(bytes.Repeat([]byte("m"), MaxFrameSize/2))
+		data := bytes.Repeat([]byte("d"), MaxFrameSize-HeaderSize-metadata.Size())
+		f := NewPayloadFrame(1, false, true, true, true, metadata, data)
+
+		So(f.Size(), ShouldEqual, MaxFrameSize)
+
+		Convey("When write the frame to a connection", func() {
+			var buf bytes.Buffer
+
+			n, err := f.WriteTo(&buf)
+
+			Convey("Then the size should agree with the wrote bytes", func() {
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, f.Size())
+				So(buf.Len(), ShouldEqual, f.Size())
+			})
+
+			Convey("Then the frame should be read back", func() {
+				buf.Reset()
+
+				n, err := NewWriter(zap.NewNop(), &buf).WriteFrame(f)
+
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, FrameLengthSize+MaxFrameSize)
+
+				read, err := NewReader(zap.NewNop(), &buf).ReadFrame()
+
+				So(err, ShouldBeNil)
+				So(read.Size(), ShouldEqual, MaxFrameSize)
+				So(len(read.(*PayloadFrame).Metadata), ShouldEqual, len(metadata))
+				So(len(read.(*PayloadFrame).Data), ShouldEqual, len(data))
+			})
+		})
+
+		Convey("When write a frame exceeds the maximum size", func() {
+			f := NewPayloadFrame(1, false, true, true, true, metadata, append(data, 'd'))
+
+			_, err := NewWriter(zap.NewNop(), new(bytes.Buffer)).WriteFrame(f)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrFrameTooLarge)
+			})
+		})
+	})
+}
+
+func TestReadFrameWithAllocator(t *testing.T) {
+	Convey("Given frames wrote to a connection", t, func() {
+		var buf bytes.Buffer
+
+		w := NewWriter(zap.NewNop(), &buf)
+
+		small := NewPayloadFrame(1, false, false, true, false, nil, []byte("hello"))
+		large := NewPayloadFrame(1, false, false, true, false, nil, bytes.Repeat([]byte("x"), 100))
+
+		for _, f := range []Frame{small, large, small} {
+			_, err := w.WriteFrame(f)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("When read frames with a tiny memory budget", func() {
+			allocator := NewBudgetAllocator(int64(small.Size()))
+			r := NewReader(zap.NewNop(), &buf)
+			r.Allocator = allocator
+
+			Convey("Then the frames within the budget should be read", func() {
+				f, err := r.ReadFrame()
+				So(err, ShouldBeNil)
+				So(f, ShouldResemble, small)
+
+				Convey("And the buffer should be held until the frame released", func() {
+					So(allocator.Used(), ShouldBeGreaterThan, 0)
+
+					Release(f)
+					So(allocator.Used(), ShouldEqual, 0)
+
+					Release(f)
+					So(allocator.Used(), ShouldEqual, 0)
+				})
+
+				Release(f)
+
+				Convey("And the frame exceeds the budget should fail gracefully", func() {
+					f, err := r.ReadFrame()
+					So(err, ShouldEqual, ErrMemoryExhausted)
+					So(f, ShouldBeNil)
+
+					Convey("And the following frame still can be read", func() {
+						f, err := r.ReadFrame()
+						So(err, ShouldBeNil)
+						So(f, ShouldResemble, small)
+					})
+				})
+			})
+		})
+
+		Convey("When the memory budget exhausted by others", func() {
+			allocator := NewBudgetAllocator(int64(small.Size()))
+			held, err := allocator.Allocate(small.Size())
+			So(err, ShouldBeNil)
+
+			r := NewReader(zap.NewNop(), &buf)
+			r.Allocator = allocator
+
+			Convey("Then the frame should be read once the memory released", func() {
+				_, err := r.ReadFrame()
+				So(err, ShouldEqual, ErrMemoryExhausted)
+
+				allocator.Release(held)
+
+				_, err = r.ReadFrame()
+				So(err, ShouldEqual, ErrMemoryExhausted)
+
+				f, err := r.ReadFrame()
+				So(err, ShouldBeNil)
+				So(f, ShouldResemble, small)
+			})
+		})
+	})
+}
+
+func TestReadSetupFrameWithLimit(t *testing.T) {
+	Convey("Given a SETUP frame wrote to a connection", t, func() {
+		var buf bytes.Buffer
+
+		w := NewWriter(zap.NewNop(), &buf)
+
+		setup := func(metadata Metadata, data []byte) *SetupFrame {
+			return NewSetupFrame(V1, false, time.Second, time.Minute, nil,
+				"application/json", "application/binary", metadata != nil, metadata, data)
+		}
+
+		small := setup(Metadata("foo"), []byte("hello"))
+		next := NewKeepaliveFrame(true, 0, nil)
+
+		r := NewReader(zap.NewNop(), &buf)
+		r.SetupLimit = &SetupLimit{MaxMetadataSize: 64, MaxDataSize: 1024}
+
+		// The oversized frame can't be buffered in the memory budget.
+		r.Allocator = NewBudgetAllocator(int64(small.Size()))
+
+		Convey("When read a SETUP frame in the limit", func() {
+			for _, f := range []Frame{small, next} {
+				_, err := w.WriteFrame(f)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then the frame should be read", func() {
+				f, err := r.ReadFrame()
+				So(err, ShouldBeNil)
+				So(f, ShouldResemble, small)
+
+				f, err = r.ReadFrame()
+				So(err, ShouldBeNil)
+				So(f.Type(), ShouldEqual, TypeKeepalive)
+			})
+		})
+
+		Convey("When read a SETUP frame with oversized data", func() {
+			for _, f := range []Frame{setup(nil, bytes.Repeat([]byte("d"), 1<<20)), next} {
+				_, err := w.WriteFrame(f)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then the frame should be rejected before buffered", func() {
+				f, err := r.ReadFrame()
+				So(f, ShouldBeNil)
+				So(err, ShouldEqual, ErrSetupTooLarge)
+				So(err.(*Error).Code, ShouldEqual, ErrRejectedSetup)
+
+				f, err = r.ReadFrame()
+				So(err, ShouldBeNil)
+				So(f.Type(), ShouldEqual, TypeKeepalive)
+			})
+		})
+
+		Convey("When read a SETUP frame with oversized metadata", func() {
+			_, err := w.WriteFrame(setup(Metadata(bytes.Repeat([]byte("m"), 100)), nil))
+			So(err, ShouldBeNil)
+
+			Convey("Then the frame should be rejected", func() {
+				_, err := r.ReadFrame()
+				So(err, ShouldEqual, ErrSetupTooLarge)
+			})
+		})
+	})
+}
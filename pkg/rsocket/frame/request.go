@@ -7,8 +7,11 @@ import (
 	"io/ioutil"
 )
 
-const initReqsSize = uint32Size
-const reqsSize = uint32Size
+// InitialRequestsSize is the size of initial requests in REQUEST_STREAM and REQUEST_CHANNEL frames.
+const InitialRequestsSize = uint32Size
+
+// RequestNSize is the size of number of requests in REQUEST_N frame.
+const RequestNSize = uint32Size
 
 // RequestResponseFrame sent by client to request a single response.
 type RequestResponseFrame struct {
@@ -240,7 +243,7 @@ func readRequestStreamFrame(r io.Reader, header *Header) (frame *RequestStreamFr
 
 // Size returns the encoded size of the frame.
 func (request *RequestStreamFrame) Size() int {
-	return request.Header.Size() + initReqsSize + request.Metadata.Size() + len(request.Data)
+	return request.Header.Size() + InitialRequestsSize + request.Metadata.Size() + len(request.Data)
 }
 
 // WriteTo writes the encoded frame to w.
@@ -253,7 +256,7 @@ func (request *RequestStreamFrame) WriteTo(w io.Writer) (wrote int64, err error)
 		return
 	}
 
-	wrote += initReqsSize
+	wrote += InitialRequestsSize
 
 	var n int64
 
@@ -350,7 +353,7 @@ func (request *RequestChannelFrame) String() string {
 
 // Size returns the encoded size of the frame.
 func (request *RequestChannelFrame) Size() int {
-	return request.Header.Size() + initReqsSize + request.Metadata.Size() + len(request.Data)
+	return request.Header.Size() + InitialRequestsSize + request.Metadata.Size() + len(request.Data)
 }
 
 // WriteTo writes the encoded frame to w.
@@ -363,7 +366,7 @@ func (request *RequestChannelFrame) WriteTo(w io.Writer) (wrote int64, err error
 		return
 	}
 
-	wrote += initReqsSize
+	wrote += InitialRequestsSize
 
 	var n int64
 
@@ -419,7 +422,7 @@ func (request *RequestNFrame) String() string {
 
 // Size returns the encoded size of the frame.
 func (request *RequestNFrame) Size() int {
-	return request.Header.Size() + reqsSize
+	return request.Header.Size() + RequestNSize
 }
 
 // WriteTo writes the encoded frame to w.
@@ -436,7 +439,7 @@ func (request *RequestNFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += reqsSize
+	wrote += RequestNSize
 
 	return
 }
@@ -5,7 +5,8 @@ import (
 	"io"
 )
 
-const firstAvailableSize = uint64Size
+// FirstAvailableSize is the size of first available position in RESUME frame.
+const FirstAvailableSize = uint64Size
 
 // ResumeFrame replaces SETUP for Resuming Operation (optional)
 type ResumeFrame struct {
@@ -60,7 +61,7 @@ func (resume *ResumeFrame) Size() int {
 	size := resume.Header.Size() + resume.Version.Size()
 
 	size += tokenLenSize + resume.Token.Size()
-	size += lastReceivedSize + firstAvailableSize
+	size += LastReceivedSize + FirstAvailableSize
 
 	return size
 }
@@ -92,7 +93,7 @@ func (resume *ResumeFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += lastReceivedSize + firstAvailableSize
+	wrote += LastReceivedSize + FirstAvailableSize
 
 	return
 }
@@ -103,6 +104,11 @@ type ResumeOkFrame struct {
 	LastReceived Position // The last implied position the server received from the client.
 }
 
+// NewResumeOkFrame creates a new ResumeOkFrame.
+func NewResumeOkFrame(lastReceived Position) *ResumeOkFrame {
+	return &ResumeOkFrame{&Header{0, TypeResumeOk, 0}, lastReceived}
+}
+
 func readResumeOkFrame(r io.Reader, header *Header) (frame *ResumeOkFrame, err error) {
 	var lastReceived uint64
 
@@ -120,7 +126,7 @@ func readResumeOkFrame(r io.Reader, header *Header) (frame *ResumeOkFrame, err e
 
 // Size returns the encoded size of the frame.
 func (frame *ResumeOkFrame) Size() int {
-	return frame.Header.Size() + lastReceivedSize
+	return frame.Header.Size() + LastReceivedSize
 }
 
 // WriteTo writes the encoded frame to w.
@@ -137,7 +143,7 @@ func (frame *ResumeOkFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += lastReceivedSize
+	wrote += LastReceivedSize
 
 	return
 }
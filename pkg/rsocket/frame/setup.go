@@ -4,26 +4,53 @@ import (
 	"encoding/binary"
 	"io"
 	"io/ioutil"
+	"math"
 	"time"
 )
 
-const keepaliveSize = uint32Size
-const maxLifetimeSize = uint32Size
+// KeepaliveSize is the size of keepalive interval in SETUP frame.
+const KeepaliveSize = uint32Size
+
+// MaxLifetimeSize is the size of max lifetime in SETUP frame.
+const MaxLifetimeSize = uint32Size
+
+// maxDuration is the maximum duration encoded as 31-bit unsigned milliseconds, the high bit of uint32 is reserved.
+const maxDuration = time.Duration(math.MaxInt32) * time.Millisecond
+
+var (
+	// ErrKeepaliveOutOfRange is returned when encode a SETUP frame with keepalive not positive or exceeds the limit.
+	ErrKeepaliveOutOfRange = ErrInvalidSetup.WithMessage("keepalive out of range")
+
+	// ErrMaxLifetimeOutOfRange is returned when encode a SETUP frame with max lifetime not positive or exceeds the limit.
+	ErrMaxLifetimeOutOfRange = ErrInvalidSetup.WithMessage("max lifetime out of range")
+
+	// ErrKeepaliveExceedsMaxLifetime is returned when encode or decode a SETUP frame with keepalive greater than max lifetime.
+	ErrKeepaliveExceedsMaxLifetime = ErrInvalidSetup.WithMessage("keepalive exceeds max lifetime")
+
+	// ErrInvalidMimeType is returned when encode or decode a SETUP frame with MIME type longer than 127 bytes,
+	// or a malformed data MIME type entry of composite metadata.
+	ErrInvalidMimeType = ErrInvalidSetup.WithMessage("invalid MIME type")
+)
+
+// maxSetupMimeLength is the max length of MIME type in SETUP frame, the high bit of length is the compact flag.
+const maxSetupMimeLength = WellKnownMimeFlag - 1
 
 // SetupFrame sent by client to initiate protocol processing.
 type SetupFrame struct {
 	*Header
-	Version          Version
-	Keepalive        time.Duration
-	MaxLifetime      time.Duration
-	ResumeToken      Token
-	MetadataMimeType string
-	DataMimeType     string
-	Metadata         Metadata
-	Data             []byte
+	Version                 Version
+	Keepalive               time.Duration
+	MaxLifetime             time.Duration
+	ResumeToken             Token
+	MetadataMimeType        string
+	DataMimeType            string
+	CompactMetadataMimeType bool // Encodes the well-known metadata MIME type as the single-byte ID.
+	CompactDataMimeType     bool // Encodes the well-known data MIME type as the single-byte ID.
+	Metadata                Metadata
+	Data                    []byte
 }
 
-// NewSetupFrame creates a SetupFrame.
+// NewSetupFrame creates a SetupFrame, the keepalive and max lifetime are validated before written, see Validate.
 func NewSetupFrame(
 	version Version,
 	lease bool,
@@ -56,16 +83,25 @@ func NewSetupFrame(
 		resumeToken,
 		metadataMimeType,
 		dataMimeType,
+		false,
+		false,
 		metadata,
 		data,
 	}
 }
 
 func readSetupFrame(r io.Reader, header *Header) (frame *SetupFrame, err error) {
+	return readSetupFrameWithLimit(r, header, nil)
+}
+
+// readSetupFrameWithLimit reads the SETUP frame, and fails with ErrSetupTooLarge
+// once the metadata or data exceeds the limit, the excess is never read.
+func readSetupFrameWithLimit(r io.Reader, header *Header, limit *SetupLimit) (frame *SetupFrame, err error) {
 	var major, minor uint16
 	var keepalive, maxLifetime uint32
 	var resumeToken Token
 	var metadataMimeType, dataMimeType string
+	var compactMetadataMime, compactDataMime bool
 	var metadata Metadata
 	var data []byte
 
@@ -82,48 +118,54 @@ func readSetupFrame(r io.Reader, header *Header) (frame *SetupFrame, err error)
 		return
 	}
 
+	if keepalive == 0 || keepalive > math.MaxInt32 {
+		return nil, ErrKeepaliveOutOfRange
+	}
+	if maxLifetime == 0 || maxLifetime > math.MaxInt32 {
+		return nil, ErrMaxLifetimeOutOfRange
+	}
+	if keepalive > maxLifetime {
+		return nil, ErrKeepaliveExceedsMaxLifetime
+	}
+
 	if header.HasResumeToken() {
 		if resumeToken, err = readToken(r); err != nil {
 			return
 		}
 	}
 
-	var len byte
-
-	if err = binary.Read(r, binary.BigEndian, &len); err != nil {
-		return
-	}
-
-	buf := make([]byte, len)
-
-	if err = binary.Read(r, binary.BigEndian, buf); err != nil {
+	if metadataMimeType, compactMetadataMime, err = readMimeType(r); err != nil {
 		return
 	}
 
-	metadataMimeType = string(buf)
-
-	if err = binary.Read(r, binary.BigEndian, &len); err != nil {
+	if dataMimeType, compactDataMime, err = readMimeType(r); err != nil {
 		return
 	}
 
-	buf = make([]byte, len)
+	if header.HasMetadata() {
+		var size uint32
 
-	if err = binary.Read(r, binary.BigEndian, buf); err != nil {
-		return
-	}
+		if size, err = readUInt24(r, binary.BigEndian); err != nil {
+			return
+		}
 
-	dataMimeType = string(buf)
+		if limit.metadataExceeded(int(size)) {
+			return nil, ErrSetupTooLarge
+		}
 
-	if header.HasMetadata() {
-		if metadata, err = readMetadata(r); err != nil {
+		if metadata, err = readExact(r, int(size)); err != nil {
 			return
 		}
 	}
 
-	if data, err = ioutil.ReadAll(r); err != nil {
+	if data, err = ioutil.ReadAll(limit.dataReader(r)); err != nil {
 		return
 	}
 
+	if limit.dataExceeded(data) {
+		return nil, ErrSetupTooLarge
+	}
+
 	frame = &SetupFrame{
 		header,
 		Version{major, minor},
@@ -132,6 +174,8 @@ func readSetupFrame(r io.Reader, header *Header) (frame *SetupFrame, err error)
 		resumeToken,
 		metadataMimeType,
 		dataMimeType,
+		compactMetadataMime,
+		compactDataMime,
 		metadata,
 		data,
 	}
@@ -139,23 +183,107 @@ func readSetupFrame(r io.Reader, header *Header) (frame *SetupFrame, err error)
 	return
 }
 
+// readMimeType reads the MIME type with the length prefix, or the well-known MIME type ID with the high bit set.
+//
+// The length of MIME type never exceeds 127 bytes, the byte with the high bit set must be an assigned
+// well-known MIME type ID, otherwise it fails with ErrInvalidMimeType.
+func readMimeType(r io.Reader) (mime string, compact bool, err error) {
+	var len byte
+
+	if err = binary.Read(r, binary.BigEndian, &len); err != nil {
+		return
+	}
+
+	if len&WellKnownMimeFlag != 0 {
+		if id := WellKnownMime(len &^ WellKnownMimeFlag); id.Known() {
+			return id.String(), true, nil
+		}
+
+		return "", false, ErrInvalidMimeType
+	}
+
+	var buf []byte
+
+	if buf, err = readExact(r, int(len)); err != nil {
+		return
+	}
+
+	return string(buf), false, nil
+}
+
+// mimeTypeSize returns the encoded size of the MIME type.
+func mimeTypeSize(mime string, compact bool) int {
+	if _, ok := WellKnownMimeID(mime); ok && compact {
+		return byteSize
+	}
+
+	return byteSize + len(mime)
+}
+
+// writeMimeType writes the MIME type with the length prefix, or the well-known MIME type ID if compact.
+func writeMimeType(w io.Writer, mime string, compact bool) (wrote int64, err error) {
+	if id, ok := WellKnownMimeID(mime); ok && compact {
+		if err = writeByte(w, WellKnownMimeFlag|id); err != nil {
+			return
+		}
+
+		return byteSize, nil
+	}
+
+	if len(mime) > maxSetupMimeLength {
+		return 0, ErrInvalidMimeType
+	}
+
+	if err = writeByte(w, byte(len(mime))); err != nil {
+		return
+	}
+
+	if wrote, err = writeExact(w, []byte(mime)); err != nil {
+		return
+	}
+
+	return byteSize + wrote, nil
+}
+
+// Validate the keepalive and max lifetime are positive and fit the 31-bit unsigned milliseconds,
+// and the keepalive does not exceed the max lifetime.
+func (setup *SetupFrame) Validate() error {
+	if setup.Keepalive <= 0 || setup.Keepalive > maxDuration {
+		return ErrKeepaliveOutOfRange
+	}
+
+	if setup.MaxLifetime <= 0 || setup.MaxLifetime > maxDuration {
+		return ErrMaxLifetimeOutOfRange
+	}
+
+	if setup.Keepalive > setup.MaxLifetime {
+		return ErrKeepaliveExceedsMaxLifetime
+	}
+
+	return nil
+}
+
 // Size returns the encoded size of the frame.
 func (setup *SetupFrame) Size() int {
-	size := setup.Header.Size() + setup.Version.Size() + keepaliveSize + maxLifetimeSize
+	size := setup.Header.Size() + setup.Version.Size() + KeepaliveSize + MaxLifetimeSize
 
 	if setup.HasResumeToken() {
 		size += tokenLenSize + setup.ResumeToken.Size()
 	}
 
-	size += byteSize + len(setup.MetadataMimeType)
-	size += byteSize + len(setup.DataMimeType)
+	size += mimeTypeSize(setup.MetadataMimeType, setup.CompactMetadataMimeType)
+	size += mimeTypeSize(setup.DataMimeType, setup.CompactDataMimeType)
 	size += setup.Metadata.Size() + len(setup.Data)
 
 	return size
 }
 
-// WriteTo writes the encoded frame to w.
+// WriteTo writes the encoded frame to w, fails if the keepalive or max lifetime out of range.
 func (setup *SetupFrame) WriteTo(w io.Writer) (wrote int64, err error) {
+	if err = setup.Validate(); err != nil {
+		return
+	}
+
 	if wrote, err = setup.Header.WriteTo(w); err != nil {
 		return
 	}
@@ -175,7 +303,7 @@ func (setup *SetupFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		return
 	}
 
-	wrote += keepaliveSize + maxLifetimeSize
+	wrote += KeepaliveSize + MaxLifetimeSize
 
 	if setup.HasResumeToken() {
 		if n, err = setup.ResumeToken.WriteTo(w); err != nil {
@@ -185,23 +313,17 @@ func (setup *SetupFrame) WriteTo(w io.Writer) (wrote int64, err error) {
 		wrote += n
 	}
 
-	if err = writeByte(w, byte(len(setup.MetadataMimeType))); err != nil {
-		return
-	}
-	if n, err = writeExact(w, []byte(setup.MetadataMimeType)); err != nil {
+	if n, err = writeMimeType(w, setup.MetadataMimeType, setup.CompactMetadataMimeType); err != nil {
 		return
 	}
 
-	wrote += byteSize + n
+	wrote += n
 
-	if err = writeByte(w, byte(len(setup.DataMimeType))); err != nil {
-		return
-	}
-	if n, err = writeExact(w, []byte(setup.DataMimeType)); err != nil {
+	if n, err = writeMimeType(w, setup.DataMimeType, setup.CompactDataMimeType); err != nil {
 		return
 	}
 
-	wrote += byteSize + n
+	wrote += n
 
 	if setup.HasMetadata() {
 		if n, err = setup.Metadata.WriteTo(w); err != nil {
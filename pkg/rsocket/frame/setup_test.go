@@ -0,0 +1,237 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetupFrameWithoutMetadata(t *testing.T) {
+	Convey("Given a SETUP frame without metadata", t, func() {
+		setup := NewSetupFrame(V1, false, time.Second, 3*time.Second, nil, "application/json", "text/plain", false, nil, []byte("hello"))
+
+		So(setup.HasMetadata(), ShouldBeFalse)
+		So(setup.Size(), ShouldEqual, HeaderSize+4+KeepaliveSize+MaxLifetimeSize+1+len("application/json")+1+len("text/plain")+len("hello"))
+
+		Convey("When decode the encoded frame", func() {
+			f, err := decodeFrame(setup)
+
+			So(err, ShouldBeNil)
+
+			Convey("Then both MIME types should be reconstructed", func() {
+				decoded := f.(*SetupFrame)
+
+				So(decoded.HasMetadata(), ShouldBeFalse)
+				So(decoded.Version, ShouldResemble, V1)
+				So(decoded.Keepalive, ShouldEqual, time.Second)
+				So(decoded.MaxLifetime, ShouldEqual, 3*time.Second)
+				So(decoded.MetadataMimeType, ShouldEqual, "application/json")
+				So(decoded.DataMimeType, ShouldEqual, "text/plain")
+				So(decoded.Metadata, ShouldBeNil)
+				So(string(decoded.Data), ShouldEqual, "hello")
+			})
+		})
+	})
+}
+
+func TestSetupFrameKeepaliveRange(t *testing.T) {
+	Convey("Given SETUP frames with keepalive and max lifetime", t, func() {
+		Convey("When encode a frame with normal durations", func() {
+			setup := NewSetupFrame(V1, false, 1500*time.Millisecond, time.Minute, nil, "", "", false, nil, nil)
+
+			buf, err := Encode(setup)
+
+			Convey("Then the durations should be encoded in milliseconds", func() {
+				So(err, ShouldBeNil)
+				So(setup.Validate(), ShouldBeNil)
+
+				offset := HeaderSize + 4
+				So(binary.BigEndian.Uint32(buf[offset:]), ShouldEqual, 1500)
+				So(binary.BigEndian.Uint32(buf[offset+KeepaliveSize:]), ShouldEqual, 60000)
+			})
+		})
+
+		Convey("When encode a frame with keepalive exceeds 31-bit milliseconds", func() {
+			setup := NewSetupFrame(V1, false, maxDuration+time.Millisecond, maxDuration, nil, "", "", false, nil, nil)
+
+			_, err := Encode(setup)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrKeepaliveOutOfRange)
+			})
+		})
+
+		Convey("When encode a frame with max lifetime exceeds 31-bit milliseconds", func() {
+			setup := NewSetupFrame(V1, false, time.Second, maxDuration+time.Millisecond, nil, "", "", false, nil, nil)
+
+			_, err := Encode(setup)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrMaxLifetimeOutOfRange)
+			})
+		})
+
+		Convey("When encode a frame with keepalive not positive", func() {
+			setup := NewSetupFrame(V1, false, 0, time.Minute, nil, "", "", false, nil, nil)
+
+			Convey("Then it should fail", func() {
+				So(setup.Validate(), ShouldEqual, ErrKeepaliveOutOfRange)
+			})
+		})
+
+		Convey("When encode a frame with keepalive greater than max lifetime", func() {
+			setup := NewSetupFrame(V1, false, time.Minute, time.Second, nil, "", "", false, nil, nil)
+
+			_, err := Encode(setup)
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrKeepaliveExceedsMaxLifetime)
+			})
+		})
+	})
+}
+
+func TestDecodeSetupFrameKeepaliveRange(t *testing.T) {
+	Convey("Given SETUP frames with keepalive and max lifetime from a malformed peer", t, func() {
+		cases := []struct {
+			name        string
+			keepalive   uint32
+			maxLifetime uint32
+			err         error
+		}{
+			{"zero keepalive", 0, 1000, ErrKeepaliveOutOfRange},
+			{"zero max lifetime", 1000, 0, ErrMaxLifetimeOutOfRange},
+			{"keepalive with the reserved bit", math.MaxInt32 + 1, math.MaxInt32, ErrKeepaliveOutOfRange},
+			{"max lifetime with the reserved bit", 1000, math.MaxInt32 + 1, ErrMaxLifetimeOutOfRange},
+			{"keepalive greater than max lifetime", 2000, 1000, ErrKeepaliveExceedsMaxLifetime},
+		}
+
+		for _, c := range cases {
+			Convey("When decode a frame with "+c.name, func() {
+				var buf bytes.Buffer
+
+				_, err := (&Header{0, TypeSetup, 0}).WriteTo(&buf)
+				So(err, ShouldBeNil)
+
+				_, err = V1.WriteTo(&buf)
+				So(err, ShouldBeNil)
+
+				binary.Write(&buf, binary.BigEndian, c.keepalive)
+				binary.Write(&buf, binary.BigEndian, c.maxLifetime)
+				buf.Write([]byte{0, 0})
+
+				header, err := readHeader(&buf)
+				So(err, ShouldBeNil)
+
+				_, err = readFrame(&buf, header)
+
+				Convey("Then it should be rejected", func() {
+					So(err, ShouldEqual, c.err)
+				})
+			})
+		}
+	})
+}
+
+func TestSetupFrameWithCompactMimeTypes(t *testing.T) {
+	Convey("Given a SETUP frame with compact MIME types", t, func() {
+		setup := NewSetupFrame(V1, false, time.Second, 3*time.Second, nil, CompositeMetadataMimeType, "application/json", false, nil, nil)
+		setup.CompactMetadataMimeType = true
+		setup.CompactDataMimeType = true
+
+		So(setup.Size(), ShouldEqual, HeaderSize+4+KeepaliveSize+MaxLifetimeSize+1+1)
+
+		Convey("When encode the frame", func() {
+			buf, err := Encode(setup)
+			So(err, ShouldBeNil)
+
+			Convey("Then the well-known MIME types should be encoded as ID", func() {
+				offset := HeaderSize + 4 + KeepaliveSize + MaxLifetimeSize
+
+				So(buf[offset:], ShouldResemble, []byte{0xFF, 0x85})
+			})
+		})
+
+		Convey("When decode the encoded frame", func() {
+			f, err := decodeFrame(setup)
+			So(err, ShouldBeNil)
+
+			Convey("Then the MIME types should be round-tripped in the compact form", func() {
+				decoded := f.(*SetupFrame)
+
+				So(decoded.MetadataMimeType, ShouldEqual, CompositeMetadataMimeType)
+				So(decoded.DataMimeType, ShouldEqual, "application/json")
+				So(decoded.CompactMetadataMimeType, ShouldBeTrue)
+				So(decoded.CompactDataMimeType, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the data MIME type is unknown", func() {
+			setup.DataMimeType = "application/x.custom"
+
+			f, err := decodeFrame(setup)
+			So(err, ShouldBeNil)
+
+			Convey("Then it should fall back to the length-prefixed string", func() {
+				So(setup.Size(), ShouldEqual, HeaderSize+4+KeepaliveSize+MaxLifetimeSize+1+1+len("application/x.custom"))
+
+				decoded := f.(*SetupFrame)
+
+				So(decoded.MetadataMimeType, ShouldEqual, CompositeMetadataMimeType)
+				So(decoded.DataMimeType, ShouldEqual, "application/x.custom")
+			})
+		})
+
+		Convey("When only the metadata MIME type is compact", func() {
+			setup.CompactDataMimeType = false
+
+			buf, err := Encode(setup)
+			So(err, ShouldBeNil)
+
+			f, err := decodeFrame(setup)
+			So(err, ShouldBeNil)
+
+			Convey("Then the compact form should be round-tripped per MIME type", func() {
+				decoded := f.(*SetupFrame)
+
+				So(decoded.CompactMetadataMimeType, ShouldBeTrue)
+				So(decoded.CompactDataMimeType, ShouldBeFalse)
+
+				reencoded, err := Encode(decoded)
+				So(err, ShouldBeNil)
+				So(reencoded, ShouldResemble, buf)
+			})
+		})
+
+		Convey("When the MIME type exceeds 127 bytes", func() {
+			setup.DataMimeType = "application/x." + strings.Repeat("a", maxSetupMimeLength)
+
+			_, err := Encode(setup)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrInvalidMimeType)
+			})
+		})
+
+		Convey("When decode a MIME type with the unassigned compact ID", func() {
+			buf, err := Encode(setup)
+			So(err, ShouldBeNil)
+
+			buf[HeaderSize+4+KeepaliveSize+MaxLifetimeSize+1] = WellKnownMimeFlag | 0x70
+
+			header, err := readHeader(bytes.NewReader(buf))
+			So(err, ShouldBeNil)
+
+			_, err = readFrame(bytes.NewReader(buf[HeaderSize:]), header)
+
+			Convey("Then it should be rejected", func() {
+				So(err, ShouldEqual, ErrInvalidMimeType)
+			})
+		})
+	})
+}
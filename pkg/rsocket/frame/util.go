@@ -16,7 +16,17 @@ const uint64Size = 8
 // ErrIncomplete is returned when read an incomplete field.
 var ErrIncomplete = errors.New("incomplete")
 
+// remaining is implemented by the in-memory readers, which know the bytes left.
+type remaining interface {
+	Len() int
+}
+
+// readExact reads the field of size, which never allocates more than the bytes left in an in-memory reader.
 func readExact(r io.Reader, size int) ([]byte, error) {
+	if r, ok := r.(remaining); ok && r.Len() < size {
+		return nil, ErrIncomplete
+	}
+
 	buf := make([]byte, size)
 	n, err := io.ReadFull(r, buf)
 
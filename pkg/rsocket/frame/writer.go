@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"go.uber.org/zap"
 )
@@ -13,21 +15,48 @@ import (
 // WriteFrameDumper dumps wrote frame
 var WriteFrameDumper io.Writer
 
-// A Writer implements convenience methods for writing frames to a RSocket connection.
+// ErrFrameTooLarge is returned when write a frame exceeds the MaxFrameSize.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// A Writer implements convenience methods for writing frames to a RSocket connection,
+// the frames written concurrently are serialized.
 type Writer struct {
 	*zap.Logger
 	io.Writer
+	lock sync.Mutex // Serializes the writes, so the frames never interleave.
+	err  error      // The error of a failed write, the frames are rejected once set.
 }
 
 // NewWriter returns a new Writer wrting to w.
 func NewWriter(logger *zap.Logger, w io.Writer) *Writer {
-	return &Writer{logger.Named("w"), w}
+	return &Writer{Logger: logger.Named("w"), Writer: w}
+}
+
+// Err returns the error of the failed write, or nil if all frames wrote.
+func (w *Writer) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.err
 }
 
 // WriteFrame write a frame to w.
+//
+// The frame is encoded to a buffer and written with a single write, which never leaves a partial frame
+// if the encoding fails. Once the write failed or was short, the connection may be left with a partial frame,
+// the error is returned for all the following frames, and the connection should be closed.
 func (w *Writer) WriteFrame(frame Frame) (wrote int64, err error) {
+	if err := w.Err(); err != nil {
+		return 0, err
+	}
+
 	frameSize := frame.Size()
-	buf := bytes.NewBuffer(make([]byte, 0, frameLengthSize+frameSize))
+
+	if frameSize > MaxFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, FrameLengthSize+frameSize))
 
 	wrote, err = writeUInt24(buf, binary.BigEndian, uint32(frameSize))
 
@@ -45,10 +74,23 @@ func (w *Writer) WriteFrame(frame Frame) (wrote int64, err error) {
 
 	wrote += n
 
-	_, err = w.Write(buf.Bytes())
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written, err := w.Write(buf.Bytes())
+
+	if err == nil && written < buf.Len() {
+		err = io.ErrShortWrite
+	}
 
 	if err != nil {
-		return
+		w.err = err
+
+		return int64(written), err
 	}
 
 	w.Debug("write frame",
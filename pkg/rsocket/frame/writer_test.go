@@ -0,0 +1,126 @@
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+var errBrokenPipe = errors.New("broken pipe")
+
+// shortWriter accepts a limited number of bytes, and fails the write exceeds it.
+type shortWriter struct {
+	bytes.Buffer
+	limit int
+	err   error
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	if w.Len()+len(b) <= w.limit {
+		return w.Buffer.Write(b)
+	}
+
+	n, _ := w.Buffer.Write(b[:w.limit-w.Len()])
+
+	return n, w.err
+}
+
+func TestWriteFrameAtomically(t *testing.T) {
+	Convey("Given a writer to a connection", t, func() {
+		f := NewPayloadFrame(1, false, false, true, false, nil, []byte("hello world"))
+		conn := &shortWriter{limit: FrameLengthSize + f.Size() + 4, err: errBrokenPipe}
+		w := NewWriter(zap.NewNop(), conn)
+
+		_, err := w.WriteFrame(f)
+		So(err, ShouldBeNil)
+		So(w.Err(), ShouldBeNil)
+
+		Convey("When the connection fails in the middle of a frame", func() {
+			n, err := w.WriteFrame(f)
+
+			Convey("Then the writer should be marked failed", func() {
+				So(err, ShouldEqual, errBrokenPipe)
+				So(n, ShouldEqual, 4)
+				So(w.Err(), ShouldEqual, errBrokenPipe)
+
+				Convey("And the following frames should be rejected", func() {
+					written := conn.Len()
+
+					_, err := w.WriteFrame(NewCancelFrame(1))
+
+					So(err, ShouldEqual, errBrokenPipe)
+					So(conn.Len(), ShouldEqual, written)
+				})
+			})
+		})
+
+		Convey("When the connection writes a part of frame without error", func() {
+			conn.err = nil
+
+			_, err := w.WriteFrame(f)
+
+			Convey("Then the short write should be reported", func() {
+				So(err, ShouldEqual, io.ErrShortWrite)
+				So(w.Err(), ShouldEqual, io.ErrShortWrite)
+			})
+		})
+
+		Convey("When the frame failed to encode", func() {
+			_, err := w.WriteFrame(NewPayloadFrame(1, false, false, true, false, nil, make([]byte, MaxFrameSize)))
+
+			Convey("Then nothing should be written and the writer should not be failed", func() {
+				So(err, ShouldEqual, ErrFrameTooLarge)
+				So(w.Err(), ShouldBeNil)
+				So(conn.Len(), ShouldEqual, FrameLengthSize+f.Size())
+			})
+		})
+	})
+}
+
+func TestWriteFramesConcurrently(t *testing.T) {
+	Convey("Given a writer to a connection", t, func() {
+		var conn bytes.Buffer
+
+		w := NewWriter(zap.NewNop(), &conn)
+
+		Convey("When write frames concurrently", func() {
+			const writers, frames = 8, 64
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+
+				go func(streamID StreamID) {
+					defer wg.Done()
+
+					for j := 0; j < frames; j++ {
+						w.WriteFrame(NewPayloadFrame(streamID, false, false, true, false, nil, []byte("hello world")))
+					}
+				}(StreamID(i*2 + 1))
+			}
+
+			wg.Wait()
+
+			Convey("Then the frames should never interleave", func() {
+				So(w.Err(), ShouldBeNil)
+
+				r := NewReader(zap.NewNop(), &conn)
+
+				for i := 0; i < writers*frames; i++ {
+					f, err := r.ReadFrame()
+
+					So(err, ShouldBeNil)
+					So(f.(*PayloadFrame).Data, ShouldResemble, []byte("hello world"))
+				}
+
+				So(conn.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,198 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// ErrRequestIDNotSupported is returned when attach the request ID on a connection without composite metadata.
+var ErrRequestIDNotSupported = errors.New("request ID requires composite metadata")
+
+type initialRequestsKey struct{}
+
+// ContextWithInitialRequests returns a context requests n payloads up front for the streams requested with it,
+// which overrides the flow control strategy of requester.
+func ContextWithInitialRequests(ctx context.Context, n uint32) context.Context {
+	return context.WithValue(ctx, initialRequestsKey{}, n)
+}
+
+func initialRequestsFromContext(ctx context.Context) (uint32, bool) {
+	n, ok := ctx.Value(initialRequestsKey{}).(uint32)
+
+	return n, ok && n > 0
+}
+
+// RequestBuilder composes the options of a request, and dispatches it to the Requester.
+type RequestBuilder struct {
+	requester       Requester
+	payload         *Payload
+	initialRequests uint32
+	routes          RoutingMetadata
+	requestID       *string
+	timeout         time.Duration
+}
+
+// NewRequest creates a RequestBuilder dispatches the request to the Requester.
+func NewRequest(requester Requester) *RequestBuilder {
+	return &RequestBuilder{requester: requester}
+}
+
+// Payload sets the payload of request.
+func (builder *RequestBuilder) Payload(payload *Payload) *RequestBuilder {
+	builder.payload = payload
+
+	return builder
+}
+
+// InitialRequests sets the number of payloads requested up front for a stream.
+func (builder *RequestBuilder) InitialRequests(n uint32) *RequestBuilder {
+	builder.initialRequests = n
+
+	return builder
+}
+
+// Route appends the routing tags, which replace the metadata of payload with the routing metadata,
+// they are encoded as an entry of composite metadata if it is the metadata MIME type of connection.
+func (builder *RequestBuilder) Route(tags ...string) *RequestBuilder {
+	builder.routes = append(builder.routes, tags...)
+
+	return builder
+}
+
+// WithRequestID attaches the request ID to the composite metadata of payload for correlation,
+// a UUID is generated if the id is empty.
+//
+// The request fails with ErrRequestIDNotSupported unless the metadata MIME type of connection is composite metadata.
+func (builder *RequestBuilder) WithRequestID(id string) *RequestBuilder {
+	builder.requestID = &id
+
+	return builder
+}
+
+// Timeout sets the time limit of request, which cancels the request or stream once elapsed.
+func (builder *RequestBuilder) Timeout(timeout time.Duration) *RequestBuilder {
+	builder.timeout = timeout
+
+	return builder
+}
+
+// metadataMimeType returns the metadata MIME type of the connection, which decides the encoding of routing metadata.
+func (builder *RequestBuilder) metadataMimeType() string {
+	if typer, ok := builder.requester.(MetadataMimeTyper); ok {
+		return typer.MetadataMimeType()
+	}
+
+	return ""
+}
+
+func (builder *RequestBuilder) build(ctx context.Context) (context.Context, context.CancelFunc, *Payload, error) {
+	payload := builder.payload
+
+	if payload == nil {
+		payload = new(Payload)
+	}
+
+	composite := builder.metadataMimeType() == frame.CompositeMetadataMimeType
+
+	if builder.requestID != nil && !composite {
+		return nil, nil, nil, ErrRequestIDNotSupported
+	}
+
+	if len(builder.routes) > 0 {
+		metadata, err := builder.routes.Encode()
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if composite {
+			if metadata, err = Metadata(nil).AppendEntry(RoutingMimeType, metadata); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		payload = &Payload{true, metadata, payload.Data}
+	}
+
+	if builder.requestID != nil {
+		id := *builder.requestID
+
+		if id == "" {
+			var err error
+
+			if id, err = NewRequestID(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		metadata, err := payload.Metadata.AppendEntry(RequestIDMimeType, []byte(id))
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		payload = &Payload{true, metadata, payload.Data}
+	}
+
+	if builder.initialRequests > 0 {
+		ctx = ContextWithInitialRequests(ctx, builder.initialRequests)
+	}
+
+	cancel := context.CancelFunc(func() {})
+
+	if builder.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, builder.timeout)
+	}
+
+	return ctx, cancel, payload, nil
+}
+
+// Response sends the request and waits for a single response.
+func (builder *RequestBuilder) Response(ctx context.Context) (*Payload, error) {
+	ctx, cancel, payload, err := builder.build(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cancel()
+
+	return builder.requester.RequestResponse(ctx, payload)
+}
+
+// FireAndForget sends the request without response.
+func (builder *RequestBuilder) FireAndForget(ctx context.Context) error {
+	ctx, cancel, payload, err := builder.build(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer cancel()
+
+	return builder.requester.FireAndForget(ctx, payload)
+}
+
+// Stream sends the request and returns the response stream.
+func (builder *RequestBuilder) Stream(ctx context.Context) (*PayloadStream, error) {
+	ctx, cancel, payload, err := builder.build(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := builder.requester.RequestStream(ctx, payload)
+
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	stream.OnClose(func(error) { cancel() })
+
+	return stream, nil
+}
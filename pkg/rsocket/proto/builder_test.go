@@ -0,0 +1,146 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func matchInitialRequests(n uint32) FrameMatcher {
+	return func(f frame.Frame) bool {
+		request, ok := f.(*frame.RequestStreamFrame)
+
+		return ok && request.InitialRequests == n
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	Convey("Given a requester driven by a scripted responder", t, func() {
+		steps := []*ScriptStep{
+			Expect(MatchType(frame.TypeRequestResponse), MatchRoute("echo")).Respond(Text("pong")),
+			Expect(MatchType(frame.TypeRequestStream), MatchRoute("items"), matchInitialRequests(16)).Respond(Text("foo"), Text("bar")).Complete(),
+		}
+
+		runScripted(t, steps, func(ctx context.Context, requester *rSocketRequester) {
+			Convey("When build a request-response with a route and timeout", func() {
+				payload, err := requester.NewRequest().Payload(Text("ping")).Route("echo").Timeout(time.Second).Response(ctx)
+
+				Convey("Then the response should be received", func() {
+					So(err, ShouldBeNil)
+					So(payload, ShouldResemble, Text("pong"))
+
+					Convey("When build a stream with a route and custom prefetch", func() {
+						stream, err := requester.NewRequest().Payload(Text("list")).Route("items").InitialRequests(16).Stream(ctx)
+
+						So(err, ShouldBeNil)
+
+						Convey("Then the payloads should be received", func() {
+							var items []string
+
+							So(stream.ForEach(ctx, func(payload *Payload) error {
+								items = append(items, payload.Text())
+
+								return nil
+							}), ShouldBeNil)
+
+							So(items, ShouldResemble, []string{"foo", "bar"})
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestRequestBuilderWithRequestID(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithMetadataMimeType(frame.CompositeMetadataMimeType)).(*rSocketRequester)
+
+		Convey("When send a request with the request ID", func() {
+			So(requester.NewRequest().Payload(Text("ping")).WithRequestID("req-1").FireAndForget(ctx), ShouldBeNil)
+
+			Convey("Then the request ID should be read from the metadata", func() {
+				f, _ := requests.Recv(ctx)
+				request := f.(*frame.RequestFireAndForgetFrame)
+
+				So(request.HasMetadata(), ShouldBeTrue)
+				So(string(request.Data), ShouldEqual, "ping")
+
+				id, ok := RequestIDFromMetadata(request.Metadata)
+				So(ok, ShouldBeTrue)
+				So(id, ShouldEqual, "req-1")
+			})
+		})
+
+		Convey("When send a request with the route and the generated request ID", func() {
+			So(requester.NewRequest().Route("echo").WithRequestID("").FireAndForget(ctx), ShouldBeNil)
+
+			Convey("Then both the route and request ID should be in the composite metadata", func() {
+				f, _ := requests.Recv(ctx)
+				metadata := f.(*frame.RequestFireAndForgetFrame).Metadata
+
+				id, ok := RequestIDFromMetadata(metadata)
+				So(ok, ShouldBeTrue)
+				So(id, ShouldHaveLength, 36)
+				So(id[14], ShouldEqual, '4')
+
+				routing, ok := metadata.StringEntry(RoutingMimeType)
+				So(ok, ShouldBeTrue)
+
+				routes, err := DecodeRoutingMetadata(routing)
+				So(err, ShouldBeNil)
+				So(routes.Route(), ShouldEqual, "echo")
+			})
+		})
+
+		Convey("When send a request without request ID", func() {
+			So(requester.NewRequest().Payload(Text("ping")).FireAndForget(ctx), ShouldBeNil)
+
+			Convey("Then no request ID should be found", func() {
+				f, _ := requests.Recv(ctx)
+
+				_, ok := RequestIDFromMetadata(f.(*frame.RequestFireAndForgetFrame).Metadata)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestRequestBuilderWithMetadataMimeType(t *testing.T) {
+	Convey("Given a requester of the connection with routing metadata", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithMetadataMimeType(RoutingMimeType)).(*rSocketRequester)
+
+		Convey("When send a request with the route", func() {
+			So(requester.NewRequest().Route("echo").FireAndForget(ctx), ShouldBeNil)
+
+			Convey("Then the metadata should be the routing metadata", func() {
+				f, _ := requests.Recv(ctx)
+
+				routes, err := DecodeRoutingMetadata(f.(*frame.RequestFireAndForgetFrame).Metadata)
+				So(err, ShouldBeNil)
+				So(routes.Route(), ShouldEqual, "echo")
+			})
+		})
+
+		Convey("When send a request with the request ID", func() {
+			err := requester.NewRequest().Route("echo").WithRequestID("req-1").FireAndForget(ctx)
+
+			Convey("Then the request should be rejected", func() {
+				So(err, ShouldEqual, ErrRequestIDNotSupported)
+			})
+		})
+	})
+}
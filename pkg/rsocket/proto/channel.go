@@ -0,0 +1,86 @@
+package proto
+
+import (
+	"context"
+)
+
+// Transform maps a payload received from the channel, or fails the channel with the error.
+type Transform func(payload *Payload) (*Payload, error)
+
+// RequestChannelTransform requests a channel which sends the payloads from in until it closed,
+// and returns the responses mapped by the transform, or as is if the transform is nil.
+//
+// Both directions are driven by the goroutines, the channel is terminated once the responses terminated:
+// the responses fail with the error of the responder, the transform or sending the payloads,
+// and the payloads from in are no longer sent. The transform failure is told to the responder with an ERROR frame.
+// Cancelling the responses cancels the channel.
+func RequestChannelTransform(ctx context.Context, requester Requester, in <-chan *Payload, transform Transform) (*PayloadStream, error) {
+	channelCtx, cancel := context.WithCancel(ctx)
+
+	requests, sink := NewPayloadPipe(0)
+
+	go func() {
+		for {
+			select {
+			case <-channelCtx.Done():
+				return
+
+			case payload, ok := <-in:
+				if !ok {
+					sink.Close()
+
+					return
+				}
+
+				if payload == nil {
+					continue
+				}
+
+				if err := sink.Send(channelCtx, Ok(payload)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	responses, err := requester.RequestChannel(channelCtx, requests)
+
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	stream, results := NewPayloadPipe(0)
+	stream.OnClose(func(error) { cancel() })
+
+	go func() {
+		defer results.Close()
+
+		var failure error // The error of transform, which fails the channel.
+
+		err := responses.ForEach(channelCtx, func(payload *Payload) (err error) {
+			if transform != nil {
+				if payload, failure = transform(payload); failure != nil {
+					return failure
+				}
+			}
+
+			return results.Send(channelCtx, Ok(payload))
+		})
+
+		if failure != nil {
+			// The responder is told with an ERROR frame, which terminates both directions of the channel.
+			responses.CancelWithError(failure)
+		}
+
+		cancel()
+
+		if err != nil {
+			// The error is returned once the responses buffered received, which never blocks if the consumer gone.
+			stream.fail(err)
+		}
+	}()
+
+	return stream, nil
+}
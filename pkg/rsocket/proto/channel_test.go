@@ -0,0 +1,111 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestChannelTransform(t *testing.T) {
+	Convey("Given a channel requested with a transform", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		errTransform := errors.New("bad payload")
+		in := make(chan *Payload)
+
+		stream, err := RequestChannelTransform(ctx, requester, in, func(payload *Payload) (*Payload, error) {
+			if string(payload.Data) == "bad" {
+				return nil, errTransform
+			}
+
+			return Text(string(payload.Data) + "!"), nil
+		})
+		So(err, ShouldBeNil)
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestChannel, 0)
+
+		Convey("When the responses are transformed", func() {
+			So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+			Convey("Then the responses should be mapped", func() {
+				payload, err := stream.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload, ShouldResemble, Text("foo!"))
+			})
+		})
+
+		Convey("When the transform fails", func() {
+			So(requester.HandleFrame(ctx, Text("bad").buildPayloadFrame(1, false)), ShouldBeNil)
+
+			Convey("Then the responses should fail with the error", func() {
+				_, err := stream.Recv(ctx)
+				So(err, ShouldEqual, errTransform)
+			})
+
+			Convey("Then the responder should be told with an ERROR frame", func() {
+				f, err := requests.Recv(ctx)
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeError, 0)
+				So(f.(*frame.ErrorFrame).Err(), ShouldResemble, frame.ErrApplicationError.WithMessage("bad payload"))
+			})
+		})
+
+		Convey("When the consumer never receives the error", func() {
+			So(requester.HandleFrame(ctx, Text("bad").buildPayloadFrame(1, false)), ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeError, 0)
+
+			Convey("Then the channel should be terminated without blocking", func() {
+				<-stream.Context().Done()
+
+				_, ok := requester.findReceiver(1)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestRequestChannelFailedByPayloads(t *testing.T) {
+	Convey("Given a channel in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		payloads, sink := NewPayloadPipe(0)
+
+		responses, err := requester.RequestChannel(ctx, payloads)
+		So(err, ShouldBeNil)
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestChannel, 0)
+
+		Convey("When the payloads sent fail", func() {
+			errPayloads := errors.New("payloads failed")
+
+			So(sink.Send(ctx, Err(errPayloads)), ShouldBeNil)
+
+			Convey("Then the responder should be told with an ERROR frame", func() {
+				f, err := requests.Recv(ctx)
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeError, 0)
+			})
+
+			Convey("Then the responses should fail with the error", func() {
+				_, err := responses.Recv(ctx)
+				So(err, ShouldEqual, errPayloads)
+			})
+		})
+	})
+}
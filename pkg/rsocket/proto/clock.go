@@ -0,0 +1,74 @@
+package proto
+
+import "time"
+
+// Clock provides the time for the keepalive and lease timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a Timer fires once after the duration.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker creates a Ticker fires every period.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer sends the time on its channel once expired.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing, returns false if the timer has expired or been stopped.
+	Stop() bool
+}
+
+// Ticker sends the time on its channel at intervals.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// RealClock is the Clock based on the wall-clock time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (clock realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (clock realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (clock realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (timer realTimer) C() <-chan time.Time {
+	return timer.timer.C
+}
+
+func (timer realTimer) Stop() bool {
+	return timer.timer.Stop()
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (ticker realTicker) C() <-chan time.Time {
+	return ticker.ticker.C
+}
+
+func (ticker realTicker) Stop() {
+	ticker.ticker.Stop()
+}
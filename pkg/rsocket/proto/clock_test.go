@@ -0,0 +1,98 @@
+package proto
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock only moves forward when advanced, and fires the timers and tickers expired.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ Clock = (*fakeClock)(nil)
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) NewTimer(d time.Duration) Timer {
+	return clock.schedule(d, 0)
+}
+
+func (clock *fakeClock) NewTicker(d time.Duration) Ticker {
+	return &fakeTicker{clock.schedule(d, d)}
+}
+
+func (clock *fakeClock) schedule(d, period time.Duration) *fakeTimer {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	timer := &fakeTimer{clock, make(chan time.Time, 1), clock.now.Add(d), period, false}
+
+	clock.timers = append(clock.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward and fires the timers expired.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	clock.now = clock.now.Add(d)
+
+	for _, timer := range clock.timers {
+		for !timer.stopped && !timer.deadline.After(clock.now) {
+			select {
+			case timer.c <- clock.now:
+			default:
+			}
+
+			if timer.period > 0 {
+				timer.deadline = timer.deadline.Add(timer.period)
+			} else {
+				timer.stopped = true
+			}
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+	stopped  bool
+}
+
+func (timer *fakeTimer) C() <-chan time.Time {
+	return timer.c
+}
+
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.lock.Lock()
+	defer timer.clock.lock.Unlock()
+
+	stopped := timer.stopped
+	timer.stopped = true
+
+	return !stopped
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.fakeTimer.Stop()
+}
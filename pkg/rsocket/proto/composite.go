@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"errors"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// AuthenticationMimeType is the MIME type of the authentication metadata.
+const AuthenticationMimeType = "message/x.rsocket.authentication.v0"
+
+const bearerAuthID = 0x01 // The well-known authentication type ID of the bearer token.
+
+// ErrInvalidAuthentication is returned when decode a malformed or unsupported authentication metadata.
+var ErrInvalidAuthentication = errors.New("invalid authentication metadata")
+
+// CompositeMetadataBuilder appends the entries to a composite metadata in order,
+// e.g. the routing and authentication entries expected by a Spring RSocket server.
+type CompositeMetadataBuilder struct {
+	metadata Metadata
+	err      error
+}
+
+// NewCompositeMetadata creates a CompositeMetadataBuilder without entry.
+func NewCompositeMetadata() *CompositeMetadataBuilder {
+	return new(CompositeMetadataBuilder)
+}
+
+// Entry appends the entry with the MIME type and content.
+func (builder *CompositeMetadataBuilder) Entry(mime string, content []byte) *CompositeMetadataBuilder {
+	if builder.err == nil {
+		builder.metadata, builder.err = builder.metadata.AppendEntry(mime, content)
+	}
+
+	return builder
+}
+
+// Route appends the routing entry with the tags.
+func (builder *CompositeMetadataBuilder) Route(tags ...string) *CompositeMetadataBuilder {
+	routing, err := NewRoutingMetadata(tags...).Encode()
+
+	if err != nil {
+		if builder.err == nil {
+			builder.err = err
+		}
+
+		return builder
+	}
+
+	return builder.Entry(RoutingMimeType, routing)
+}
+
+// BearerAuth appends the authentication entry with the bearer token.
+func (builder *CompositeMetadataBuilder) BearerAuth(token string) *CompositeMetadataBuilder {
+	return builder.Entry(AuthenticationMimeType, append([]byte{frame.WellKnownMimeFlag | bearerAuthID}, token...))
+}
+
+// Build returns the composite metadata, or the first error of the entries appended.
+func (builder *CompositeMetadataBuilder) Build() (Metadata, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	return builder.metadata, nil
+}
+
+// DecodeBearerAuth decodes the bearer token from the content of authentication entry.
+func DecodeBearerAuth(content []byte) (string, error) {
+	if len(content) == 0 || content[0] != frame.WellKnownMimeFlag|bearerAuthID {
+		return "", ErrInvalidAuthentication
+	}
+
+	return string(content[1:]), nil
+}
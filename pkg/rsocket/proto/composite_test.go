@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompositeMetadataBuilder(t *testing.T) {
+	Convey("Given a composite metadata with routing and bearer authentication", t, func() {
+		metadata, err := NewCompositeMetadata().Route("orders").BearerAuth("secret").Build()
+		So(err, ShouldBeNil)
+
+		Convey("Then the entries should be encoded with the well-known MIME type IDs in order", func() {
+			So([]byte(metadata), ShouldResemble, []byte{
+				0xFE, 0x00, 0x00, 0x07, 0x06, 'o', 'r', 'd', 'e', 'r', 's',
+				0xFC, 0x00, 0x00, 0x07, 0x81, 's', 'e', 'c', 'r', 'e', 't',
+			})
+		})
+
+		Convey("When decode the entries", func() {
+			routing, ok := metadata.StringEntry(RoutingMimeType)
+			So(ok, ShouldBeTrue)
+
+			auth, ok := metadata.StringEntry(AuthenticationMimeType)
+			So(ok, ShouldBeTrue)
+
+			Convey("Then both the routing tags and bearer token should be recovered", func() {
+				tags, err := DecodeRoutingMetadata(routing)
+				So(err, ShouldBeNil)
+				So(tags, ShouldResemble, NewRoutingMetadata("orders"))
+
+				token, err := DecodeBearerAuth(auth)
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "secret")
+			})
+		})
+	})
+
+	Convey("Given a composite metadata with an invalid routing tag", t, func() {
+		_, err := NewCompositeMetadata().Route(strings.Repeat("x", 256)).BearerAuth("secret").Build()
+
+		Convey("Then it should fail to build", func() {
+			So(err, ShouldEqual, ErrInvalidRouting)
+		})
+	})
+}
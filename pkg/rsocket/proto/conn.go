@@ -3,14 +3,13 @@ package proto
 import (
 	"context"
 	"io"
+	"sync"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
 )
 
 // FrameSender sends frame.
 type FrameSender interface {
-	io.Closer
-
 	// Sends the Frame on this connection and returns the result of this send.
 	Send(ctx context.Context, frame frame.Frame) error
 }
@@ -25,40 +24,84 @@ type FrameHandler interface {
 	HandleFrame(ctx context.Context, f frame.Frame) error
 }
 
-type FrameChan chan frame.Frame
+// FrameChan is an in-memory connection backed by a channel of frames.
+type FrameChan struct {
+	C chan frame.Frame
+
+	lock    sync.Mutex
+	closed  bool
+	done    chan struct{} // Closed once the FrameChan is closing.
+	sending sync.WaitGroup
+}
+
+var _ FrameSender = (*FrameChan)(nil)
+var _ FrameReceiver = (*FrameChan)(nil)
 
-var _ FrameSender = FrameChan(nil)
-var _ FrameReceiver = FrameChan(nil)
+// NewFrameChan creates a FrameChan buffers up to size frames.
+func NewFrameChan(size int) *FrameChan {
+	return &FrameChan{C: make(chan frame.Frame, size), done: make(chan struct{})}
+}
+
+// Close the channel, the pending sends return ErrClosed before the channel closed.
+func (c *FrameChan) Close() error {
+	c.lock.Lock()
+
+	if c.closed {
+		c.lock.Unlock()
+
+		return nil
+	}
 
-// Close the thanncel
-func (c FrameChan) Close() error {
-	close(c)
+	c.closed = true
+	close(c.done)
+	c.lock.Unlock()
+
+	c.sending.Wait()
+
+	close(c.C)
 
 	return nil
 }
 
-// Send frame to channel
-func (c FrameChan) Send(ctx context.Context, frame frame.Frame) error {
+// Send frame to channel, returns ErrClosed if the channel closed before or while sending.
+func (c *FrameChan) Send(ctx context.Context, frame frame.Frame) error {
+	c.lock.Lock()
+
+	if c.closed {
+		c.lock.Unlock()
+
+		return ErrClosed
+	}
+
+	c.sending.Add(1)
+	c.lock.Unlock()
+
+	defer c.sending.Done()
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case c <- frame:
+	case <-c.done:
+		return ErrClosed
+	case c.C <- frame:
 		return nil
 	}
 }
 
 // Recv frame from channel
-func (c FrameChan) Recv(ctx context.Context) (frame.Frame, error) {
+func (c *FrameChan) Recv(ctx context.Context) (frame.Frame, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
-	case frame := <-c:
+	case frame := <-c.C:
 		return frame, nil
 	}
 }
 
 // Conn is a generic frame-oriented network connection.
 type Conn interface {
+	io.Closer
+
 	FrameSender
 
 	FrameReceiver
@@ -0,0 +1,516 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"go.uber.org/zap"
+)
+
+const defaultSendQueueSize = 128
+
+// ErrClosed is returned when send frames on a closed connection.
+var ErrClosed = errors.New("connection closed")
+
+// ErrDuplicateSetup is returned when a SETUP frame exchanged after the connection established.
+var ErrDuplicateSetup = frame.ErrConnectionError.WithMessage("duplicate SETUP frame")
+
+// Flusher is implemented by the Conn which buffers the frames.
+type Flusher interface {
+	// Flush writes the buffered frames to the underlying transport.
+	Flush() error
+}
+
+// QueueFlusher is implemented by the FrameSender which queues the frames, e.g. Connection.
+type QueueFlusher interface {
+	// Flush waits the queued frames written and flushed to the underlying transport.
+	Flush(ctx context.Context) error
+}
+
+var _ QueueFlusher = (*Connection)(nil)
+
+// ConnectionState is the state of a Connection.
+type ConnectionState int32
+
+const (
+	// StateConnecting is the state before SETUP or RESUME frame exchanged.
+	StateConnecting ConnectionState = iota
+	// StateSetup is the state after SETUP frame exchanged, and before the connection accepted.
+	StateSetup
+	// StateConnected is the state after the connection accepted.
+	StateConnected
+	// StateResuming is the state after RESUME frame exchanged, and before RESUME_OK frame exchanged.
+	StateResuming
+	// StateClosing is the state after the connection starts closing, and before the queued frames written.
+	StateClosing
+	// StateClosed is the state after the connection closed.
+	StateClosed
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case StateConnecting:
+		return "CONNECTING"
+	case StateSetup:
+		return "SETUP"
+	case StateConnected:
+		return "CONNECTED"
+	case StateResuming:
+		return "RESUMING"
+	case StateClosing:
+		return "CLOSING"
+	case StateClosed:
+		return "CLOSED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// StateListener is called when the state of Connection changed.
+type StateListener func(from, to ConnectionState)
+
+// ShutdownStage orders the components stopped when the Connection closing.
+type ShutdownStage int
+
+const (
+	// ShutdownStreams stops the requester and responder, which cancel or complete their streams.
+	ShutdownStreams ShutdownStage = iota
+	// ShutdownKeepalive stops the keepalive after the streams stopped.
+	ShutdownKeepalive
+
+	shutdownStages
+)
+
+// Connection queues the frames sent by the requester and responder,
+// and writes them to the underlying Conn in order.
+//
+// The control frames jump ahead of the queued data frames, so the cancellation and flow control
+// are not stuck behind a backlog of large payloads, unless the stream has frames queued,
+// e.g. the CANCEL never overtakes the request it cancels.
+type Connection struct {
+	*zap.Logger
+	conn        Conn
+	queue       chan *outbound
+	urgent      chan *outbound // The control frames written ahead of the queue.
+	pendingLock sync.Mutex
+	pending     map[StreamID]int // The frames of the streams queued but not written yet.
+	lock        sync.RWMutex
+	closed      bool
+	closing     chan struct{}
+	drained     chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	err         error
+
+	state     int32
+	stateLock sync.Mutex
+	listeners []StateListener
+
+	shutdownLock sync.Mutex
+	shutdowns    [shutdownStages][]func() error
+	aborters     []Aborter // Fail their streams with the error once the connection closed with an error.
+}
+
+var (
+	_ FrameSender   = (*Connection)(nil)
+	_ FrameReceiver = (*Connection)(nil)
+)
+
+type outbound struct {
+	frame   frame.Frame
+	flushed chan error
+	queued  bool // The frame is counted in the pending frames of its stream.
+}
+
+// NewConnection creates a Connection writes frames to the Conn.
+func NewConnection(logger *zap.Logger, conn Conn) *Connection {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	connection := &Connection{
+		Logger:  logger.Named("conn"),
+		conn:    conn,
+		queue:   make(chan *outbound, defaultSendQueueSize),
+		urgent:  make(chan *outbound, defaultSendQueueSize),
+		pending: make(map[StreamID]int),
+		closing: make(chan struct{}),
+		drained: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	go connection.writeFrames()
+
+	return connection
+}
+
+func (connection *Connection) writeFrames() {
+	defer close(connection.drained)
+
+	for {
+		select {
+		case out := <-connection.urgent:
+			connection.write(out)
+
+			continue
+		default:
+		}
+
+		select {
+		case out := <-connection.urgent:
+			connection.write(out)
+
+		case out := <-connection.queue:
+			connection.write(out)
+
+		case <-connection.closing:
+			for {
+				select {
+				case out := <-connection.urgent:
+					connection.write(out)
+
+					continue
+				default:
+				}
+
+				select {
+				case out := <-connection.queue:
+					connection.write(out)
+				default:
+					connection.flush()
+
+					return
+				}
+			}
+		}
+	}
+}
+
+// isControl indicates the frame is a control frame written ahead of the data frames,
+// the ERROR frame of a stream is not, so it never overtakes the payloads of the stream.
+func isControl(f frame.Frame) bool {
+	switch f.Type() {
+	case frame.TypeCancel, frame.TypeKeepalive, frame.TypeRequestN:
+		return true
+	case frame.TypeError:
+		return f.StreamID() == 0
+	default:
+		return false
+	}
+}
+
+func (connection *Connection) write(out *outbound) {
+	if out.flushed != nil {
+		out.flushed <- connection.flush()
+
+		return
+	}
+
+	if out.queued {
+		connection.dequeued(out.frame.StreamID())
+	}
+
+	if connection.err != nil {
+		return
+	}
+
+	if err := connection.conn.Send(connection.ctx, out.frame); err != nil {
+		connection.Warn("send frame failed", zap.Stringer("type", out.frame.Type()), zap.Error(err))
+
+		connection.err = err
+	}
+}
+
+func (connection *Connection) flush() error {
+	if connection.err != nil {
+		return connection.err
+	}
+
+	if flusher, ok := connection.conn.(Flusher); ok {
+		connection.err = flusher.Flush()
+	}
+
+	return connection.err
+}
+
+func (connection *Connection) enqueue(ctx context.Context, out *outbound) error {
+	connection.lock.RLock()
+	defer connection.lock.RUnlock()
+
+	if connection.closed {
+		return ErrClosed
+	}
+
+	queue := connection.queue
+
+	if out.frame != nil {
+		if connection.prioritize(out.frame) {
+			queue = connection.urgent
+		} else {
+			out.queued = true
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		if out.queued {
+			connection.dequeued(out.frame.StreamID())
+		}
+
+		return ctx.Err()
+	case queue <- out:
+		return nil
+	}
+}
+
+// prioritize decides the frame is written ahead of the queue, or counts it in the pending frames of its stream,
+// the control frames of a stream keep in order with the frames queued before, e.g. the request it cancels.
+func (connection *Connection) prioritize(f frame.Frame) bool {
+	streamID := f.StreamID()
+
+	connection.pendingLock.Lock()
+	defer connection.pendingLock.Unlock()
+
+	if isControl(f) && (streamID == 0 || connection.pending[streamID] == 0) {
+		return true
+	}
+
+	if streamID != 0 {
+		connection.pending[streamID]++
+	}
+
+	return false
+}
+
+// dequeued uncounts a frame of the stream from the pending frames once it written or abandoned.
+func (connection *Connection) dequeued(streamID StreamID) {
+	if streamID == 0 {
+		return
+	}
+
+	connection.pendingLock.Lock()
+	defer connection.pendingLock.Unlock()
+
+	if n := connection.pending[streamID]; n > 1 {
+		connection.pending[streamID] = n - 1
+	} else {
+		delete(connection.pending, streamID)
+	}
+}
+
+// State returns the current state of the connection.
+func (connection *Connection) State() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(&connection.state))
+}
+
+// OnStateChange registers a listener which be called on each state transition in order,
+// the listener must not register another listener.
+func (connection *Connection) OnStateChange(listener StateListener) {
+	connection.stateLock.Lock()
+	defer connection.stateLock.Unlock()
+
+	connection.listeners = append(connection.listeners, listener)
+}
+
+func (connection *Connection) transit(to ConnectionState, allowed ...ConnectionState) {
+	connection.stateLock.Lock()
+	defer connection.stateLock.Unlock()
+
+	from := connection.State()
+
+	if from == to {
+		return
+	}
+
+	for _, state := range allowed {
+		if from == state {
+			atomic.StoreInt32(&connection.state, int32(to))
+
+			connection.Debug("state changed", zap.Stringer("from", from), zap.Stringer("to", to))
+
+			for _, listener := range connection.listeners {
+				listener(from, to)
+			}
+
+			return
+		}
+	}
+}
+
+// exchanged changes the state with the frame sent or received.
+func (connection *Connection) exchanged(f frame.Frame) {
+	switch f.Type() {
+	case frame.TypeSetup:
+		connection.transit(StateSetup, StateConnecting)
+
+	case frame.TypeResume:
+		connection.transit(StateResuming, StateConnecting, StateConnected)
+
+	case frame.TypeResumeOk:
+		connection.transit(StateConnected, StateResuming)
+
+	case frame.TypeError:
+		if f.StreamID() != 0 {
+			connection.transit(StateConnected, StateSetup)
+		}
+
+	default:
+		connection.transit(StateConnected, StateSetup)
+	}
+}
+
+func (connection *Connection) isDuplicateSetup(f frame.Frame) bool {
+	return f.Type() == frame.TypeSetup && connection.State() != StateConnecting
+}
+
+// Send queues the frame to be written to the connection.
+func (connection *Connection) Send(ctx context.Context, f frame.Frame) (err error) {
+	if connection.isDuplicateSetup(f) {
+		return ErrDuplicateSetup
+	}
+
+	if err = connection.enqueue(ctx, &outbound{frame: f}); err == nil {
+		connection.exchanged(f)
+	}
+
+	return
+}
+
+// Recv returns a Frame received on the connection.
+//
+// The connection is closed with CONNECTION_ERROR if a SETUP frame received after the connection established.
+func (connection *Connection) Recv(ctx context.Context) (f frame.Frame, err error) {
+	if f, err = connection.conn.Recv(ctx); err != nil || f == nil {
+		return
+	}
+
+	if connection.isDuplicateSetup(f) {
+		connection.Warn("reject duplicate SETUP frame", zap.Stringer("state", connection.State()))
+
+		if err = connection.Send(ctx, frame.NewErrorFrame(0, ErrDuplicateSetup.Code, ErrDuplicateSetup.Data)); err == nil {
+			err = connection.Close(ctx)
+		}
+
+		if err != nil {
+			connection.Warn("close connection failed", zap.Error(err))
+		}
+
+		return nil, ErrDuplicateSetup
+	}
+
+	connection.exchanged(f)
+
+	return
+}
+
+// Flush waits the queued frames be written to the connection.
+func (connection *Connection) Flush(ctx context.Context) error {
+	flushed := make(chan error, 1)
+
+	if err := connection.enqueue(ctx, &outbound{flushed: flushed}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-flushed:
+		return err
+	}
+}
+
+// OnShutdown registers a function called in the stage when the connection closing,
+// the functions of a stage are called in the registration order.
+func (connection *Connection) OnShutdown(stage ShutdownStage, fn func() error) {
+	connection.shutdownLock.Lock()
+	defer connection.shutdownLock.Unlock()
+
+	connection.shutdowns[stage] = append(connection.shutdowns[stage], fn)
+}
+
+// OnAbort registers an Aborter which fails its streams in progress with the error
+// once the connection closed with CloseWithError, before the functions registered with OnShutdown called.
+func (connection *Connection) OnAbort(aborter Aborter) {
+	connection.shutdownLock.Lock()
+	defer connection.shutdownLock.Unlock()
+
+	connection.aborters = append(connection.aborters, aborter)
+}
+
+func (connection *Connection) abort(ctx context.Context, err error) {
+	connection.shutdownLock.Lock()
+	aborters := connection.aborters
+	connection.shutdownLock.Unlock()
+
+	for _, aborter := range aborters {
+		aborter.Abort(ctx, err)
+	}
+}
+
+func (connection *Connection) shutdown() {
+	connection.shutdownLock.Lock()
+	shutdowns := connection.shutdowns
+	connection.shutdownLock.Unlock()
+
+	for stage, fns := range shutdowns {
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				connection.Warn("shutdown failed", zap.Int("stage", stage), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close tears down the connection in order:
+// stops sending new frames, stops the streams and keepalive registered with OnShutdown,
+// then closes the underlying Conn after the queued frames be written.
+//
+// The queued frames are dropped if the context done before them written.
+func (connection *Connection) Close(ctx context.Context) (err error) {
+	connection.lock.Lock()
+	closed := connection.closed
+	connection.closed = true
+	connection.lock.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	connection.transit(StateClosing, StateConnecting, StateSetup, StateConnected, StateResuming)
+
+	connection.shutdown()
+
+	close(connection.closing)
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-connection.drained:
+		err = connection.err
+	}
+
+	connection.cancel()
+
+	if closeErr := connection.conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	connection.transit(StateClosed, StateClosing)
+
+	return
+}
+
+// CloseWithError tells the peer why the connection closed with an ERROR frame on stream 0,
+// e.g. CONNECTION_CLOSE or CONNECTION_ERROR, fails the streams of the Aborters registered with OnAbort with the error,
+// then tears down the connection as Close.
+func (connection *Connection) CloseWithError(ctx context.Context, err *Error) error {
+	if sendErr := connection.Send(ctx, frame.NewErrorFrame(0, err.Code, err.Data)); sendErr != nil {
+		return sendErr
+	}
+
+	connection.abort(ctx, err)
+
+	return connection.Close(ctx)
+}
@@ -0,0 +1,541 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// bufferedConn buffers the sent frames until flushed to the wire.
+type bufferedConn struct {
+	lock     sync.Mutex
+	delay    time.Duration
+	buffered []frame.Frame
+	wire     []frame.Frame
+	closed   bool
+}
+
+var _ Flusher = (*bufferedConn)(nil)
+
+func (conn *bufferedConn) Send(ctx context.Context, f frame.Frame) error {
+	time.Sleep(conn.delay)
+
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	if conn.closed {
+		return errors.New("use of closed connection")
+	}
+
+	conn.buffered = append(conn.buffered, f)
+
+	return nil
+}
+
+func (conn *bufferedConn) Recv(ctx context.Context) (frame.Frame, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func (conn *bufferedConn) Flush() error {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	conn.wire = append(conn.wire, conn.buffered...)
+	conn.buffered = nil
+
+	return nil
+}
+
+func (conn *bufferedConn) Close() error {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	conn.closed = true
+
+	return nil
+}
+
+func (conn *bufferedConn) Wire() []frame.Frame {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	return conn.wire
+}
+
+func TestConnectionCloseFlushesFrames(t *testing.T) {
+	Convey("Given a requester sends frames on a slow connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &bufferedConn{delay: 10 * time.Millisecond}
+		connection := NewConnection(logger, conn)
+		requester := NewRequester(logger, connection, ClientStreamIDs(), initReqs)
+
+		Convey("When send FNF and close the connection immediately", func() {
+			So(requester.FireAndForget(ctx, Text("foo")), ShouldBeNil)
+			So(requester.FireAndForget(ctx, Text("bar")), ShouldBeNil)
+			So(connection.Close(ctx), ShouldBeNil)
+
+			Convey("Then the FNF frames should be written to the wire before closed", func() {
+				wire := conn.Wire()
+
+				So(wire, ShouldHaveLength, 2)
+				checkFrameHeader(wire[0], 1, frame.TypeRequestFireAndForget, 0)
+				checkFrameHeader(wire[1], 3, frame.TypeRequestFireAndForget, 0)
+				So(conn.closed, ShouldBeTrue)
+			})
+
+			Convey("Then the frames sent after closed should be rejected", func() {
+				So(requester.FireAndForget(ctx, Text("baz")), ShouldEqual, ErrClosed)
+				So(connection.Close(ctx), ShouldEqual, ErrClosed)
+			})
+		})
+
+		Convey("When flush the connection", func() {
+			So(requester.FireAndForget(ctx, Text("foo")), ShouldBeNil)
+			So(connection.Flush(ctx), ShouldBeNil)
+
+			Convey("Then the queued frames should be written to the wire", func() {
+				So(conn.Wire(), ShouldHaveLength, 1)
+				So(connection.Close(ctx), ShouldBeNil)
+			})
+		})
+	})
+}
+
+// receivingConn receives the frames from a channel.
+type receivingConn struct {
+	*bufferedConn
+	received *FrameChan
+}
+
+func (conn *receivingConn) Recv(ctx context.Context) (frame.Frame, error) {
+	return conn.received.Recv(ctx)
+}
+
+type transition struct {
+	from, to ConnectionState
+}
+
+func TestConnectionStateTransitions(t *testing.T) {
+	Convey("Given a connection on the client side", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := NewFrameChan(1)
+		conn := &receivingConn{&bufferedConn{}, received}
+		connection := NewConnection(logger, conn)
+
+		var transitions []transition
+
+		connection.OnStateChange(func(from, to ConnectionState) {
+			transitions = append(transitions, transition{from, to})
+		})
+
+		So(connection.State(), ShouldEqual, StateConnecting)
+
+		Convey("When connect then close the connection", func() {
+			So(connection.Send(ctx, frame.NewSetupFrame(frame.V1, false, time.Second, time.Minute, nil, "", "", false, nil, nil)), ShouldBeNil)
+			So(connection.State(), ShouldEqual, StateSetup)
+
+			So(received.Send(ctx, frame.NewKeepaliveFrame(false, 0, nil)), ShouldBeNil)
+			_, err := connection.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(connection.State(), ShouldEqual, StateConnected)
+
+			So(connection.Close(ctx), ShouldBeNil)
+
+			Convey("Then the state should transit in the lifecycle order", func() {
+				So(connection.State(), ShouldEqual, StateClosed)
+				So(transitions, ShouldResemble, []transition{
+					{StateConnecting, StateSetup},
+					{StateSetup, StateConnected},
+					{StateConnected, StateClosing},
+					{StateClosing, StateClosed},
+				})
+			})
+		})
+	})
+}
+
+func TestConnectionRejectsDuplicateSetup(t *testing.T) {
+	Convey("Given an established connection on the server side", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := NewFrameChan(2)
+		conn := &receivingConn{&bufferedConn{}, received}
+		connection := NewConnection(logger, conn)
+
+		setup := frame.NewSetupFrame(frame.V1, false, time.Second, time.Minute, nil, "", "", false, nil, nil)
+
+		So(received.Send(ctx, setup), ShouldBeNil)
+		_, err := connection.Recv(ctx)
+		So(err, ShouldBeNil)
+		So(connection.Send(ctx, frame.NewKeepaliveFrame(false, 0, nil)), ShouldBeNil)
+		So(connection.State(), ShouldEqual, StateConnected)
+
+		Convey("When receive a second SETUP frame", func() {
+			So(received.Send(ctx, setup), ShouldBeNil)
+			f, err := connection.Recv(ctx)
+
+			Convey("Then the connection should be closed with CONNECTION_ERROR", func() {
+				So(f, ShouldBeNil)
+				So(err, ShouldEqual, ErrDuplicateSetup)
+				So(connection.State(), ShouldEqual, StateClosed)
+
+				wire := conn.Wire()
+				So(wire, ShouldHaveLength, 2)
+				checkFrameHeader(wire[1], 0, frame.TypeError, 0)
+				So(wire[1].(*frame.ErrorFrame).Code, ShouldEqual, frame.ErrConnectionError)
+			})
+		})
+
+		Convey("When send a second SETUP frame", func() {
+			Convey("Then the frame should be rejected", func() {
+				So(connection.Send(ctx, setup), ShouldEqual, ErrDuplicateSetup)
+			})
+		})
+	})
+}
+
+func TestConnectionShutdownOrder(t *testing.T) {
+	Convey("Given a connection with keepalive and requests in flight", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		// The frames sent are drained until the FrameChan closed.
+		conn := NewFrameChan(0)
+
+		go func() {
+			for range conn.C {
+			}
+		}()
+
+		clock := newFakeClock()
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Millisecond, time.Hour, nil, clock, nil, nil})
+		connection := NewConnection(logger, keepaliveConn)
+		requester := NewRequester(logger, connection, ClientStreamIDs(), initReqs)
+
+		var lock sync.Mutex
+		var stages []string
+
+		shutdown := func(stage string, fn func() error) func() error {
+			return func() error {
+				lock.Lock()
+				stages = append(stages, stage)
+				lock.Unlock()
+
+				return fn()
+			}
+		}
+
+		connection.OnShutdown(ShutdownKeepalive, shutdown("keepalive", keepaliveConn.Stop))
+		connection.OnShutdown(ShutdownStreams, shutdown("streams", requester.Close))
+
+		go keepaliveConn.Serve(ctx)
+
+		ticking := make(chan struct{})
+
+		go func() {
+			for {
+				select {
+				case <-ticking:
+					return
+				default:
+					clock.Advance(time.Millisecond)
+				}
+			}
+		}()
+
+		Convey("When close the connection during concurrent requests", func() {
+			var wg sync.WaitGroup
+			var streamsLock sync.Mutex
+			var streams []*PayloadStream
+			errs := make(chan error, 256)
+
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for j := 0; j < 16; j++ {
+						if err := requester.FireAndForget(ctx, Text("foo")); err != nil {
+							errs <- err
+						}
+
+						stream, err := requester.RequestStream(ctx, Text("bar"))
+
+						if err != nil {
+							errs <- err
+						} else {
+							streamsLock.Lock()
+							streams = append(streams, stream)
+							streamsLock.Unlock()
+						}
+					}
+				}()
+			}
+
+			time.Sleep(time.Millisecond)
+
+			err := connection.Close(ctx)
+
+			wg.Wait()
+			close(ticking)
+			close(errs)
+
+			Convey("Then the connection should be torn down in order", func() {
+				So(err, ShouldBeNil)
+				So(connection.State(), ShouldEqual, StateClosed)
+				So(stages, ShouldResemble, []string{"streams", "keepalive"})
+
+				for err := range errs {
+					So(err, ShouldEqual, ErrClosed)
+				}
+
+				for _, stream := range streams {
+					done := make(chan error, 1)
+
+					stream.OnClose(func(err error) {
+						done <- err
+					})
+
+					So(<-done, ShouldEqual, context.Canceled)
+				}
+			})
+		})
+	})
+}
+
+// gatedConn blocks the sending until the gate opened.
+type gatedConn struct {
+	*bufferedConn
+	gate chan struct{}
+}
+
+func (conn *gatedConn) Send(ctx context.Context, f frame.Frame) error {
+	<-conn.gate
+
+	return conn.bufferedConn.Send(ctx, f)
+}
+
+func TestConnectionPrioritizesControlFrames(t *testing.T) {
+	Convey("Given a connection with a backlog of PAYLOAD frames", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &gatedConn{&bufferedConn{}, make(chan struct{})}
+		connection := NewConnection(logger, conn)
+		defer connection.Close(ctx)
+
+		for i := 0; i < 10; i++ {
+			So(connection.Send(ctx, Text("data").buildPayloadFrame(1, false)), ShouldBeNil)
+		}
+
+		Convey("When send a CANCEL frame", func() {
+			So(connection.Send(ctx, frame.NewCancelFrame(3)), ShouldBeNil)
+
+			close(conn.gate)
+
+			So(connection.Flush(ctx), ShouldBeNil)
+
+			Convey("Then the CANCEL frame should be written ahead of the queued PAYLOAD frames", func() {
+				wire := conn.Wire()
+				So(wire, ShouldHaveLength, 11)
+
+				// The first PAYLOAD frame may be in flight before the CANCEL frame queued.
+				var cancelled int
+
+				for i, f := range wire {
+					if f.Type() == frame.TypeCancel {
+						cancelled = i
+					}
+				}
+
+				So(cancelled, ShouldBeLessThanOrEqualTo, 1)
+			})
+		})
+	})
+}
+
+func TestConnectionKeepsControlFramesInStreamOrder(t *testing.T) {
+	Convey("Given a connection with a backlog of PAYLOAD frames", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &gatedConn{&bufferedConn{}, make(chan struct{})}
+		connection := NewConnection(logger, conn)
+		defer connection.Close(ctx)
+
+		for i := 0; i < 10; i++ {
+			So(connection.Send(ctx, Text("data").buildPayloadFrame(1, false)), ShouldBeNil)
+		}
+
+		Convey("When send a CANCEL frame right behind its own REQUEST", func() {
+			So(connection.Send(ctx, Text("hello").buildRequestStreamFrame(3, false, initReqs)), ShouldBeNil)
+			So(connection.Send(ctx, frame.NewCancelFrame(3)), ShouldBeNil)
+
+			close(conn.gate)
+
+			So(connection.Flush(ctx), ShouldBeNil)
+
+			Convey("Then the CANCEL frame should be written after the REQUEST", func() {
+				wire := conn.Wire()
+				So(wire, ShouldHaveLength, 12)
+
+				checkFrameHeader(wire[10], 3, frame.TypeRequestStream, 0)
+				checkFrameHeader(wire[11], 3, frame.TypeCancel, 0)
+			})
+
+			Convey("Then no frame of the stream should be pending once written", func() {
+				connection.pendingLock.Lock()
+				defer connection.pendingLock.Unlock()
+
+				So(connection.pending, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestMetadataPushSyncFlushesConnection(t *testing.T) {
+	Convey("Given a requester sends frames on a buffered connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &bufferedConn{delay: 10 * time.Millisecond}
+		connection := NewConnection(logger, conn)
+		defer connection.Close(ctx)
+
+		requester := NewRequester(logger, connection, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When push metadata and wait it flushed", func() {
+			So(requester.MetadataPushSync(ctx, Metadata("config")), ShouldBeNil)
+
+			Convey("Then the METADATA_PUSH frame should be on the wire before returned", func() {
+				wire := conn.Wire()
+
+				So(wire, ShouldHaveLength, 1)
+				checkFrameHeader(wire[0], 0, frame.TypeMetadataPush, frame.FlagMetadata)
+				So(wire[0].(*frame.MetadataPushFrame).Metadata, ShouldResemble, Metadata("config"))
+			})
+		})
+	})
+}
+
+func TestConnectionCloseWithError(t *testing.T) {
+	Convey("Given a connection with requests in flight", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &bufferedConn{}
+		connection := NewConnection(logger, conn)
+		requester := NewRequester(logger, connection, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		connection.OnAbort(requester)
+		connection.OnShutdown(ShutdownStreams, requester.Close)
+
+		result := make(chan error, 1)
+
+		go func() {
+			_, err := requester.RequestResponse(ctx, Text("hello"))
+
+			result <- err
+		}()
+
+		stream, err := requester.RequestStream(ctx, Text("world"))
+		So(err, ShouldBeNil)
+
+		So(connection.Flush(ctx), ShouldBeNil)
+
+		for len(requester.ActiveStreams()) < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		Convey("When close the connection with CONNECTION_CLOSE", func() {
+			reason := frame.ErrConnectionClose.WithMessage("going away")
+
+			So(connection.CloseWithError(ctx, reason), ShouldBeNil)
+
+			Convey("Then the peer should be told the reason with an ERROR frame on stream 0", func() {
+				wire := conn.wire
+
+				checkFrameHeader(wire[len(wire)-1], 0, frame.TypeError, 0)
+				So(wire[len(wire)-1].(*frame.ErrorFrame).Error, ShouldResemble, reason)
+				So(conn.closed, ShouldBeTrue)
+				So(connection.State(), ShouldEqual, StateClosed)
+			})
+
+			Convey("Then the requests in flight should fail with the connection error", func() {
+				So(<-result, ShouldEqual, reason)
+
+				_, err := stream.Recv(ctx)
+				So(err, ShouldEqual, reason)
+			})
+		})
+	})
+}
+
+func TestConnectionCloseWithErrorWhileReceiving(t *testing.T) {
+	Convey("Given a connection with a stream receiving payloads", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &bufferedConn{}
+		connection := NewConnection(logger, conn)
+		requester := NewRequester(logger, connection, ClientStreamIDs(), initReqs)
+
+		connection.OnAbort(requester.(Aborter))
+		connection.OnShutdown(ShutdownStreams, requester.Close)
+
+		stream, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		handled := make(chan struct{})
+
+		go func() {
+			defer close(handled)
+
+			// The read loop keeps delivering the payloads while the connection closing.
+			for i := 0; i < 1000; i++ {
+				if err := requester.(FrameHandler).HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)); err != nil {
+					return
+				}
+			}
+		}()
+
+		consumed := make(chan error, 1)
+
+		go func() {
+			for {
+				payload, err := stream.Recv(ctx)
+
+				if err != nil || payload == nil {
+					consumed <- err
+
+					return
+				}
+			}
+		}()
+
+		Convey("When close the connection with an error concurrently", func() {
+			reason := frame.ErrConnectionError.WithMessage("shutdown")
+
+			So(connection.CloseWithError(ctx, reason), ShouldBeNil)
+
+			<-handled
+
+			Convey("Then the stream should fail with the connection error without panic", func() {
+				So(<-consumed, ShouldEqual, reason)
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+)
+
+const recordLengthSize = 4
+
+// ErrInvalidRecord is returned when split a malformed length-prefixed record.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// Splitter splits the data of a payload carrying batched items into the data of each item.
+type Splitter func(data []byte) ([][]byte, error)
+
+// SplitLines splits the newline-delimited items, the trailing newline is optional.
+func SplitLines(data []byte) ([][]byte, error) {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return bytes.Split(data, []byte("\n")), nil
+}
+
+// SplitLengthPrefixed splits the items prefixed with the length as uint32 in big-endian.
+func SplitLengthPrefixed(data []byte) (items [][]byte, err error) {
+	for len(data) > 0 {
+		if len(data) < recordLengthSize {
+			return nil, ErrInvalidRecord
+		}
+
+		n := binary.BigEndian.Uint32(data)
+		data = data[recordLengthSize:]
+
+		if uint64(n) > uint64(len(data)) {
+			return nil, ErrInvalidRecord
+		}
+
+		items = append(items, data[:n])
+		data = data[n:]
+	}
+
+	return
+}
+
+// Demultiplex returns a PayloadStream delivers the items split from each payload of the stream,
+// the items share the metadata of the payload carrying them.
+//
+// The returned stream fails if the splitter fails, and the remaining payloads are discarded.
+func Demultiplex(ctx context.Context, stream *PayloadStream, split Splitter) *PayloadStream {
+	results := make(chan *Result)
+	sink := &PayloadSink{C: results}
+
+	go func() error {
+		defer close(results)
+
+		for {
+			payload, err := stream.Recv(ctx)
+
+			if err != nil {
+				return sink.Send(ctx, Err(err))
+			} else if payload == nil {
+				return nil
+			}
+
+			items, err := split(payload.Data)
+
+			if err != nil {
+				return sink.Send(ctx, Err(err))
+			}
+
+			for _, item := range items {
+				if err := sink.Send(ctx, Ok(&Payload{payload.HasMetadata, payload.Metadata, item})); err != nil {
+					return err
+				}
+			}
+		}
+	}()
+
+	return &PayloadStream{C: results}
+}
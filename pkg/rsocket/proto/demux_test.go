@@ -0,0 +1,54 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDemultiplex(t *testing.T) {
+	Convey("Given a stream of payloads carrying batched items", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		c := make(chan *Result, 2)
+		sink := &PayloadSink{C: c}
+
+		Convey("When split the newline-delimited payload", func() {
+			So(sink.Send(ctx, Ok(Text("foo\nbar\nbaz\n").WithMetadata(Metadata("meta")))), ShouldBeNil)
+			So(sink.Close(), ShouldBeNil)
+
+			stream := Demultiplex(ctx, &PayloadStream{C: c}, SplitLines)
+
+			Convey("Then the items should be delivered as three results", func() {
+				var items []string
+
+				So(stream.ForEach(ctx, func(payload *Payload) error {
+					So(payload.Metadata, ShouldResemble, Metadata("meta"))
+
+					items = append(items, payload.Text())
+
+					return nil
+				}), ShouldBeNil)
+
+				So(items, ShouldResemble, []string{"foo", "bar", "baz"})
+			})
+		})
+
+		Convey("When split a malformed length-prefixed payload", func() {
+			So(sink.Send(ctx, Ok(Bytes([]byte{0, 0, 0, 3, 'f', 'o', 'o', 0, 0, 0, 5, 'b'}))), ShouldBeNil)
+			So(sink.Close(), ShouldBeNil)
+
+			stream := Demultiplex(ctx, &PayloadStream{C: c}, SplitLengthPrefixed)
+
+			Convey("Then the stream should fail", func() {
+				payload, err := stream.Recv(ctx)
+
+				So(payload, ShouldBeNil)
+				So(err, ShouldEqual, ErrInvalidRecord)
+			})
+		})
+	})
+}
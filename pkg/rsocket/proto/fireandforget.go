@@ -0,0 +1,104 @@
+package proto
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+type retainedPayload struct {
+	payload  *Payload
+	position Position // The implied position of the resumable session once the request sent.
+}
+
+// FireAndForgetBuffer retains the payloads of FIRE_AND_FORGET requests recently sent on a resumable session,
+// until the peer acknowledges them with the implied position in the KEEPALIVE frames,
+// so the requests not confirmed delivered could be resent on a new session once the resumption rejected.
+//
+// The positions are tracked by the ResumptionState of the session, the peer without resumption
+// never acknowledges the position, so the buffer is useless unless the resumption negotiated.
+//
+// The buffer is bounded, the oldest payload is dropped once full.
+type FireAndForgetBuffer struct {
+	lock     sync.Mutex
+	size     int
+	payloads []retainedPayload
+}
+
+// NewFireAndForgetBuffer creates an empty FireAndForgetBuffer retains at most size payloads.
+func NewFireAndForgetBuffer(size int) *FireAndForgetBuffer {
+	return &FireAndForgetBuffer{size: size}
+}
+
+// Retain the payload of request sent, which is confirmed once the peer acknowledges the position,
+// the position is the implied position of the ResumptionState after the request sent.
+func (buffer *FireAndForgetBuffer) Retain(payload *Payload, position Position) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if buffer.size <= 0 {
+		return
+	}
+
+	if len(buffer.payloads) == buffer.size {
+		buffer.payloads = append(buffer.payloads[:0], buffer.payloads[1:]...)
+	}
+
+	buffer.payloads = append(buffer.payloads, retainedPayload{payload, position})
+}
+
+// Trim drops the payloads confirmed delivered at or below the position acknowledged by the peer.
+func (buffer *FireAndForgetBuffer) Trim(position Position) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	n := 0
+
+	for n < len(buffer.payloads) && buffer.payloads[n].position <= position {
+		n++
+	}
+
+	buffer.payloads = append(buffer.payloads[:0], buffer.payloads[n:]...)
+}
+
+// Take returns the payloads not confirmed in the order sent, and empties the buffer for a new session.
+func (buffer *FireAndForgetBuffer) Take() []*Payload {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	payloads := make([]*Payload, len(buffer.payloads))
+
+	for i, retained := range buffer.payloads {
+		payloads[i] = retained.payload
+	}
+
+	buffer.payloads = nil
+
+	return payloads
+}
+
+// FireAndForgetConn confirms the payloads in the FireAndForgetBuffer
+// with the position acknowledged by the KEEPALIVE frames received.
+type FireAndForgetConn struct {
+	Conn
+	Buffer *FireAndForgetBuffer
+}
+
+// NewFireAndForgetConn creates a FireAndForgetConn confirms the payloads in the buffer.
+func NewFireAndForgetConn(conn Conn, buffer *FireAndForgetBuffer) *FireAndForgetConn {
+	return &FireAndForgetConn{conn, buffer}
+}
+
+// Recv returns a Frame received, and confirms the payloads if it is a KEEPALIVE frame.
+func (conn *FireAndForgetConn) Recv(ctx context.Context) (f frame.Frame, err error) {
+	if f, err = conn.Conn.Recv(ctx); err != nil {
+		return
+	}
+
+	if keepaliveFrame, ok := f.(*frame.KeepaliveFrame); ok {
+		conn.Buffer.Trim(keepaliveFrame.LastReceived)
+	}
+
+	return
+}
@@ -0,0 +1,43 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFireAndForgetBuffer(t *testing.T) {
+	Convey("Given a FireAndForgetBuffer retains 2 payloads", t, func() {
+		buffer := NewFireAndForgetBuffer(2)
+
+		state := NewResumptionState(NewResumeBuffer())
+
+		var positions []Position
+
+		for _, text := range []string{"a", "b", "c"} {
+			payload := Text(text)
+
+			state.Append(payload.buildRequestFireAndForgetFrame(1, false))
+			state.Append(frame.NewKeepaliveFrame(true, 0, nil))
+			buffer.Retain(payload, state.Position())
+
+			positions = append(positions, state.Position())
+		}
+
+		Convey("When more payloads retained than the size", func() {
+			Convey("Then the oldest payload should be dropped", func() {
+				So(buffer.Take(), ShouldResemble, []*Payload{Text("b"), Text("c")})
+				So(buffer.Take(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the peer acknowledges the position", func() {
+			buffer.Trim(positions[1])
+
+			Convey("Then the payloads confirmed should be dropped", func() {
+				So(buffer.Take(), ShouldResemble, []*Payload{Text("c")})
+			})
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package proto
+
+import "time"
+
+// FlowControlStrategy decides how the requester requests payloads of the response streams.
+type FlowControlStrategy interface {
+	// NewFlow creates the flow control for a new stream.
+	NewFlow() FlowControl
+}
+
+// FlowControl decides the requests of a stream.
+type FlowControl interface {
+	// InitialRequests returns the number of payloads requested with the request frame.
+	InitialRequests() uint32
+
+	// Received is called after a payload delivered to the consumer,
+	// returns the number of payloads should be requested with REQUEST_N, or 0 if not.
+	Received() uint32
+}
+
+// EagerStrategy requests a large window of payloads up front,
+// and replenishes the payloads consumed once the outstanding requests drop to the low watermark.
+type EagerStrategy struct {
+	Window       uint32
+	LowWatermark uint32 // The outstanding requests to replenish the window, or 0 once the window consumed.
+}
+
+var _ FlowControlStrategy = (*EagerStrategy)(nil)
+
+// NewFlow creates the flow control for a new stream.
+func (strategy *EagerStrategy) NewFlow() FlowControl {
+	return &eagerFlow{strategy.Window, strategy.LowWatermark, 0}
+}
+
+type eagerFlow struct {
+	window       uint32
+	lowWatermark uint32
+	consumed     uint32
+}
+
+func (flow *eagerFlow) InitialRequests() uint32 {
+	return flow.window
+}
+
+func (flow *eagerFlow) Received() uint32 {
+	flow.consumed++
+
+	if flow.consumed < flow.window && flow.window-flow.consumed > flow.lowWatermark {
+		return 0
+	}
+
+	requests := flow.consumed
+	flow.consumed = 0
+
+	return requests
+}
+
+// LazyStrategy requests the payload one by one when the consumer pulls.
+type LazyStrategy struct{}
+
+var _ FlowControlStrategy = LazyStrategy{}
+
+// NewFlow creates the flow control for a new stream.
+func (strategy LazyStrategy) NewFlow() FlowControl {
+	return lazyFlow{}
+}
+
+type lazyFlow struct{}
+
+func (flow lazyFlow) InitialRequests() uint32 {
+	return 1
+}
+
+func (flow lazyFlow) Received() uint32 {
+	return 1
+}
+
+// AdaptiveStrategy starts with a small window,
+// and doubles the window each time the consumer drains it until the maximum window.
+//
+// If the consumer drains the window slowly, taking more than SlowInterval per payload on average,
+// the window is halved until the minimum window to limit the payloads buffered.
+// The consumer is measured by the time each payload waits for it, so a slow producer never shrinks the window.
+type AdaptiveStrategy struct {
+	MinWindow    uint32
+	MaxWindow    uint32
+	SlowInterval time.Duration // The average interval between payloads consumed to shrink the window, or 0 if never shrink.
+	Clock        Clock         // The clock measures the consumer, or RealClock if nil.
+}
+
+var _ FlowControlStrategy = (*AdaptiveStrategy)(nil)
+
+// NewFlow creates the flow control for a new stream.
+func (strategy *AdaptiveStrategy) NewFlow() FlowControl {
+	window := strategy.minWindow()
+	clock := strategy.Clock
+
+	if clock == nil {
+		clock = RealClock
+	}
+
+	return &adaptiveFlow{strategy, clock, window, 0, 0, clock.Now(), time.Time{}}
+}
+
+func (strategy *AdaptiveStrategy) minWindow() uint32 {
+	if strategy.MinWindow == 0 {
+		return 1
+	}
+
+	return strategy.MinWindow
+}
+
+// consumerTimer is implemented by the FlowControl measures the consumer,
+// which is told once a payload ready to deliver, so the latency of producer is excluded.
+type consumerTimer interface {
+	Ready()
+}
+
+type adaptiveFlow struct {
+	*AdaptiveStrategy
+	clock     Clock
+	window    uint32
+	consumed  uint32
+	elapsed   time.Duration // The time the payloads of window waited for the consumer.
+	delivered time.Time     // The time the previous payload delivered.
+	ready     time.Time     // The time the next payload ready to deliver.
+}
+
+var _ consumerTimer = (*adaptiveFlow)(nil)
+
+// Ready is called once the next payload ready to deliver.
+func (flow *adaptiveFlow) Ready() {
+	flow.ready = flow.clock.Now()
+}
+
+func (flow *adaptiveFlow) InitialRequests() uint32 {
+	return flow.window
+}
+
+func (flow *adaptiveFlow) Received() uint32 {
+	now := flow.clock.Now()
+
+	// The payload waits for the consumer since it ready or the consumer received the previous one.
+	waited := flow.delivered
+
+	if flow.ready.After(waited) {
+		waited = flow.ready
+	}
+
+	flow.elapsed += now.Sub(waited)
+	flow.delivered = now
+
+	flow.consumed++
+
+	if flow.consumed < flow.window {
+		return 0
+	}
+
+	elapsed := flow.elapsed
+
+	flow.consumed = 0
+	flow.elapsed = 0
+
+	switch {
+	case flow.SlowInterval > 0 && elapsed > flow.SlowInterval*time.Duration(flow.window):
+		if flow.window /= 2; flow.window < flow.minWindow() {
+			flow.window = flow.minWindow()
+		}
+	case flow.window <= flow.MaxWindow/2:
+		flow.window *= 2
+	case flow.window < flow.MaxWindow:
+		flow.window = flow.MaxWindow
+	}
+
+	return flow.window
+}
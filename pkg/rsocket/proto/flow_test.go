@@ -0,0 +1,464 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func requestNs(flow FlowControl, received int) (requests []uint32) {
+	for i := 0; i < received; i++ {
+		requests = append(requests, flow.Received())
+	}
+
+	return
+}
+
+func TestEagerStrategy(t *testing.T) {
+	Convey("Given an eager flow control", t, func() {
+		flow := (&EagerStrategy{Window: 3}).NewFlow()
+
+		Convey("Then the whole window should be requested up front and replenished once consumed", func() {
+			So(flow.InitialRequests(), ShouldEqual, 3)
+			So(requestNs(flow, 7), ShouldResemble, []uint32{0, 0, 3, 0, 0, 3, 0})
+		})
+	})
+}
+
+func TestEagerStrategyWithLowWatermark(t *testing.T) {
+	Convey("Given an eager flow control with a low watermark", t, func() {
+		flow := (&EagerStrategy{Window: 8, LowWatermark: 2}).NewFlow()
+
+		Convey("Then the payloads consumed should be replenished once the outstanding requests drop to the watermark", func() {
+			So(flow.InitialRequests(), ShouldEqual, 8)
+			So(requestNs(flow, 14), ShouldResemble, []uint32{0, 0, 0, 0, 0, 6, 0, 0, 0, 0, 0, 6, 0, 0})
+		})
+	})
+}
+
+func TestLazyStrategy(t *testing.T) {
+	Convey("Given a lazy flow control", t, func() {
+		flow := LazyStrategy{}.NewFlow()
+
+		Convey("Then the payload should be requested one by one", func() {
+			So(flow.InitialRequests(), ShouldEqual, 1)
+			So(requestNs(flow, 3), ShouldResemble, []uint32{1, 1, 1})
+		})
+	})
+}
+
+func TestAdaptiveStrategy(t *testing.T) {
+	Convey("Given an adaptive flow control", t, func() {
+		flow := (&AdaptiveStrategy{MinWindow: 1, MaxWindow: 6}).NewFlow()
+
+		Convey("Then the window should grow until the maximum window", func() {
+			So(flow.InitialRequests(), ShouldEqual, 1)
+			So(requestNs(flow, 1), ShouldResemble, []uint32{2})
+			So(requestNs(flow, 2), ShouldResemble, []uint32{0, 4})
+			So(requestNs(flow, 4), ShouldResemble, []uint32{0, 0, 0, 6})
+			So(requestNs(flow, 6), ShouldResemble, []uint32{0, 0, 0, 0, 0, 6})
+		})
+	})
+}
+
+func TestAdaptiveStrategyWithSlowConsumer(t *testing.T) {
+	Convey("Given an adaptive flow control measures the consumer", t, func() {
+		clock := newFakeClock()
+		flow := (&AdaptiveStrategy{1, 8, 10 * time.Millisecond, clock}).NewFlow()
+
+		consume := func(interval time.Duration) (requests []uint32) {
+			for {
+				clock.Advance(interval)
+
+				if n := flow.Received(); n > 0 {
+					return append(requests, n)
+				}
+
+				requests = append(requests, 0)
+			}
+		}
+
+		Convey("When the consumer drains the window quickly", func() {
+			So(consume(time.Millisecond), ShouldResemble, []uint32{2})
+			So(consume(time.Millisecond), ShouldResemble, []uint32{0, 4})
+			So(consume(time.Millisecond), ShouldResemble, []uint32{0, 0, 0, 8})
+
+			Convey("Then the window should keep growing while the producer slows down", func() {
+				requests := make([]uint32, 8)
+
+				for i := range requests {
+					clock.Advance(20 * time.Millisecond)
+					flow.(consumerTimer).Ready()
+					clock.Advance(time.Millisecond)
+
+					requests[i] = flow.Received()
+				}
+
+				So(requests, ShouldResemble, []uint32{0, 0, 0, 0, 0, 0, 0, 8})
+			})
+
+			Convey("Then the window should shrink once the consumer slows down", func() {
+				So(consume(20*time.Millisecond), ShouldResemble, []uint32{0, 0, 0, 0, 0, 0, 0, 4})
+				So(consume(20*time.Millisecond), ShouldResemble, []uint32{0, 0, 0, 2})
+				So(consume(20*time.Millisecond), ShouldResemble, []uint32{0, 1})
+				So(consume(20*time.Millisecond), ShouldResemble, []uint32{1})
+
+				Convey("And grow again once the consumer speeds up", func() {
+					So(consume(time.Millisecond), ShouldResemble, []uint32{2})
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: PAYLOAD
+// RQ -> RS: REQUEST_N
+// RS -> RQ: PAYLOAD with COMPLETE
+func TestRequestStreamWithLazyStrategy(t *testing.T) {
+	Convey("Given a requester with lazy flow control", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithFlowControl(LazyStrategy{})).(*rSocketRequester)
+
+		Convey("When request stream for payloads", func() {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+			So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, 1)
+
+			Convey("Then each payload should be requested after consumed", func() {
+				So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+				payload, err := responses.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload, ShouldResemble, Text("foo"))
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+				So(f.(*frame.RequestNFrame).N, ShouldEqual, 1)
+
+				So(requester.HandleFrame(ctx, Text("bar").buildPayloadFrame(1, true)), ShouldBeNil)
+
+				payload, err = responses.Recv(ctx)
+				So(payload, ShouldResemble, Text("bar"))
+
+				payload, err = responses.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM with 8 initial requests
+// RS -> RQ: PAYLOAD * 6
+// RQ -> RS: REQUEST_N(6)
+func TestRequestStreamWithLowWatermark(t *testing.T) {
+	Convey("Given a requester replenishes the streams at the low watermark", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), 8, WithLowWatermark(2)).(*rSocketRequester)
+
+		Convey("When request stream for payloads", func() {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+			So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, 8)
+
+			Convey("Then the consumed payloads should be requested once 2 requests outstanding", func() {
+				for i := 0; i < 6; i++ {
+					So(requests.C, ShouldBeEmpty)
+					So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+					payload, err := responses.Recv(ctx)
+					So(err, ShouldBeNil)
+					So(payload, ShouldResemble, Text("foo"))
+				}
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+				So(f.(*frame.RequestNFrame).N, ShouldEqual, 6)
+			})
+		})
+	})
+}
+
+func TestRequestStreamOnDemand(t *testing.T) {
+	Convey("Given a requester with the lazy flow control", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithFlowControl(LazyStrategy{})).(*rSocketRequester)
+
+		Convey("When request stream for payloads", func() {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+			Convey("Then more payloads should be requested on demand", func() {
+				So(responses.Request(5), ShouldBeNil)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+				So(f.(*frame.RequestNFrame).N, ShouldEqual, 5)
+			})
+
+			Convey("Then no payload should be requested once the stream completed", func() {
+				So(requester.HandleFrame(ctx, buildCompleteFrame(1)), ShouldBeNil)
+
+				payload, err := responses.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+
+				So(responses.Request(5), ShouldEqual, ErrStreamClosed)
+				So(requests.C, ShouldBeEmpty)
+			})
+
+			Convey("Then no payload should be requested once the stream cancelled", func() {
+				responses.Cancel()
+
+				So(responses.Request(5), ShouldEqual, ErrStreamClosed)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM with the requests the buffer could hold
+// RS -> RQ: PAYLOAD * maxBufferedResults
+// RQ -> RS: REQUEST_N for the requests withheld, once the payloads consumed
+func TestRequestStreamCreditBoundedByBuffer(t *testing.T) {
+	Convey("Given a requester with strict flow control", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(64)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithStrictFlowControl()).(*rSocketRequester)
+
+		Convey("When request stream with more payloads than the buffer could hold", func() {
+			responses, err := requester.RequestStream(ContextWithInitialRequests(ctx, maxBufferedResults+10), Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+			Convey("Then only the requests the buffer could hold should be granted", func() {
+				So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, maxBufferedResults)
+
+				Convey("And the payloads should be received without blocking while the consumer is not reading", func() {
+					for i := 0; i < maxBufferedResults; i++ {
+						So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+					}
+
+					Convey("And the requests withheld should be granted once the payloads consumed", func() {
+						for i := 0; i < maxBufferedResults; i++ {
+							_, err := responses.Recv(ctx)
+							So(err, ShouldBeNil)
+						}
+
+						var granted uint32
+
+						for granted < 10 {
+							f, err := requests.Recv(ctx)
+							So(err, ShouldBeNil)
+							checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+
+							granted += f.(*frame.RequestNFrame).N
+						}
+
+						So(granted, ShouldEqual, 10)
+						shouldBeIdle(requests)
+					})
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM with 2 initial requests
+// RS -> RQ: PAYLOAD * 3
+// RQ -> RS: ERROR[CONNECTION_ERROR]
+func TestRequestStreamWithStrictFlowControl(t *testing.T) {
+	Convey("Given a requester with strict flow control", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithStrictFlowControl()).(*rSocketRequester)
+
+		Convey("When request stream with a credit of 2 payloads", func() {
+			_, err := requester.RequestStream(ContextWithInitialRequests(ctx, 2), Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+			So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, 2)
+
+			Convey("Then the payloads within the credit should be accepted", func() {
+				So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+				So(requester.HandleFrame(ctx, Text("bar").buildPayloadFrame(1, false)), ShouldBeNil)
+
+				Convey("And the payload exceeds the credit should raise a connection error", func() {
+					So(requester.HandleFrame(ctx, Text("baz").buildPayloadFrame(1, false)), ShouldEqual, ErrCreditExceeded)
+
+					f, _ := requests.Recv(ctx)
+					checkFrameHeader(f, 0, frame.TypeError, 0)
+					So(f.(*frame.ErrorFrame).Code, ShouldEqual, frame.ErrConnectionError)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: PAYLOAD * (more than buffered)
+// RQ -> RS: ERROR[CONNECTION_ERROR]
+func TestRequestStreamExceedsBuffer(t *testing.T) {
+	Convey("Given a requester without strict flow control", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When the responder ignores the credit while the payloads not consumed", func() {
+			_, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+			for i := 0; i < maxBufferedResults+3 && err == nil; i++ {
+				err = requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false))
+			}
+
+			Convey("Then the read loop should not be blocked, but raise a connection error", func() {
+				So(err, ShouldEqual, ErrCreditExceeded)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 0, frame.TypeError, 0)
+				So(f.(*frame.ErrorFrame).Code, ShouldEqual, frame.ErrConnectionError)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: PAYLOAD
+// RQ -> RS: REQUEST_N after resumed
+// RS -> RQ: PAYLOAD with COMPLETE
+func TestRequestStreamPauseAndResume(t *testing.T) {
+	Convey("Given a requester with lazy flow control", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithFlowControl(LazyStrategy{})).(*rSocketRequester)
+
+		Convey("When request stream and pause the delivery", func() {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+			responses.Pause()
+
+			Convey("Then no more payloads should be requested while paused", func() {
+				So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+				payload, err := responses.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload, ShouldResemble, Text("foo"))
+
+				time.Sleep(10 * time.Millisecond)
+
+				So(requests.C, ShouldBeEmpty)
+
+				Convey("And the delivery should resume after resumed", func() {
+					So(responses.Resume(), ShouldBeNil)
+
+					f, _ := requests.Recv(ctx)
+					checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+					So(f.(*frame.RequestNFrame).N, ShouldEqual, 1)
+
+					So(requester.HandleFrame(ctx, Text("bar").buildPayloadFrame(1, true)), ShouldBeNil)
+
+					payload, err := responses.Recv(ctx)
+					So(err, ShouldBeNil)
+					So(payload, ShouldResemble, Text("bar"))
+				})
+			})
+		})
+	})
+}
+
+// slidingWindow requests the initial window up front, and requests one more for each payload consumed.
+type slidingWindow uint32
+
+func (window slidingWindow) NewFlow() FlowControl { return window }
+
+func (window slidingWindow) InitialRequests() uint32 { return uint32(window) }
+
+func (window slidingWindow) Received() uint32 { return 1 }
+
+// RQ -> RS: REQUEST_STREAM with 3 initial requests
+// RS -> RQ: PAYLOAD * 3 of 600 bytes
+// RQ -> RS: REQUEST_N once the payloads buffered below the budget
+func TestRequestStreamWithByteBudget(t *testing.T) {
+	Convey("Given a requester with a byte budget of stream", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithFlowControl(slidingWindow(3)), WithStreamByteBudget(1000)).(*rSocketRequester)
+
+		Convey("When the large payloads buffered exceed the budget", func() {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+			So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, 3)
+
+			large := Bytes(bytes.Repeat([]byte("x"), 600))
+
+			for i := 0; i < 3; i++ {
+				So(requester.HandleFrame(ctx, large.buildPayloadFrame(1, false)), ShouldBeNil)
+			}
+
+			Convey("Then no more payloads should be requested until drained below the budget", func() {
+				payload, err := responses.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload.Data, ShouldHaveLength, 600)
+
+				time.Sleep(10 * time.Millisecond)
+				So(requests.C, ShouldBeEmpty)
+
+				payload, err = responses.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload.Data, ShouldHaveLength, 600)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+				So(f.(*frame.RequestNFrame).N, ShouldEqual, 2)
+			})
+		})
+	})
+}
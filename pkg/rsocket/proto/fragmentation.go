@@ -1,14 +1,233 @@
 package proto
 
+import (
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+var (
+	// ErrInterleavedFragment is returned when a new request interleaves the fragments of a stream.
+	ErrInterleavedFragment = frame.ErrConnectionError.WithMessage("interleaved fragment")
+
+	// ErrUnexpectedFragment is returned when receive a following fragment without the first one.
+	ErrUnexpectedFragment = frame.ErrConnectionError.WithMessage("unexpected fragment")
+)
+
+// DefaultFragmentSize is the default maximum size of the outbound frames, which fits the 24-bit frame length.
+const DefaultFragmentSize = frame.MaxFrameSize
+
 // FragmentOptions configures the fragmentation
 type FragmentOption struct {
-	MTU uint
+	MTU  uint // The maximum size of frame supported by the transport.
+	Size uint // The preferred size of fragment, which never exceeds the MTU.
 }
 
 func NewFragmentOption() *FragmentOption {
-	return &FragmentOption{0}
+	return &FragmentOption{0, 0}
 }
 
 func (fragment *FragmentOption) Enabled() bool {
-	return fragment.MTU > 0
+	return fragment.FragmentSize() > 0
+}
+
+// FragmentSize returns the maximum size of fragment, the smaller one of the Size and MTU.
+func (fragment *FragmentOption) FragmentSize() uint {
+	switch {
+	case fragment.Size == 0:
+		return fragment.MTU
+	case fragment.MTU == 0 || fragment.Size < fragment.MTU:
+		return fragment.Size
+	default:
+		return fragment.MTU
+	}
+}
+
+// fragmentBuilder builds the frame with the fragment of payload.
+type fragmentBuilder func(fragment *Payload, follows bool) frame.Frame
+
+// fragmentFrames splits the payload into frames no larger than the size,
+// the first frame is built by the builder, and the following fragments are sent as PAYLOAD frames.
+func fragmentFrames(streamID StreamID, size uint, payload *Payload, complete bool, build fragmentBuilder) (frames []frame.Frame) {
+	if size == 0 {
+		return []frame.Frame{build(payload, false)}
+	}
+
+	if f := build(payload, false); f.Size() <= int(size) {
+		return []frame.Frame{f}
+	}
+
+	hasMetadata := payload.HasMetadata
+	metadata, data := payload.Metadata, payload.Data
+
+	for {
+		fragment := &Payload{HasMetadata: hasMetadata}
+
+		if hasMetadata {
+			fragment.Metadata = Metadata{}
+		}
+
+		capacity := int(size) - build(fragment, false).Size()
+
+		if capacity < 1 {
+			capacity = 1
+		}
+
+		if hasMetadata {
+			n := minInt(len(metadata), capacity)
+			fragment.Metadata, metadata = metadata[:n], metadata[n:]
+			capacity -= n
+		}
+
+		if len(metadata) == 0 {
+			n := minInt(len(data), capacity)
+			fragment.Data, data = data[:n], data[n:]
+		}
+
+		follows := len(metadata) > 0 || len(data) > 0
+
+		frames = append(frames, build(fragment, follows))
+
+		if !follows {
+			return
+		}
+
+		hasMetadata = len(metadata) > 0
+		build = payloadFragment(streamID, complete)
+	}
+}
+
+// payloadFragment builds the PAYLOAD frame of fragment, the last fragment completes the stream if complete.
+func payloadFragment(streamID StreamID, complete bool) fragmentBuilder {
+	return func(fragment *Payload, follows bool) frame.Frame {
+		return frame.NewPayloadFrame(streamID, follows, complete && !follows, true, fragment.HasMetadata, fragment.Metadata, fragment.Data)
+	}
+}
+
+// Reassembler reassembles the fragments of frames, the fragments of different streams may interleave.
+type Reassembler struct {
+	lock    sync.Mutex
+	streams map[StreamID]*reassembly
+}
+
+type reassembly struct {
+	head     frame.Frame
+	metadata Metadata
+	data     []byte
+}
+
+// NewReassembler creates a Reassembler.
+func NewReassembler() *Reassembler {
+	return &Reassembler{streams: make(map[StreamID]*reassembly)}
+}
+
+// InProgress returns the fragments of stream is reassembling or not.
+func (reassembler *Reassembler) InProgress(streamID StreamID) bool {
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	_, ok := reassembler.streams[streamID]
+
+	return ok
+}
+
+// Reassemble returns the frame when the last fragment received, or nil if more fragments follows.
+func (reassembler *Reassembler) Reassemble(f frame.Frame) (frame.Frame, error) {
+	streamID := f.StreamID()
+
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+
+	stream, inProgress := reassembler.streams[streamID]
+
+	switch f.Type() {
+	case frame.TypeRequestResponse, frame.TypeRequestFireAndForget, frame.TypeRequestStream, frame.TypeRequestChannel:
+		if inProgress {
+			delete(reassembler.streams, streamID)
+
+			return nil, ErrInterleavedFragment
+		}
+
+	case frame.TypePayload:
+
+	case frame.TypeCancel, frame.TypeError:
+		delete(reassembler.streams, streamID)
+
+		return f, nil
+
+	default:
+		return f, nil
+	}
+
+	payload := framePayload(f)
+
+	if !inProgress {
+		if !f.Flags().IsSet(frame.FlagFollows) {
+			return f, nil
+		}
+
+		// Copy the fragment to avoid appending the following fragments to the buffer of frame.
+		reassembler.streams[streamID] = &reassembly{
+			f,
+			append(Metadata(nil), payload.Metadata...),
+			append([]byte(nil), payload.Data...),
+		}
+
+		return nil, nil
+	}
+
+	stream.metadata = append(stream.metadata, payload.Metadata...)
+	stream.data = append(stream.data, payload.Data...)
+
+	if f.Flags().IsSet(frame.FlagFollows) {
+		return nil, nil
+	}
+
+	delete(reassembler.streams, streamID)
+
+	return stream.build(f), nil
+}
+
+func (stream *reassembly) build(last frame.Frame) frame.Frame {
+	streamID := stream.head.StreamID()
+	hasMetadata := stream.head.Flags().IsSet(frame.FlagMetadata)
+	complete := last.Flags().IsSet(frame.FlagComplete)
+
+	switch head := stream.head.(type) {
+	case *frame.RequestResponseFrame:
+		return frame.NewRequestResponseFrame(streamID, false, hasMetadata, stream.metadata, stream.data)
+	case *frame.RequestFireAndForgetFrame:
+		return frame.NewRequestFireAndForgetFrame(streamID, false, hasMetadata, stream.metadata, stream.data)
+	case *frame.RequestStreamFrame:
+		return frame.NewRequestStreamFrame(streamID, false, head.InitialRequests, hasMetadata, stream.metadata, stream.data)
+	case *frame.RequestChannelFrame:
+		return frame.NewRequestChannelFrame(streamID, false, complete, head.InitialRequests, hasMetadata, stream.metadata, stream.data)
+	default:
+		return frame.NewPayloadFrame(streamID, false, complete, true, hasMetadata, stream.metadata, stream.data)
+	}
+}
+
+func framePayload(f frame.Frame) *Payload {
+	switch f := f.(type) {
+	case *frame.RequestResponseFrame:
+		return &Payload{f.HasMetadata(), f.Metadata, f.Data}
+	case *frame.RequestFireAndForgetFrame:
+		return &Payload{f.HasMetadata(), f.Metadata, f.Data}
+	case *frame.RequestStreamFrame:
+		return &Payload{f.HasMetadata(), f.Metadata, f.Data}
+	case *frame.RequestChannelFrame:
+		return &Payload{f.HasMetadata(), f.Metadata, f.Data}
+	case *frame.PayloadFrame:
+		return &Payload{f.HasMetadata(), f.Metadata, f.Data}
+	default:
+		return nil
+	}
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+
+	return y
 }
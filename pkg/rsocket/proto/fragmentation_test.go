@@ -0,0 +1,277 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFragmentSize(t *testing.T) {
+	Convey("Given fragment options", t, func() {
+		So((&FragmentOption{MTU: 1024}).FragmentSize(), ShouldEqual, 1024)
+		So((&FragmentOption{Size: 64}).FragmentSize(), ShouldEqual, 64)
+		So((&FragmentOption{MTU: 1024, Size: 64}).FragmentSize(), ShouldEqual, 64)
+		So((&FragmentOption{MTU: 1024, Size: 4096}).FragmentSize(), ShouldEqual, 1024)
+		So(NewFragmentOption().Enabled(), ShouldBeFalse)
+	})
+}
+
+// RQ -> RS: REQUEST_RESPONSE with FOLLOWS
+// RQ -> RS: PAYLOAD with FOLLOWS
+// RQ -> RS: PAYLOAD
+func TestRequestWithFragmentSize(t *testing.T) {
+	Convey("Given a requester fragments payloads smaller than MTU", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		const fragmentSize = 32
+
+		requests := NewFrameChan(16)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithFragment(&FragmentOption{MTU: 1024, Size: fragmentSize}))
+
+		metadata := bytes.Repeat([]byte("m"), 40)
+		data := bytes.Repeat([]byte("d"), 60)
+
+		Convey("When send a payload fits in the MTU", func() {
+			So(requester.FireAndForget(ctx, Bytes(data).WithMetadata(metadata)), ShouldBeNil)
+
+			Convey("Then the payload should be split into fragments", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, frame.FlagMetadata|frame.FlagFollows)
+				So(f.Size(), ShouldEqual, fragmentSize)
+
+				request := f.(*frame.RequestFireAndForgetFrame)
+				receivedMetadata := request.Metadata
+				receivedData := request.Data
+
+				for follows := true; follows; {
+					f, _ = requests.Recv(ctx)
+
+					So(f.Type(), ShouldEqual, frame.TypePayload)
+					So(f.Size(), ShouldBeLessThanOrEqualTo, fragmentSize)
+
+					fragment := f.(*frame.PayloadFrame)
+					receivedMetadata = append(receivedMetadata, fragment.Metadata...)
+					receivedData = append(receivedData, fragment.Data...)
+					follows = fragment.Follows()
+				}
+
+				So([]byte(receivedMetadata), ShouldResemble, metadata)
+				So(receivedData, ShouldResemble, data)
+				So(len(requests.C), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_FNF with FOLLOWS
+// RQ -> RS: PAYLOAD with FOLLOWS
+// ...
+// RQ -> RS: PAYLOAD
+func TestRequesterWithFragmentSize(t *testing.T) {
+	Convey("Given a requester with 1KB fragment size", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(128)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithFragmentSize(1024))
+
+		Convey("When send a 100KB payload", func() {
+			So(requester.FireAndForget(ctx, Bytes(make([]byte, 100*1024))), ShouldBeNil)
+
+			Convey("Then the payload should be split into 1KB frames", func() {
+				// Each frame carries 1018 bytes after the 6 bytes header.
+				So(requests.C, ShouldHaveLength, 101)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, frame.FlagFollows)
+				So(f.Size(), ShouldEqual, 1024)
+
+				for i := 1; i < 101; i++ {
+					f, _ := requests.Recv(ctx)
+					So(f.Type(), ShouldEqual, frame.TypePayload)
+					So(f.Size(), ShouldBeLessThanOrEqualTo, 1024)
+					So(f.(*frame.PayloadFrame).Follows(), ShouldEqual, i < 100)
+				}
+			})
+		})
+	})
+
+	Convey("Given a requester never fragments", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(1)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithFragmentSize(0))
+
+		Convey("When send a 100KB payload", func() {
+			So(requester.FireAndForget(ctx, Bytes(make([]byte, 100*1024))), ShouldBeNil)
+
+			Convey("Then the payload should be sent in a single frame", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, 0)
+				So(f.(*frame.RequestFireAndForgetFrame).Data, ShouldHaveLength, 100*1024)
+			})
+		})
+	})
+}
+
+func TestFragmentLargePayloadRoundTrip(t *testing.T) {
+	Convey("Given a payload larger than 64KB with metadata spans the fragments", t, func() {
+		const fragmentSize = 1024
+
+		metadata := bytes.Repeat([]byte("m"), 3000)
+		data := bytes.Repeat([]byte(`{"key":"value"},`), 5000)
+		payload := Bytes(data).WithMetadata(metadata)
+
+		Convey("When split the payload and reassemble the fragments", func() {
+			frames := fragmentFrames(1, fragmentSize, payload, true, payloadFragment(1, true))
+
+			reassembler := NewReassembler()
+
+			var reassembled frame.Frame
+
+			for i, f := range frames {
+				So(f.Size(), ShouldBeLessThanOrEqualTo, fragmentSize)
+
+				var err error
+
+				reassembled, err = reassembler.Reassemble(f)
+				So(err, ShouldBeNil)
+
+				if i < len(frames)-1 {
+					So(reassembled, ShouldBeNil)
+				}
+			}
+
+			Convey("Then the metadata and data boundaries should be preserved", func() {
+				So(len(frames), ShouldBeGreaterThan, (len(metadata)+len(data))/fragmentSize)
+
+				payloadFrame := reassembled.(*frame.PayloadFrame)
+
+				So(payloadFrame.Follows(), ShouldBeFalse)
+				So(payloadFrame.Complete(), ShouldBeTrue)
+				So([]byte(payloadFrame.Metadata), ShouldResemble, metadata)
+				So(payloadFrame.Data, ShouldResemble, data)
+				So(reassembler.InProgress(1), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestReassembleInterleavedStreams(t *testing.T) {
+	Convey("Given the fragments of two streams", t, func() {
+		const fragmentSize = 16
+
+		foo := fragmentFrames(1, fragmentSize, Text("foo foo foo foo foo").WithMetadata(Metadata("1111")), true, payloadFragment(1, true))
+		bar := fragmentFrames(3, fragmentSize, Text("bar bar bar bar bar bar bar"), false, payloadFragment(3, false))
+
+		So(len(foo), ShouldBeGreaterThan, 1)
+		So(len(bar), ShouldBeGreaterThan, 1)
+
+		Convey("When reassemble the interleaved fragments", func() {
+			reassembler := NewReassembler()
+			reassembled := make(map[StreamID]*frame.PayloadFrame)
+
+			for i := 0; i < len(foo) || i < len(bar); i++ {
+				for _, fragments := range [][]frame.Frame{foo, bar} {
+					if i >= len(fragments) {
+						continue
+					}
+
+					f, err := reassembler.Reassemble(fragments[i])
+					So(err, ShouldBeNil)
+
+					if f != nil {
+						So(reassembled, ShouldNotContainKey, f.StreamID())
+
+						reassembled[f.StreamID()] = f.(*frame.PayloadFrame)
+					}
+				}
+			}
+
+			Convey("Then each stream should be reassembled", func() {
+				checkFrameHeader(reassembled[1], 1, frame.TypePayload, frame.FlagMetadata|frame.FlagComplete|frame.FlagNext)
+				So([]byte(reassembled[1].Metadata), ShouldResemble, []byte("1111"))
+				So(string(reassembled[1].Data), ShouldEqual, "foo foo foo foo foo")
+
+				checkFrameHeader(reassembled[3], 3, frame.TypePayload, frame.FlagNext)
+				So(string(reassembled[3].Data), ShouldEqual, "bar bar bar bar bar bar bar")
+
+				So(reassembler.InProgress(1), ShouldBeFalse)
+				So(reassembler.InProgress(3), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a new request interleaves the fragments of stream", func() {
+			reassembler := NewReassembler()
+
+			f, err := reassembler.Reassemble(foo[0])
+			So(f, ShouldBeNil)
+			So(err, ShouldBeNil)
+
+			_, err = reassembler.Reassemble(Text("hello").buildRequestResponseFrame(1, false))
+
+			Convey("Then the fragment should be rejected", func() {
+				So(err, ShouldEqual, ErrInterleavedFragment)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM with FOLLOWS (stream 1)
+// RQ -> RS: REQUEST_STREAM with FOLLOWS (stream 3)
+// RQ -> RS: PAYLOAD (stream 1)
+// RQ -> RS: PAYLOAD (stream 3)
+func TestResponderReassemblesRequests(t *testing.T) {
+	Convey("Given a responder receives fragmented requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := make(chan *Payload, 2)
+		responses := NewFrameChan(4)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				requests <- payload
+
+				return textStream(0), nil
+			},
+		})
+
+		build := func(streamID StreamID) fragmentBuilder {
+			return func(fragment *Payload, follows bool) frame.Frame {
+				return fragment.buildRequestStreamFrame(streamID, follows, initReqs)
+			}
+		}
+
+		foo := fragmentFrames(1, 20, Text("foo foo foo"), false, build(1))
+		bar := fragmentFrames(3, 20, Text("bar bar bar"), false, build(3))
+
+		So(foo, ShouldHaveLength, 2)
+		So(bar, ShouldHaveLength, 2)
+
+		Convey("When the fragments of streams interleave", func() {
+			for _, f := range []frame.Frame{foo[0], bar[0], foo[1], bar[1]} {
+				So(responder.HandleFrame(ctx, f), ShouldBeNil)
+			}
+
+			Convey("Then the requests should be reassembled per stream", func() {
+				So((<-requests).Text(), ShouldEqual, "foo foo foo")
+				So((<-requests).Text(), ShouldEqual, "bar bar bar")
+			})
+		})
+
+		Convey("When a following fragment received without the first one", func() {
+			err := responder.HandleFrame(ctx, foo[1])
+
+			Convey("Then the fragment should be rejected", func() {
+				So(err, ShouldEqual, ErrUnexpectedFragment)
+			})
+		})
+	})
+}
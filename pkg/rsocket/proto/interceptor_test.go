@@ -0,0 +1,66 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type contextKey string
+
+func routeFromContext(key contextKey) PayloadInterceptor {
+	return func(ctx context.Context, payload *Payload) (*Payload, error) {
+		routing, err := DecodeRoutingMetadata(payload.Metadata)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := ctx.Value(key).(string); ok {
+			routing = append(routing, value)
+		}
+
+		metadata, err := routing.Encode()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Payload{true, metadata, payload.Data}, nil
+	}
+}
+
+func TestRequesterInterceptors(t *testing.T) {
+	Convey("Given a requester with interceptors inject metadata from context", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(1)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithInterceptors(routeFromContext("tenant")),
+			WithInterceptors(routeFromContext("trace")))
+
+		Convey("When send a request with values in context", func() {
+			ctx = context.WithValue(ctx, contextKey("tenant"), "acme")
+			ctx = context.WithValue(ctx, contextKey("trace"), "abc123")
+
+			payload := Text("hello")
+
+			So(requester.FireAndForget(ctx, payload), ShouldBeNil)
+
+			Convey("Then the metadata should be injected in the registration order", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, frame.FlagMetadata)
+
+				routing, err := DecodeRoutingMetadata(f.(*frame.RequestFireAndForgetFrame).Metadata)
+
+				So(err, ShouldBeNil)
+				So(routing, ShouldResemble, NewRoutingMetadata("acme", "abc123"))
+				So(payload.HasMetadata, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package proto
+
+import (
+	"encoding/json"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// JSONError creates an error with the code, and the JSON encoding of v as the data,
+// which could be decoded by the consumer with Error.DecodeJSON.
+func JSONError(code frame.ErrorCode, v interface{}) (*Error, error) {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return code.WithMessage(string(data)), nil
+}
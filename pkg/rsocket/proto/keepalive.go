@@ -2,6 +2,8 @@ package proto
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
@@ -10,16 +12,32 @@ import (
 const defaultKeepaliveInterval = 500 * time.Millisecond
 const defaultMaxLifetime = defaultKeepaliveInterval * 3
 
+// ErrKeepaliveTimeout is returned when no KEEPALIVE frame received in the max lifetime,
+// the connection may be half-open that the frames sent are never answered.
+var ErrKeepaliveTimeout = errors.New("keepalive timeout")
+
 type KeepaliveOption struct {
 	Interval    time.Duration // Time between KEEPALIVE frames that the client will send.
 	MaxLifetime time.Duration // Time that a client will allow a server to not respond to a KEEPALIVE before it is assumed to be dead.
 	Data        []byte
+	Clock       Clock             // The clock drives the keepalive timers, or RealClock if nil.
+	Provider    func() []byte     // Provides the data of each KEEPALIVE frame sent, or use Data if nil.
+	Observer    func(data []byte) // Observes the data of KEEPALIVE frames received, or nil if not observe.
 }
 
 func NewKeepaliveOption() *KeepaliveOption {
 	return &KeepaliveOption{
-		defaultKeepaliveInterval, defaultMaxLifetime, nil,
+		defaultKeepaliveInterval, defaultMaxLifetime, nil, RealClock, nil, nil,
+	}
+}
+
+// keepaliveData returns the data of KEEPALIVE frame to send.
+func (keepalive *KeepaliveOption) keepaliveData() []byte {
+	if keepalive.Provider != nil {
+		return keepalive.Provider()
 	}
+
+	return keepalive.Data
 }
 
 func (keepalive *KeepaliveOption) Enabled() bool {
@@ -29,58 +47,186 @@ func (keepalive *KeepaliveOption) Enabled() bool {
 type KeepaliveConn struct {
 	Conn
 	Keepalive          *KeepaliveOption
-	LastClientReceived Position
+	Resumption         *ResumptionState // Advertises the position received in the KEEPALIVE frames, or nil if not resumable.
 	LastServerReceived Position
+	lastData           []byte // The data of last KEEPALIVE frame received.
+	clock              Clock
 	deadline           time.Time
-	ticker             *time.Ticker
+	ticker             Ticker
+	lock               sync.Mutex
+	stopped            chan struct{}
+	closed             chan struct{}
+	expired            bool // The connection is closed by Serve since no frame received in the max lifetime.
+	sending            sync.WaitGroup
+	closeOnce          sync.Once
+	closeErr           error
 }
 
 func NewKeepaliveConn(conn Conn, opts *KeepaliveOption) *KeepaliveConn {
+	clock := opts.Clock
+
+	if clock == nil {
+		clock = RealClock
+	}
+
 	return &KeepaliveConn{
-		conn,
-		opts,
-		0,
-		0,
-		time.Now().Add(opts.MaxLifetime),
-		time.NewTicker(opts.Interval),
+		Conn:      conn,
+		Keepalive: opts,
+		clock:     clock,
+		deadline:  clock.Now().Add(opts.MaxLifetime),
+		ticker:    clock.NewTicker(opts.Interval),
+		stopped:   make(chan struct{}),
+		closed:    make(chan struct{}),
 	}
 }
 
+// Serve sends the KEEPALIVE frames until stopped, and closes the connection with ErrKeepaliveTimeout
+// if no frame received in the max lifetime, the deadline is still watched after stopped until closed.
 func (conn *KeepaliveConn) Serve(ctx context.Context) error {
+	timer := conn.clock.NewTimer(conn.Deadline().Sub(conn.clock.Now()))
+	defer func() { timer.Stop() }()
+
+	ticks, stopped := conn.ticker.C(), conn.stopped
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case now := <-conn.ticker.C:
-			if now.Add(conn.Keepalive.Interval).After(conn.deadline) {
-				go conn.Send(ctx, frame.NewKeepaliveFrame(true, conn.LastClientReceived, conn.Keepalive.Data))
+		case <-conn.closed:
+			return nil
+		case <-stopped:
+			ticks, stopped = nil, nil
+		case <-ticks:
+			// The KEEPALIVE frame is sent on every interval, even if frames are received, so the peer never times out.
+			conn.sendKeepalive(ctx, frame.NewKeepaliveFrame(true, conn.lastReceived(), conn.Keepalive.keepaliveData()))
+		case <-timer.C():
+			// The deadline is extended by the frames received, the timer is rearmed for the rest of it lazily.
+			if remaining := conn.Deadline().Sub(conn.clock.Now()); remaining > 0 {
+				timer = conn.clock.NewTimer(remaining)
+
+				continue
 			}
+
+			conn.lock.Lock()
+			conn.expired = true
+			conn.lock.Unlock()
+
+			// The sending may still succeed on a half-open connection, closes it to fail the receiving and streams.
+			conn.Close()
+
+			return ErrKeepaliveTimeout
 		}
 	}
 }
 
+// lastReceived returns the implied position of the resumable frames received, or 0 if not resumable.
+func (conn *KeepaliveConn) lastReceived() Position {
+	if conn.Resumption == nil {
+		return 0
+	}
+
+	return conn.Resumption.LastReceived()
+}
+
+// sendKeepalive sends the KEEPALIVE frame in background unless the keepalive stopped.
+func (conn *KeepaliveConn) sendKeepalive(ctx context.Context, f *frame.KeepaliveFrame) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	select {
+	case <-conn.stopped:
+		return
+	default:
+	}
+
+	conn.sending.Add(1)
+
+	go func() {
+		defer conn.sending.Done()
+
+		conn.Send(ctx, f)
+	}()
+}
+
+// Stop stops sending KEEPALIVE frames, and waits the KEEPALIVE frames in flight sent.
+func (conn *KeepaliveConn) Stop() error {
+	conn.lock.Lock()
+
+	select {
+	case <-conn.stopped:
+	default:
+		conn.ticker.Stop()
+
+		close(conn.stopped)
+	}
+
+	conn.lock.Unlock()
+
+	conn.sending.Wait()
+
+	return nil
+}
+
+// Close stops the keepalive and closes the underlying Conn once.
 func (conn *KeepaliveConn) Close() error {
-	conn.ticker.Stop()
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
 
-	return conn.Conn.Close()
+		conn.Stop()
+
+		conn.closeErr = conn.Conn.Close()
+	})
+
+	return conn.closeErr
 }
 
-func (conn *KeepaliveConn) Recv(ctx context.Context) (f frame.Frame, err error) {
-	ctx, cancel := context.WithDeadline(ctx, conn.deadline)
-	defer cancel()
+// Deadline returns the time the connection is assumed dead if no frame received before.
+func (conn *KeepaliveConn) Deadline() time.Time {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
 
+	return conn.deadline
+}
+
+// LastReceived returns the position and data of the last KEEPALIVE frame received from the peer.
+func (conn *KeepaliveConn) LastReceived() (Position, []byte) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	return conn.LastServerReceived, conn.lastData
+}
+
+// Recv receives a frame, ErrKeepaliveTimeout is returned once Serve closed the connection
+// since no frame received in the max lifetime, any frame received proves the peer alive and extends the deadline.
+func (conn *KeepaliveConn) Recv(ctx context.Context) (f frame.Frame, err error) {
 	f, err = conn.Conn.Recv(ctx)
 
 	if err != nil {
+		conn.lock.Lock()
+		if conn.expired {
+			err = ErrKeepaliveTimeout
+		}
+		conn.lock.Unlock()
+
 		return
 	}
 
+	conn.lock.Lock()
+	conn.deadline = conn.clock.Now().Add(conn.Keepalive.MaxLifetime)
+	conn.lock.Unlock()
+
 	if keepaliveFrame, ok := f.(*frame.KeepaliveFrame); ok {
+		conn.lock.Lock()
 		conn.LastServerReceived = keepaliveFrame.LastReceived
-		conn.deadline = time.Now().Add(conn.Keepalive.MaxLifetime)
+		conn.lastData = keepaliveFrame.Data
+		conn.lock.Unlock()
+
+		if conn.Keepalive.Observer != nil {
+			conn.Keepalive.Observer(keepaliveFrame.Data)
+		}
 
 		if keepaliveFrame.NeedRespond() {
-			go conn.Send(ctx, frame.NewKeepaliveFrame(false, conn.LastClientReceived, keepaliveFrame.Data))
+			conn.sendKeepalive(ctx, frame.NewKeepaliveFrame(false, conn.lastReceived(), keepaliveFrame.Data))
 		}
 	}
 
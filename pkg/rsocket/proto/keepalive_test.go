@@ -0,0 +1,350 @@
+package proto
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeepaliveWithFakeClock(t *testing.T) {
+	Convey("Given a keepalive connection driven by a fake clock", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		conn := NewFrameChan(1)
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Second, 3 * time.Second, []byte("ping"), clock, nil, nil})
+		defer keepaliveConn.Close()
+
+		Convey("When the max lifetime is about to elapse", func() {
+			go keepaliveConn.Serve(ctx)
+
+			clock.Advance(3 * time.Second)
+
+			Convey("Then a KEEPALIVE frame should be sent", func() {
+				f, err := conn.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, frame.FlagRespond)
+				So(f.(*frame.KeepaliveFrame).Data, ShouldResemble, []byte("ping"))
+			})
+		})
+
+		Convey("When no frame received in the max lifetime", func() {
+			halfOpen := &halfOpenConn{NewFrameChan(8), make(chan struct{})}
+			keepaliveConn := NewKeepaliveConn(halfOpen, &KeepaliveOption{time.Second, 3 * time.Second, nil, clock, nil, nil})
+
+			go keepaliveConn.Serve(ctx)
+
+			done := make(chan error, 1)
+
+			go func() {
+				_, err := keepaliveConn.Recv(ctx)
+
+				done <- err
+			}()
+
+			var err error
+
+		wait:
+			for {
+				clock.Advance(time.Second)
+
+				select {
+				case err = <-done:
+					break wait
+				case <-time.After(time.Millisecond):
+				}
+			}
+
+			Convey("Then the receiving should be timeout", func() {
+				So(err, ShouldEqual, ErrKeepaliveTimeout)
+				So(ctx.Err(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestKeepaliveRespondsToPeer(t *testing.T) {
+	Convey("Given a keepalive connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := NewFrameChan(1)
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Minute, time.Hour, nil, newFakeClock(), nil, nil})
+		defer keepaliveConn.Close()
+
+		Convey("When a KEEPALIVE requested a response received", func() {
+			So(conn.Send(ctx, frame.NewKeepaliveFrame(true, 123, []byte("ping"))), ShouldBeNil)
+
+			f, err := keepaliveConn.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(f.Type(), ShouldEqual, frame.TypeKeepalive)
+
+			Convey("Then a KEEPALIVE should be echoed with the same data and without RESPOND", func() {
+				f, err := conn.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, 0)
+				So(f.(*frame.KeepaliveFrame).Data, ShouldResemble, []byte("ping"))
+
+				Convey("And the last received position and data should be exposed", func() {
+					position, data := keepaliveConn.LastReceived()
+
+					So(position, ShouldEqual, 123)
+					So(data, ShouldResemble, []byte("ping"))
+				})
+			})
+		})
+	})
+}
+
+func TestKeepaliveAdvertisesResumePosition(t *testing.T) {
+	Convey("Given a keepalive connection over a resumable connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := NewFrameChan(1)
+		state := NewResumptionState(NewResumeBuffer())
+		keepaliveConn := NewKeepaliveConn(NewResumableConn(conn, state), &KeepaliveOption{time.Minute, time.Hour, nil, newFakeClock(), nil, nil})
+		keepaliveConn.Resumption = state
+		defer keepaliveConn.Close()
+
+		Convey("When a payload and a KEEPALIVE requested a response received", func() {
+			payloadFrame := Text("hello").buildPayloadFrame(1, false)
+
+			So(conn.Send(ctx, payloadFrame), ShouldBeNil)
+			_, err := keepaliveConn.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			So(conn.Send(ctx, frame.NewKeepaliveFrame(true, 0, nil)), ShouldBeNil)
+			_, err = keepaliveConn.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then the KEEPALIVE echoed should advertise the position received", func() {
+				f, err := conn.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, 0)
+				So(f.(*frame.KeepaliveFrame).LastReceived, ShouldEqual, Position(payloadFrame.Size()))
+			})
+		})
+	})
+}
+
+func TestKeepaliveDataProvider(t *testing.T) {
+	Convey("Given a keepalive connection with the data provider and observer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var observed [][]byte
+
+		clock := newFakeClock()
+		conn := NewFrameChan(1)
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{
+			time.Second, 3 * time.Second, []byte("ping"), clock,
+			func() []byte { return []byte("healthy") },
+			func(data []byte) { observed = append(observed, data) },
+		})
+		defer keepaliveConn.Close()
+
+		Convey("When the max lifetime is about to elapse", func() {
+			go keepaliveConn.Serve(ctx)
+
+			clock.Advance(3 * time.Second)
+
+			Convey("Then the KEEPALIVE frame should carry the provided data", func() {
+				f, err := conn.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, frame.FlagRespond)
+				So(f.(*frame.KeepaliveFrame).Data, ShouldResemble, []byte("healthy"))
+
+				Convey("And the observer should see the data echoed by peer", func() {
+					So(conn.Send(ctx, frame.NewKeepaliveFrame(false, 0, []byte("healthy"))), ShouldBeNil)
+
+					_, err := keepaliveConn.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					So(observed, ShouldResemble, [][]byte{[]byte("healthy")})
+				})
+			})
+		})
+	})
+}
+
+func TestKeepaliveDeadlineExtendedByAnyFrame(t *testing.T) {
+	Convey("Given a keepalive connection driven by a fake clock", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		conn := NewFrameChan(1)
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Second, 3 * time.Second, nil, clock, nil, nil})
+		defer keepaliveConn.Close()
+
+		Convey("When a frame other than KEEPALIVE received before the max lifetime elapsed", func() {
+			clock.Advance(2 * time.Second)
+
+			So(conn.Send(ctx, frame.NewRequestNFrame(1, 8)), ShouldBeNil)
+
+			f, err := keepaliveConn.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(f.Type(), ShouldEqual, frame.TypeRequestN)
+
+			Convey("Then the deadline should be extended by the max lifetime", func() {
+				So(keepaliveConn.Deadline(), ShouldEqual, clock.Now().Add(3*time.Second))
+			})
+		})
+	})
+}
+
+func TestKeepaliveSentUnderInboundTraffic(t *testing.T) {
+	Convey("Given a keepalive connection driven by a fake clock", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		conn := NewFrameChan(1)
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Second, 3 * time.Second, nil, clock, nil, nil})
+		defer keepaliveConn.Close()
+
+		go keepaliveConn.Serve(ctx)
+
+		Convey("When a frame received within every interval", func() {
+			var sent []frame.Frame
+
+			for i := 0; i < 3; i++ {
+				So(conn.Send(ctx, frame.NewRequestNFrame(1, 8)), ShouldBeNil)
+
+				_, err := keepaliveConn.Recv(ctx)
+				So(err, ShouldBeNil)
+
+				clock.Advance(time.Second)
+
+				f, err := conn.Recv(ctx)
+				So(err, ShouldBeNil)
+
+				sent = append(sent, f)
+			}
+
+			Convey("Then a KEEPALIVE frame should still be sent on every interval", func() {
+				for _, f := range sent {
+					checkFrameHeader(f, 0, frame.TypeKeepalive, frame.FlagRespond)
+				}
+			})
+		})
+	})
+}
+
+// halfOpenConn accepts the frames sent, but never delivers a frame until closed.
+type halfOpenConn struct {
+	sent   *FrameChan
+	closed chan struct{}
+}
+
+func (conn *halfOpenConn) Send(ctx context.Context, f frame.Frame) error {
+	select {
+	case conn.sent.C <- f:
+	default:
+	}
+
+	return nil
+}
+
+func (conn *halfOpenConn) Recv(ctx context.Context) (frame.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-conn.closed:
+		return nil, io.EOF
+	}
+}
+
+func (conn *halfOpenConn) Close() error {
+	close(conn.closed)
+
+	return nil
+}
+
+func TestKeepaliveOnHalfOpenConnection(t *testing.T) {
+	Convey("Given a keepalive connection on a half-open connection", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		conn := &halfOpenConn{NewFrameChan(8), make(chan struct{})}
+		keepaliveConn := NewKeepaliveConn(conn, &KeepaliveOption{time.Second, 3500 * time.Millisecond, nil, clock, nil, nil})
+
+		go keepaliveConn.Serve(ctx)
+
+		Convey("When the KEEPALIVE frames are sent without echo", func() {
+			done := make(chan error, 1)
+
+			go func() {
+				_, err := keepaliveConn.Recv(ctx)
+
+				done <- err
+			}()
+
+			var err error
+
+		wait:
+			for {
+				clock.Advance(time.Second)
+
+				select {
+				case err = <-done:
+					break wait
+				case <-time.After(time.Millisecond):
+				}
+			}
+
+			Convey("Then the connection should be closed with keepalive timeout", func() {
+				So(err, ShouldEqual, ErrKeepaliveTimeout)
+
+				f, _ := conn.sent.Recv(ctx)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, frame.FlagRespond)
+
+				_, ok := <-conn.closed
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestRequesterWithKeepaliveEcho(t *testing.T) {
+	Convey("Given a requester without the keepalive driver", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithKeepaliveEcho()).(*rSocketRequester)
+
+		Convey("When receive a KEEPALIVE frame requested a response", func() {
+			So(requester.HandleFrame(ctx, frame.NewKeepaliveFrame(true, 123, []byte("ping"))), ShouldBeNil)
+
+			Convey("Then the KEEPALIVE frame should be echoed", func() {
+				f, err := requests.Recv(ctx)
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeKeepalive, 0)
+
+				keepaliveFrame := f.(*frame.KeepaliveFrame)
+				So(keepaliveFrame.NeedRespond(), ShouldBeFalse)
+				So(keepaliveFrame.Data, ShouldResemble, []byte("ping"))
+			})
+		})
+
+		Convey("When receive a KEEPALIVE frame without requesting a response", func() {
+			So(requester.HandleFrame(ctx, frame.NewKeepaliveFrame(false, 123, []byte("pong"))), ShouldBeNil)
+
+			Convey("Then nothing should be sent", func() {
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+	})
+}
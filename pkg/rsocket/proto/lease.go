@@ -1,6 +1,22 @@
 package proto
 
-import "time"
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+var (
+	// ErrLeaseExpired is returned when send a request without a valid lease.
+	ErrLeaseExpired = errors.New("lease expired")
+
+	// ErrLeaseExhausted is returned when send a request after the requests of lease used up.
+	ErrLeaseExhausted = errors.New("lease exhausted")
+)
 
 // LeaseOptions configures the LEASE frame
 type LeaseOption struct {
@@ -15,3 +31,124 @@ func NewLeaseOption() *LeaseOption {
 func (lease *LeaseOption) Enabled() bool {
 	return lease.TimeToLive > 0 && lease.Requests > 0
 }
+
+// Lease tracks the requests granted by the latest LEASE frame.
+type Lease struct {
+	clock    Clock
+	lock     sync.Mutex
+	expiry   time.Time
+	requests uint32
+}
+
+// NewLease creates a Lease without any request granted, which expires with the clock.
+func NewLease(clock Clock) *Lease {
+	if clock == nil {
+		clock = RealClock
+	}
+
+	return &Lease{clock: clock}
+}
+
+// Grant replaces the current lease with the requests valid for the time to live,
+// the lease is rejected with frame.ErrInvalidLease if the time to live is out of range.
+func (lease *Lease) Grant(ttl time.Duration, requests uint32) error {
+	if !frame.ValidTimeToLive(ttl) {
+		return frame.ErrInvalidLease
+	}
+
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+
+	lease.expiry = lease.clock.Now().Add(ttl)
+	lease.requests = requests
+
+	return nil
+}
+
+// Expired indicates the lease is no longer valid.
+func (lease *Lease) Expired() bool {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+
+	return lease.expired()
+}
+
+func (lease *Lease) expired() bool {
+	return !lease.clock.Now().Before(lease.expiry)
+}
+
+// Remaining returns the number of requests may be sent, or 0 if expired.
+func (lease *Lease) Remaining() uint32 {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+
+	if lease.expired() {
+		return 0
+	}
+
+	return lease.requests
+}
+
+// Acquire uses one of the requests granted.
+func (lease *Lease) Acquire() error {
+	lease.lock.Lock()
+	defer lease.lock.Unlock()
+
+	if lease.expired() {
+		return ErrLeaseExpired
+	}
+
+	if lease.requests == 0 {
+		return ErrLeaseExhausted
+	}
+
+	lease.requests--
+
+	return nil
+}
+
+// LeaseSender grants the leases to the peer with the LEASE frames, periodically or on demand,
+// e.g. a throttling responder grants the requests it is able to serve in each period.
+type LeaseSender struct {
+	Conn
+	Lease    *LeaseOption  // The requests and time to live granted periodically.
+	Interval time.Duration // Time between LEASE frames granted periodically.
+	Metadata []byte        // The metadata attached to LEASE frames granted periodically, or nil if not attached.
+	ticker   Ticker
+}
+
+// NewLeaseSender creates a LeaseSender grants the lease every interval on the connection.
+func NewLeaseSender(conn Conn, lease *LeaseOption, interval time.Duration, metadata []byte, clock Clock) *LeaseSender {
+	if clock == nil {
+		clock = RealClock
+	}
+
+	return &LeaseSender{conn, lease, interval, metadata, clock.NewTicker(interval)}
+}
+
+// Serve grants the lease immediately and then every interval, until the context done or failed to send.
+func (sender *LeaseSender) Serve(ctx context.Context) error {
+	defer sender.ticker.Stop()
+
+	for {
+		if err := sender.Grant(ctx, int(sender.Lease.Requests), sender.Lease.TimeToLive, sender.Metadata); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sender.ticker.C():
+		}
+	}
+}
+
+// Grant sends a LEASE frame grants the requests valid for the time to live,
+// returns frame.ErrInvalidLease if the requests or time to live is out of range.
+func (sender *LeaseSender) Grant(ctx context.Context, requests int, ttl time.Duration, metadata []byte) error {
+	if requests < 0 || uint64(requests) > math.MaxUint32 || !frame.ValidTimeToLive(ttl) {
+		return frame.ErrInvalidLease
+	}
+
+	return sender.Send(ctx, frame.NewLeaseFrame(ttl, uint32(requests), metadata))
+}
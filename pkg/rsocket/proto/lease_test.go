@@ -0,0 +1,191 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLeaseExpiry(t *testing.T) {
+	Convey("Given a lease granted 2 requests for 10 seconds", t, func() {
+		clock := newFakeClock()
+		lease := NewLease(clock)
+
+		So(lease.Acquire(), ShouldEqual, ErrLeaseExpired)
+
+		lease.Grant(10*time.Second, 2)
+
+		So(lease.Remaining(), ShouldEqual, 2)
+
+		Convey("When send requests before expired", func() {
+			clock.Advance(9 * time.Second)
+
+			Convey("Then the requests should be limited by the lease", func() {
+				So(lease.Acquire(), ShouldBeNil)
+				So(lease.Acquire(), ShouldBeNil)
+				So(lease.Acquire(), ShouldEqual, ErrLeaseExhausted)
+			})
+		})
+
+		Convey("When the time to live elapsed", func() {
+			clock.Advance(10 * time.Second)
+
+			Convey("Then the lease should be expired", func() {
+				So(lease.Expired(), ShouldBeTrue)
+				So(lease.Remaining(), ShouldEqual, 0)
+				So(lease.Acquire(), ShouldEqual, ErrLeaseExpired)
+			})
+
+			Convey("Then a new lease should be honored", func() {
+				So(lease.Grant(time.Second, 1), ShouldBeNil)
+
+				So(lease.Acquire(), ShouldBeNil)
+			})
+
+			Convey("Then a lease without time to live should be rejected", func() {
+				So(lease.Grant(0, 1), ShouldEqual, frame.ErrInvalidLease)
+
+				So(lease.Expired(), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestRequesterHonorsLease(t *testing.T) {
+	Convey("Given a requester granted a lease of 3 requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(16)
+		lease := NewLease(newFakeClock())
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithLease(lease), WithFlowControl(LazyStrategy{})).(*rSocketRequester)
+
+		So(requester.HandleFrame(ctx, frame.NewLeaseFrame(time.Minute, 3, nil)), ShouldBeNil)
+		So(lease.Remaining(), ShouldEqual, 3)
+
+		Convey("When send requests of mixed types", func() {
+			So(requester.FireAndForget(ctx, Text("foo")), ShouldBeNil)
+
+			stream, err := requester.RequestStream(ctx, Text("bar"))
+			So(err, ShouldBeNil)
+
+			So(requester.HandleFrame(ctx, frame.NewPayloadFrame(3, false, false, true, false, nil, []byte("baz"))), ShouldBeNil)
+			payload, err := stream.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(payload.Text(), ShouldEqual, "baz")
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, 0)
+			f, _ = requests.Recv(ctx)
+			checkFrameHeader(f, 3, frame.TypeRequestStream, 0)
+			f, _ = requests.Recv(ctx)
+			checkFrameHeader(f, 3, frame.TypeRequestN, 0)
+
+			Convey("Then the REQUEST_N should not consume the lease", func() {
+				So(lease.Remaining(), ShouldEqual, 1)
+
+				_, err := requester.RequestChannel(ctx, &PayloadStream{C: make(chan *Result)})
+				So(err, ShouldBeNil)
+				So(lease.Remaining(), ShouldEqual, 0)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 5, frame.TypeRequestChannel, 0)
+
+				Convey("Then the 4th request should be rejected", func() {
+					_, err := requester.RequestResponse(ctx, Text("qux"))
+
+					So(err, ShouldEqual, ErrLeaseExhausted)
+					So(requests.C, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
+
+func TestRequesterRejectsRequestsBeyondLease(t *testing.T) {
+	Convey("Given a requester granted a lease of 2 requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		requests := NewFrameChan(4)
+		lease := NewLease(clock)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithLease(lease)).(*rSocketRequester)
+
+		So(requester.HandleFrame(ctx, frame.NewLeaseFrame(time.Minute, 2, nil)), ShouldBeNil)
+
+		Convey("When send requests within the time to live", func() {
+			So(requester.FireAndForget(ctx, Text("foo")), ShouldBeNil)
+			So(requester.FireAndForget(ctx, Text("bar")), ShouldBeNil)
+
+			Convey("Then exactly two requests should be sent before rejection", func() {
+				_, err := requester.RequestStream(ctx, Text("baz"))
+
+				So(err, ShouldEqual, ErrLeaseExhausted)
+				So(len(requests.C), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When send a request after the time to live elapsed", func() {
+			clock.Advance(time.Minute)
+
+			Convey("Then the request should be rejected as the lease expired", func() {
+				So(requester.FireAndForget(ctx, Text("foo")), ShouldEqual, ErrLeaseExpired)
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLeaseSender(t *testing.T) {
+	Convey("Given a lease sender grants 5 requests every 10 seconds", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		clock := newFakeClock()
+		conn := NewFrameChan(1)
+		sender := NewLeaseSender(conn, &LeaseOption{15 * time.Second, 5}, 10*time.Second, []byte("quota"), clock)
+
+		Convey("When serve the lease periodically", func() {
+			go sender.Serve(ctx)
+
+			f, err := conn.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then a LEASE frame should be sent immediately and once the interval elapsed", func() {
+				checkFrameHeader(f, 0, frame.TypeLease, frame.FlagMetadata)
+
+				leaseFrame := f.(*frame.LeaseFrame)
+				So(leaseFrame.TimeToLive, ShouldEqual, 15*time.Second)
+				So(leaseFrame.NumberOfRequests, ShouldEqual, 5)
+				So(leaseFrame.Metadata, ShouldResemble, frame.Metadata("quota"))
+
+				clock.Advance(10 * time.Second)
+
+				f, err := conn.Recv(ctx)
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeLease, frame.FlagMetadata)
+			})
+		})
+
+		Convey("When grant a lease manually", func() {
+			So(sender.Grant(ctx, 2, time.Second, nil), ShouldBeNil)
+
+			Convey("Then a LEASE frame without metadata should be sent", func() {
+				f, err := conn.Recv(ctx)
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 0, frame.TypeLease, 0)
+				So(f.(*frame.LeaseFrame).NumberOfRequests, ShouldEqual, 2)
+			})
+
+			Convey("Then a lease out of range should be rejected", func() {
+				So(sender.Grant(ctx, -1, time.Second, nil), ShouldEqual, frame.ErrInvalidLease)
+				So(sender.Grant(ctx, 1, 0, nil), ShouldEqual, frame.ErrInvalidLease)
+			})
+		})
+	})
+}
@@ -0,0 +1,54 @@
+package proto
+
+import "github.com/flier/rsocket-go/pkg/rsocket/frame"
+
+// DataMimeTypeMimeType is the MIME type of the composite metadata entry overrides the data MIME type of a payload.
+const DataMimeTypeMimeType = "message/x.rsocket.mime-type.v0"
+
+// WithDataMimeType appends the data MIME type to the composite metadata of payload,
+// which overrides the data MIME type of the connection for this payload.
+func (payload *Payload) WithDataMimeType(mime string) (*Payload, error) {
+	var content []byte
+
+	if id, ok := frame.WellKnownMimeID(mime); ok {
+		content = []byte{frame.WellKnownMimeFlag | id}
+	} else if len(mime) == 0 || len(mime) > frame.MaxMimeLength {
+		return nil, frame.ErrInvalidMimeType
+	} else {
+		content = append([]byte{byte(len(mime) - 1)}, mime...)
+	}
+
+	metadata, err := payload.Metadata.AppendEntry(DataMimeTypeMimeType, content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.WithMetadata(metadata), nil
+}
+
+// DataMimeType returns the data MIME type in the composite metadata of payload,
+// or false if the payload uses the data MIME type of the connection.
+func (payload *Payload) DataMimeType() (string, bool) {
+	if !payload.HasMetadata {
+		return "", false
+	}
+
+	content, ok := payload.Metadata.StringEntry(DataMimeTypeMimeType)
+
+	if !ok || len(content) == 0 {
+		return "", false
+	}
+
+	if content[0]&frame.WellKnownMimeFlag != 0 {
+		mime, ok := frame.WellKnownMimeTypes[content[0]&^frame.WellKnownMimeFlag]
+
+		return mime, ok
+	}
+
+	if n := int(content[0]) + 1; len(content) == 1+n {
+		return string(content[1:]), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,67 @@
+package proto
+
+import (
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// StreamObserver observes the lifecycle of streams, e.g. opens a tracing span when a stream starts,
+// and closes it once the stream completed or failed.
+//
+// The callbacks run inline in the dispatching of frames, they should not block.
+type StreamObserver interface {
+	// OnStreamStart is called when a stream started with the request payload.
+	OnStreamStart(streamID StreamID, requestType frame.Type, payload *Payload)
+
+	// OnStreamPayload is called for each payload received or sent by the responder on a stream.
+	OnStreamPayload(streamID StreamID, payload *Payload)
+
+	// OnStreamComplete is called when a stream completed.
+	OnStreamComplete(streamID StreamID)
+
+	// OnStreamError is called when a stream terminated with an error or cancelled.
+	OnStreamError(streamID StreamID, err error)
+}
+
+// WithStreamObserver observes the lifecycle of the streams requested.
+func WithStreamObserver(observer StreamObserver) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.observer = streamObserver{observer}
+	}
+}
+
+// WithResponderStreamObserver observes the lifecycle of the streams responded.
+func WithResponderStreamObserver(observer StreamObserver) ResponderOption {
+	return func(responder *rSocketResponder) {
+		responder.observer = streamObserver{observer}
+	}
+}
+
+// streamObserver skips the callbacks if no observer configured.
+type streamObserver struct {
+	StreamObserver
+}
+
+func (observer streamObserver) started(streamID StreamID, requestType frame.Type, payload *Payload) {
+	if observer.StreamObserver != nil {
+		observer.OnStreamStart(streamID, requestType, payload)
+	}
+}
+
+func (observer streamObserver) next(streamID StreamID, payload *Payload) {
+	if observer.StreamObserver != nil {
+		observer.OnStreamPayload(streamID, payload)
+	}
+}
+
+// terminated reports the stream completed if err is nil, or failed with err.
+func (observer streamObserver) terminated(streamID StreamID, err error) {
+	if observer.StreamObserver == nil {
+		return
+	}
+
+	if err == nil {
+		observer.OnStreamComplete(streamID)
+	} else {
+		observer.OnStreamError(streamID, err)
+	}
+}
@@ -0,0 +1,137 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingObserver struct {
+	sync.Mutex
+	events     []string
+	terminated chan StreamID
+}
+
+var _ StreamObserver = (*recordingObserver)(nil)
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{terminated: make(chan StreamID, 1)}
+}
+
+func (observer *recordingObserver) record(format string, args ...interface{}) {
+	observer.Lock()
+	defer observer.Unlock()
+
+	observer.events = append(observer.events, fmt.Sprintf(format, args...))
+}
+
+func (observer *recordingObserver) Events() []string {
+	observer.Lock()
+	defer observer.Unlock()
+
+	return append([]string(nil), observer.events...)
+}
+
+func (observer *recordingObserver) OnStreamStart(streamID StreamID, requestType frame.Type, payload *Payload) {
+	observer.record("start %d %s %s", streamID, requestType, payload.Text())
+}
+
+func (observer *recordingObserver) OnStreamPayload(streamID StreamID, payload *Payload) {
+	observer.record("payload %d %s", streamID, payload.Text())
+}
+
+func (observer *recordingObserver) OnStreamComplete(streamID StreamID) {
+	observer.record("complete %d", streamID)
+
+	observer.terminated <- streamID
+}
+
+func (observer *recordingObserver) OnStreamError(streamID StreamID, err error) {
+	observer.record("error %d %s", streamID, err)
+
+	observer.terminated <- streamID
+}
+
+func TestRequesterStreamObserver(t *testing.T) {
+	Convey("Given a requester with a stream observer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		observer := newRecordingObserver()
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithStreamObserver(observer)).(*rSocketRequester)
+
+		Convey("When a stream completed by the responder", func() {
+			stream, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+			So(requester.HandleFrame(ctx, Text("bar").buildPayloadFrame(1, true)), ShouldBeNil)
+
+			Convey("Then the lifecycle of stream should be observed", func() {
+				So(<-observer.terminated, ShouldEqual, 1)
+				So(observer.Events(), ShouldResemble, []string{
+					"start 1 REQUEST_STREAM hello",
+					"payload 1 foo",
+					"payload 1 bar",
+					"complete 1",
+				})
+
+				payload, err := stream.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload.Text(), ShouldEqual, "foo")
+			})
+		})
+
+		Convey("When a stream cancelled by the requester", func() {
+			streamCtx, streamCancel := context.WithCancel(ctx)
+
+			_, err := requester.RequestStream(streamCtx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			streamCancel()
+
+			Convey("Then the stream should be observed as failed", func() {
+				So(<-observer.terminated, ShouldEqual, 1)
+				So(observer.Events(), ShouldResemble, []string{
+					"start 1 REQUEST_STREAM hello",
+					"error 1 context canceled",
+				})
+			})
+		})
+	})
+}
+
+func TestResponderStreamObserver(t *testing.T) {
+	Convey("Given a responder with a stream observer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		observer := newRecordingObserver()
+		responses := NewFrameChan(4)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				return textStream(2), nil
+			},
+		}, WithResponderStreamObserver(observer))
+
+		Convey("When a stream completed by the handler", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 8, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then the lifecycle of stream should be observed", func() {
+				So(<-observer.terminated, ShouldEqual, 1)
+				So(observer.Events(), ShouldResemble, []string{
+					"start 1 REQUEST_STREAM hello",
+					"payload 1 item-0",
+					"payload 1 item-1",
+					"complete 1",
+				})
+			})
+		})
+	})
+}
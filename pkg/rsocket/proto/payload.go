@@ -1,8 +1,14 @@
 package proto
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"sync"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
 )
@@ -38,6 +44,56 @@ func JSON(v interface{}) (*Payload, error) {
 	return &Payload{false, nil, []byte(data)}, nil
 }
 
+// DefaultMaxDataSize is the maximum size of data read by PayloadFromReader.
+const DefaultMaxDataSize = 16 << 20
+
+// ErrDataTooLarge is returned when read data exceeds the limit.
+var ErrDataTooLarge = errors.New("data too large")
+
+// ErrStreamClosed is returned when request payloads on a stream already completed, failed or cancelled.
+var ErrStreamClosed = errors.New("stream closed")
+
+// PayloadFromReader reads all data from the reader into a Payload, which is limited to DefaultMaxDataSize.
+//
+// The MIME type of data is carried as the data MIME type entry of composite metadata if not empty.
+func PayloadFromReader(r io.Reader, mime string) (*Payload, error) {
+	return LimitedPayloadFromReader(r, mime, DefaultMaxDataSize)
+}
+
+// LimitedPayloadFromReader reads all data from the reader into a Payload, fails if the data exceeds the max size.
+//
+// The MIME type of data is carried as the data MIME type entry of composite metadata if not empty.
+func LimitedPayloadFromReader(r io.Reader, mime string, maxSize int64) (*Payload, error) {
+	limit := maxSize
+
+	if limit < math.MaxInt64 {
+		limit++ // Reads one more byte to tell the data exceeds the max size.
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrDataTooLarge
+	}
+
+	payload := Bytes(data)
+
+	if mime != "" {
+		return payload.WithDataMimeType(mime)
+	}
+
+	return payload, nil
+}
+
+// DataReader returns a reader reads from the data.
+func (payload *Payload) DataReader() io.Reader {
+	return bytes.NewReader(payload.Data)
+}
+
 // Text returnes the data as plain/text.
 func (payload *Payload) Text() string {
 	return string(payload.Data)
@@ -56,35 +112,303 @@ type Result struct {
 	Payload *Payload
 
 	Err error
+
+	pooled bool
+	source frame.Frame // The frame read with an Allocator, which is released once the payload consumed.
 }
 
 // Ok returns a Result with Payload
 func Ok(payload *Payload) *Result {
-	return &Result{payload, nil}
+	return &Result{Payload: payload}
 }
 
 // Err returns a Result with error
 func Err(err error) *Result {
-	return &Result{nil, err}
+	return &Result{Err: err}
+}
+
+// ErrResult returns a Result with the error mapped to a protocol error,
+// an error other than *Error is mapped to APPLICATION_ERROR with its message.
+func ErrResult(err error) *Result {
+	if err == nil {
+		return &Result{}
+	}
+
+	return Err(toError(err))
+}
+
+func toError(err error) *Error {
+	if err, ok := err.(*Error); ok {
+		return err
+	}
+
+	return frame.ErrApplicationError.WithMessage(err.Error())
 }
 
 // PayloadStream returns the payload or error for the stream or channel.
 type PayloadStream struct {
 	C <-chan *Result
+
+	lock      sync.Mutex
+	closed    bool
+	cause     error
+	callbacks []func(error)
+	requestN  func(n uint32) error // Requests more payloads from the responder, or nil if not requestable.
+	paused    bool
+	withheld  uint32        // The payloads withheld from requesting while paused.
+	cancelled chan struct{} // Closed once the stream cancelled, or nil if the stream only terminates locally.
+	cancel    sync.Once
+	streamID  StreamID        // The stream the payloads belong to, or 0 if not bound to a stream.
+	ctx       context.Context // The context scoped to the stream, or nil if not created yet.
+	lost      error           // The error failed the stream before delivered, returned once the stream closed.
+	failure   error           // The error cancelled the stream with, which is sent with an ERROR frame for a channel.
+}
+
+// NewPayloadPipe creates a stream and the sink sending to it with the capacity,
+// the sink stops accepting payloads once the stream cancelled.
+func NewPayloadPipe(capacity int) (*PayloadStream, *PayloadSink) {
+	c := make(chan *Result, capacity)
+	cancelled := make(chan struct{})
+
+	return &PayloadStream{C: c, cancelled: cancelled}, &PayloadSink{C: c, cancelled: cancelled}
+}
+
+// Cancel the stream, the sink created with it returns context.Canceled for the pending and further sends,
+// the stream of a request stops receiving the payloads and tells the responder with a CANCEL frame.
+func (s *PayloadStream) Cancel() {
+	s.cancel.Do(func() {
+		if s.cancelled != nil {
+			close(s.cancelled)
+		}
+	})
+
+	s.terminate(context.Canceled)
+}
+
+// CancelWithError cancels the stream like Cancel,
+// but the stream of a channel tells the responder with an ERROR frame, which terminates both directions.
+func (s *PayloadStream) CancelWithError(err error) {
+	s.lock.Lock()
+	if !s.closed && s.failure == nil {
+		s.failure = err
+	}
+	s.lock.Unlock()
+
+	s.Cancel()
+}
+
+// cancelError returns the error the stream cancelled with, or nil if cancelled without an error.
+func (s *PayloadStream) cancelError() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.failure
+}
+
+// Pause stops requesting more payloads until resumed without cancelling the stream,
+// the payloads already requested are still delivered.
+func (s *PayloadStream) Pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.paused = true
+}
+
+// Resume requests the payloads withheld while paused, and continues requesting payloads.
+func (s *PayloadStream) Resume() error {
+	s.lock.Lock()
+
+	n := s.withheld
+	s.paused = false
+	s.withheld = 0
+	s.lock.Unlock()
+
+	if n == 0 || s.requestN == nil {
+		return nil
+	}
+
+	return s.requestN(n)
 }
 
-// Recv the payload or error for the stream or channel.
+// Request asks the responder for n more payloads with a REQUEST_N frame, in addition to those requested by the flow control,
+// so the consumer could pull the payloads at its own pace, returns ErrStreamClosed if the stream completed, failed or cancelled.
+func (s *PayloadStream) Request(n uint32) error {
+	s.lock.Lock()
+	closed := s.closed
+	s.lock.Unlock()
+
+	if closed {
+		return ErrStreamClosed
+	}
+
+	if n == 0 || s.requestN == nil {
+		return nil
+	}
+
+	return s.requestN(n)
+}
+
+// request requests n more payloads, or withholds them while paused.
+func (s *PayloadStream) request(n uint32) error {
+	s.lock.Lock()
+
+	if s.paused {
+		s.withheld += n
+		s.lock.Unlock()
+
+		return nil
+	}
+
+	s.lock.Unlock()
+
+	if s.requestN == nil {
+		return nil
+	}
+
+	return s.requestN(n)
+}
+
+// Context returns a context scoped to the stream, which is cancelled once the stream completes, fails or is cancelled,
+// the background work of the stream can be bound to it.
+//
+// The context carries the stream ID if the stream is bound to a stream, see StreamIDFromContext.
+func (s *PayloadStream) Context() context.Context {
+	s.lock.Lock()
+
+	if s.ctx != nil {
+		ctx := s.ctx
+		s.lock.Unlock()
+
+		return ctx
+	}
+
+	ctx := context.Background()
+
+	if s.streamID != 0 {
+		ctx = ContextWithStreamID(ctx, s.streamID)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.ctx = ctx
+	s.lock.Unlock()
+
+	s.OnClose(func(error) { cancel() })
+
+	return ctx
+}
+
+// bind the stream to the stream ID, which is carried by the context of stream created after bound.
+func (s *PayloadStream) bind(streamID StreamID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.streamID = streamID
+}
+
+// OnClose registers a callback which be called once when the stream completes, fails or is cancelled,
+// with the error of the stream, or nil if completed.
+//
+// The callback is called immediately if the stream has been closed.
+func (s *PayloadStream) OnClose(callback func(err error)) {
+	s.lock.Lock()
+
+	if !s.closed {
+		s.callbacks = append(s.callbacks, callback)
+		s.lock.Unlock()
+
+		return
+	}
+
+	cause := s.cause
+	s.lock.Unlock()
+
+	callback(cause)
+}
+
+// fail terminates the stream with the error could not be delivered, the consumer receives it once the stream closed.
+func (s *PayloadStream) fail(err error) {
+	s.lock.Lock()
+	if !s.closed {
+		s.lost = err
+	}
+	s.lock.Unlock()
+
+	s.terminate(err)
+}
+
+// takeLost returns the error failed the stream once, or nil if the stream is not failed before delivered.
+func (s *PayloadStream) takeLost() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.lost
+	s.lost = nil
+
+	return err
+}
+
+func (s *PayloadStream) terminate(cause error) {
+	s.lock.Lock()
+
+	if s.closed {
+		s.lock.Unlock()
+
+		return
+	}
+
+	s.closed = true
+	s.cause = cause
+	callbacks := s.callbacks
+	s.callbacks = nil
+	s.lock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(cause)
+	}
+}
+
+// Recv the payload or error for the stream or channel,
+// returns the error of context if it is done first, which never terminates the stream.
 func (s *PayloadStream) Recv(ctx context.Context) (*Payload, error) {
 	select {
 	case <-ctx.Done():
+		// The call expired, e.g. a poll timeout, the stream is still alive and could be received again.
 		return nil, ctx.Err()
 
 	case result, ok := <-s.C:
 		if ok && result != nil {
-			return result.Payload, result.Err
+			payload, err := result.Payload, result.Err
+
+			// The result is never referenced after received.
+			result.release()
+
+			if payload == nil {
+				s.terminate(err)
+			}
+
+			return payload, err
 		}
 
-		return nil, nil
+		s.terminate(nil)
+
+		return nil, s.takeLost()
+	}
+}
+
+// ForEach calls the function with each payload until the stream completes, fails or the function returns an error.
+func (s *PayloadStream) ForEach(ctx context.Context, fn func(payload *Payload) error) error {
+	for {
+		payload, err := s.Recv(ctx)
+
+		if err != nil {
+			return err
+		} else if payload == nil {
+			return nil
+		}
+
+		if err = fn(payload); err != nil {
+			return err
+		}
 	}
 }
 
@@ -92,13 +416,24 @@ func (s *PayloadStream) Recv(ctx context.Context) (*Payload, error) {
 func (s *PayloadStream) TryRecv(ctx context.Context) (*Result, bool) {
 	select {
 	case <-ctx.Done():
+		// The call expired, the stream is still alive and could be received again.
 		return Err(ctx.Err()), true
 
 	case result, ok := <-s.C:
 		if ok && result != nil {
+			if result.Payload == nil {
+				s.terminate(result.Err)
+			}
+
 			return result, true
 		}
 
+		s.terminate(nil)
+
+		if err := s.takeLost(); err != nil {
+			return Err(err), true
+		}
+
 		return nil, true
 	default:
 		return nil, false
@@ -108,6 +443,8 @@ func (s *PayloadStream) TryRecv(ctx context.Context) (*Result, bool) {
 // PayloadSink send the payload or erro to the stream or channel.
 type PayloadSink struct {
 	C chan<- *Result
+
+	cancelled <-chan struct{} // Closed once the stream cancelled, or nil if never.
 }
 
 // Close the stream
@@ -117,33 +454,43 @@ func (s *PayloadSink) Close() error {
 }
 
 // Send the payload or erro to the stream or channel.
+//
+// Returns context.Canceled if the stream created by NewPayloadPipe has been cancelled.
 func (s *PayloadSink) Send(ctx context.Context, result *Result) error {
+	select {
+	case <-s.cancelled:
+		return context.Canceled
+	default:
+	}
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-s.cancelled:
+		return context.Canceled
 	case s.C <- result:
 		return nil
 	}
 }
 
-func (payload *Payload) buildRequestResponseFrame(streamID StreamID) *frame.RequestResponseFrame {
-	return frame.NewRequestResponseFrame(streamID, false, payload.HasMetadata, payload.Metadata, payload.Data)
+func (payload *Payload) buildRequestResponseFrame(streamID StreamID, follows bool) *frame.RequestResponseFrame {
+	return frame.NewRequestResponseFrame(streamID, follows, payload.HasMetadata, payload.Metadata, payload.Data)
 }
 
-func (payload *Payload) buildRequestFireAndForgetFrame(streamID StreamID) *frame.RequestFireAndForgetFrame {
-	return frame.NewRequestFireAndForgetFrame(streamID, false, payload.HasMetadata, payload.Metadata, payload.Data)
+func (payload *Payload) buildRequestFireAndForgetFrame(streamID StreamID, follows bool) *frame.RequestFireAndForgetFrame {
+	return frame.NewRequestFireAndForgetFrame(streamID, follows, payload.HasMetadata, payload.Metadata, payload.Data)
 }
 
-func (payload *Payload) buildRequestStreamFrame(streamID StreamID, initReqs uint32) *frame.RequestStreamFrame {
-	return frame.NewRequestStreamFrame(streamID, false, initReqs, payload.HasMetadata, payload.Metadata, payload.Data)
+func (payload *Payload) buildRequestStreamFrame(streamID StreamID, follows bool, initReqs uint32) *frame.RequestStreamFrame {
+	return frame.NewRequestStreamFrame(streamID, follows, initReqs, payload.HasMetadata, payload.Metadata, payload.Data)
 }
 
-func (payload *Payload) buildRequestChannelFrame(streamID StreamID, complete bool, initReqs uint32) *frame.RequestChannelFrame {
+func (payload *Payload) buildRequestChannelFrame(streamID StreamID, follows bool, complete bool, initReqs uint32) *frame.RequestChannelFrame {
 	if payload == nil {
 		return frame.NewRequestChannelFrame(streamID, false, complete, initReqs, false, nil, nil)
 	}
 
-	return frame.NewRequestChannelFrame(streamID, false, complete, initReqs, payload.HasMetadata, payload.Metadata, payload.Data)
+	return frame.NewRequestChannelFrame(streamID, follows, complete, initReqs, payload.HasMetadata, payload.Metadata, payload.Data)
 }
 
 func (payload *Payload) buildPayloadFrame(streamID StreamID, complete bool) *frame.PayloadFrame {
@@ -153,3 +500,9 @@ func (payload *Payload) buildPayloadFrame(streamID StreamID, complete bool) *fra
 func buildCompleteFrame(streamID StreamID) *frame.PayloadFrame {
 	return frame.NewPayloadFrame(streamID, false, true, false, false, nil, nil)
 }
+
+func buildErrorFrame(streamID StreamID, err error) *frame.ErrorFrame {
+	e := toError(err)
+
+	return frame.NewErrorFrame(streamID, e.Code, e.Data)
+}
@@ -0,0 +1,451 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type closeRecorder struct {
+	calls int32
+	cause chan error
+}
+
+func recordClose(stream *PayloadStream) *closeRecorder {
+	recorder := &closeRecorder{cause: make(chan error, 1)}
+
+	stream.OnClose(func(err error) {
+		if atomic.AddInt32(&recorder.calls, 1) == 1 {
+			recorder.cause <- err
+		}
+	})
+
+	return recorder
+}
+
+func TestPayloadStreamOnClose(t *testing.T) {
+	Convey("Given a payload stream", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		c := make(chan *Result, 2)
+		stream := &PayloadStream{C: c}
+		recorder := recordClose(stream)
+
+		Convey("When the stream completes", func() {
+			c <- Ok(Text("hello"))
+			close(c)
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for {
+						if payload, err := stream.Recv(ctx); payload == nil && err == nil {
+							return
+						}
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			Convey("Then the callback should be called once without error", func() {
+				So(<-recorder.cause, ShouldBeNil)
+				So(atomic.LoadInt32(&recorder.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the stream fails", func() {
+			boom := errors.New("boom")
+
+			c <- Err(boom)
+
+			_, err := stream.Recv(ctx)
+			So(err, ShouldEqual, boom)
+
+			Convey("Then the callback should be called once with the error", func() {
+				So(<-recorder.cause, ShouldEqual, boom)
+
+				close(c)
+
+				payload, err := stream.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+				So(atomic.LoadInt32(&recorder.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the stream is cancelled", func() {
+			stream.Cancel()
+
+			Convey("Then the callback should be called once with the cancellation", func() {
+				So(<-recorder.cause, ShouldEqual, context.Canceled)
+
+				close(c)
+				stream.Recv(ctx)
+				So(atomic.LoadInt32(&recorder.calls), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a receive expired before any result", func() {
+			expired, cancel := context.WithTimeout(ctx, time.Millisecond)
+			defer cancel()
+
+			_, err := stream.Recv(expired)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+
+			result, ok := stream.TryRecv(expired)
+			So(ok, ShouldBeTrue)
+			So(result.Err, ShouldResemble, context.DeadlineExceeded)
+
+			Convey("Then the stream should be still alive", func() {
+				So(atomic.LoadInt32(&recorder.calls), ShouldEqual, 0)
+				So(stream.Request(1), ShouldBeNil)
+				So(stream.Context().Err(), ShouldBeNil)
+
+				c <- Ok(Text("hello"))
+
+				payload, err := stream.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload, ShouldResemble, Text("hello"))
+			})
+		})
+
+		Convey("When register a callback after the stream completed", func() {
+			close(c)
+			stream.Recv(ctx)
+
+			Convey("Then the callback should be called immediately", func() {
+				late := recordClose(stream)
+
+				So(<-late.cause, ShouldBeNil)
+				So(atomic.LoadInt32(&recorder.calls), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestRequestStreamOnCancel(t *testing.T) {
+	Convey("Given a requester requests a stream", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		requests := NewFrameChan(1)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		responses, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		recorder := recordClose(responses)
+
+		Convey("When the request is cancelled without receiving", func() {
+			cancel()
+
+			Convey("Then the callback should be called with the cancellation", func() {
+				select {
+				case err := <-recorder.cause:
+					So(err, ShouldEqual, context.Canceled)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeNil)
+				}
+			})
+		})
+	})
+}
+
+func TestPayloadFromReader(t *testing.T) {
+	Convey("Given a reader of data", t, func() {
+		data := bytes.Repeat([]byte("data"), 256)
+
+		Convey("When read the data into a payload", func() {
+			payload, err := PayloadFromReader(bytes.NewReader(data), "application/octet-stream")
+
+			So(err, ShouldBeNil)
+
+			Convey("Then the data should be round-tripped through the payload", func() {
+				mime, ok := payload.DataMimeType()
+
+				So(ok, ShouldBeTrue)
+				So(mime, ShouldEqual, "application/octet-stream")
+
+				read, err := ioutil.ReadAll(payload.DataReader())
+
+				So(err, ShouldBeNil)
+				So(read, ShouldResemble, data)
+			})
+		})
+
+		Convey("When read the data exceeds the limit", func() {
+			_, err := LimitedPayloadFromReader(bytes.NewReader(data), "", int64(len(data)-1))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrDataTooLarge)
+			})
+		})
+
+		Convey("When read the data without limit", func() {
+			payload, err := LimitedPayloadFromReader(bytes.NewReader(data), "", math.MaxInt64)
+
+			Convey("Then all data should be read", func() {
+				So(err, ShouldBeNil)
+				So(payload.Data, ShouldResemble, data)
+			})
+		})
+
+		Convey("When read the data with a malformed MIME type", func() {
+			_, err := PayloadFromReader(bytes.NewReader(data), string(bytes.Repeat([]byte("x"), 256)))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, frame.ErrInvalidMimeType)
+			})
+		})
+
+		Convey("When read the data without MIME type", func() {
+			payload, err := LimitedPayloadFromReader(bytes.NewReader(data), "", int64(len(data)))
+
+			Convey("Then the payload should have no metadata", func() {
+				So(err, ShouldBeNil)
+				So(payload.HasMetadata, ShouldBeFalse)
+				So(payload.Data, ShouldResemble, data)
+			})
+		})
+	})
+}
+
+func TestPayloadWithDataMimeType(t *testing.T) {
+	Convey("Given a payload with composite metadata", t, func() {
+		metadata, err := Metadata(nil).AppendEntry(RoutingMimeType, []byte("\x05hello"))
+		So(err, ShouldBeNil)
+
+		Convey("When override the data MIME type with a well-known MIME type", func() {
+			payload, err := Text(`{}`).WithMetadata(metadata).WithDataMimeType("application/json")
+			So(err, ShouldBeNil)
+
+			Convey("Then the data MIME type should be encoded as ID and decoded", func() {
+				content, ok := payload.Metadata.StringEntry(DataMimeTypeMimeType)
+				So(ok, ShouldBeTrue)
+				So(content, ShouldResemble, []byte{0x85})
+
+				mime, ok := payload.DataMimeType()
+				So(ok, ShouldBeTrue)
+				So(mime, ShouldEqual, "application/json")
+
+				routing, ok := payload.Metadata.StringEntry(RoutingMimeType)
+				So(ok, ShouldBeTrue)
+				So(string(routing), ShouldEqual, "\x05hello")
+			})
+		})
+
+		Convey("When override the data MIME type with a custom MIME type", func() {
+			payload, err := Text("hello").WithDataMimeType("text/x-custom")
+			So(err, ShouldBeNil)
+
+			Convey("Then the data MIME type should be decoded", func() {
+				mime, ok := payload.DataMimeType()
+				So(ok, ShouldBeTrue)
+				So(mime, ShouldEqual, "text/x-custom")
+			})
+		})
+
+		Convey("When override the data MIME type with an empty MIME type", func() {
+			_, err := Text("hello").WithDataMimeType("")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, frame.ErrInvalidMimeType)
+			})
+		})
+
+		Convey("When the data MIME type not overridden", func() {
+			_, ok := Text("hello").WithMetadata(metadata).DataMimeType()
+
+			Convey("Then the payload should use the data MIME type of connection", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestErrorRelayedAsPayload(t *testing.T) {
+	Convey("Given an application error with a custom code", t, func() {
+		err := frame.ErrorCode(0x00000301).WithMessage("out of stock")
+
+		Convey("When relay the error as a payload", func() {
+			payload := ErrorToPayload(err)
+
+			Convey("Then the error should be decoded from the payload", func() {
+				relayed, ok := ErrorFromPayload(payload)
+
+				So(ok, ShouldBeTrue)
+				So(relayed, ShouldResemble, err)
+			})
+		})
+
+		Convey("When decode a payload not an error", func() {
+			_, ok := ErrorFromPayload(Text("hello"))
+
+			Convey("Then it should not be decoded", func() {
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestJSONErrorRoundTrip(t *testing.T) {
+	type outOfStock struct {
+		Item      string `json:"item"`
+		Available int    `json:"available"`
+	}
+
+	Convey("Given a requester with a request in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(1)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		responses, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+		Convey("When the responder fails with a JSON error", func() {
+			jsonErr, err := JSONError(frame.ErrApplicationError, &outOfStock{"apple", 3})
+			So(err, ShouldBeNil)
+
+			buf, err := frame.Encode(buildErrorFrame(1, jsonErr))
+			So(err, ShouldBeNil)
+
+			f, err := frame.Decode(buf)
+			So(err, ShouldBeNil)
+			So(requester.HandleFrame(ctx, f), ShouldBeNil)
+
+			Convey("Then the requester should decode the error body", func() {
+				_, err := responses.Recv(ctx)
+				So(err, ShouldHaveSameTypeAs, &Error{})
+
+				var body outOfStock
+
+				So(err.(*Error).Code, ShouldEqual, frame.ErrApplicationError)
+				So(err.(*Error).DecodeJSON(&body), ShouldBeNil)
+				So(body, ShouldResemble, outOfStock{"apple", 3})
+			})
+		})
+
+		Convey("When encode a value can't be marshaled", func() {
+			_, err := JSONError(frame.ErrApplicationError, make(chan int))
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRequestChannelFrameRoundTrip(t *testing.T) {
+	Convey("Given a REQUEST_CHANNEL frame built by the requester", t, func() {
+		payload := Text("bar").WithMetadata(Metadata("foo"))
+		buf, err := frame.Encode(payload.buildRequestChannelFrame(1, false, true, 8))
+		So(err, ShouldBeNil)
+
+		Convey("When decode the frame", func() {
+			f, err := frame.Decode(buf)
+			So(err, ShouldBeNil)
+
+			Convey("Then the initial payload should be the same as requested", func() {
+				request := f.(*frame.RequestChannelFrame)
+
+				So(request.InitialRequests, ShouldEqual, 8)
+				So(request.Complete(), ShouldBeTrue)
+				So(&Payload{request.HasMetadata(), request.Metadata, request.Data}, ShouldResemble, payload)
+			})
+		})
+	})
+}
+
+func TestPayloadStreamContext(t *testing.T) {
+	Convey("Given a stream requested", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		responses, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		streamCtx := responses.Context()
+
+		Convey("Then the context should carry the stream ID", func() {
+			streamID, ok := StreamIDFromContext(streamCtx)
+
+			So(ok, ShouldBeTrue)
+			So(streamID, ShouldEqual, StreamID(1))
+			So(responses.Context(), ShouldEqual, streamCtx)
+		})
+
+		Convey("When the stream receives a payload", func() {
+			So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+			_, err := responses.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then the context should not be cancelled", func() {
+				So(streamCtx.Err(), ShouldBeNil)
+			})
+
+			Convey("When the stream completes", func() {
+				So(requester.HandleFrame(ctx, buildCompleteFrame(1)), ShouldBeNil)
+
+				payload, err := responses.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+
+				Convey("Then the context should be cancelled", func() {
+					So(streamCtx.Err(), ShouldEqual, context.Canceled)
+				})
+			})
+		})
+
+		Convey("When the stream fails", func() {
+			So(requester.HandleFrame(ctx, buildErrorFrame(1, errors.New("boom"))), ShouldBeNil)
+
+			_, err := responses.Recv(ctx)
+			So(err, ShouldNotBeNil)
+
+			Convey("Then the context should be cancelled", func() {
+				So(streamCtx.Err(), ShouldEqual, context.Canceled)
+			})
+		})
+	})
+
+	Convey("Given a stream not bound to a stream", t, func() {
+		stream, _ := NewPayloadPipe(1)
+		streamCtx := stream.Context()
+
+		Convey("When the stream cancelled", func() {
+			stream.Cancel()
+
+			Convey("Then the context should be cancelled without the stream ID", func() {
+				So(streamCtx.Err(), ShouldEqual, context.Canceled)
+
+				_, ok := StreamIDFromContext(streamCtx)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -0,0 +1,38 @@
+package proto
+
+import (
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+var resultPool = sync.Pool{
+	New: func() interface{} {
+		return new(Result)
+	},
+}
+
+// newResult returns a Result from the pool, which is released after the consumer received it.
+func newResult(payload *Payload, err error) *Result {
+	result := resultPool.Get().(*Result)
+
+	result.Payload = payload
+	result.Err = err
+	result.pooled = true
+
+	return result
+}
+
+func (result *Result) release() {
+	if result.source != nil {
+		frame.Release(result.source)
+
+		result.source = nil
+	}
+
+	if result.pooled {
+		*result = Result{}
+
+		resultPool.Put(result)
+	}
+}
@@ -0,0 +1,108 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func benchmarkPayloadStream(b *testing.B, build func(payload *Payload) *Result) {
+	ctx := context.Background()
+	c := make(chan *Result, 64)
+	stream := &PayloadStream{C: c}
+	payload := Text("hello")
+
+	b.ReportAllocs()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			c <- build(payload)
+		}
+
+		close(c)
+	}()
+
+	stream.ForEach(ctx, func(payload *Payload) error {
+		return nil
+	})
+}
+
+func BenchmarkPayloadStream(b *testing.B) {
+	b.Run("alloc", func(b *testing.B) {
+		benchmarkPayloadStream(b, Ok)
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		benchmarkPayloadStream(b, func(payload *Payload) *Result {
+			return newResult(payload, nil)
+		})
+	})
+}
+
+func TestPooledResultsOfConcurrentStreams(t *testing.T) {
+	Convey("Given a requester receives long streams concurrently", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const streams = 8
+		const items = 200
+
+		requests := NewFrameChan(streams * items)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		var wg sync.WaitGroup
+		received := make(chan []string, streams)
+
+		for i := 0; i < streams; i++ {
+			responses, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			streamID := requester.streamIDs.Current()
+
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				for n := 0; n < items; n++ {
+					requester.HandleFrame(ctx, Text(fmt.Sprintf("%d-%d", streamID, n)).buildPayloadFrame(streamID, n == items-1))
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				var payloads []string
+
+				responses.ForEach(ctx, func(payload *Payload) error {
+					payloads = append(payloads, fmt.Sprintf("%d:%s", streamID, payload.Text()))
+
+					return nil
+				})
+
+				received <- payloads
+			}()
+		}
+
+		wg.Wait()
+		close(received)
+
+		Convey("Then each stream should receive its own payloads in order", func() {
+			for payloads := range received {
+				So(payloads, ShouldHaveLength, items)
+
+				for n, payload := range payloads {
+					var streamID frame.StreamID
+
+					fmt.Sscanf(payload, "%d:", &streamID)
+					So(payload, ShouldEqual, fmt.Sprintf("%d:%d-%d", streamID, streamID, n))
+				}
+			}
+		})
+	})
+}
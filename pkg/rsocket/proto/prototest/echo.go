@@ -0,0 +1,232 @@
+package prototest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+	"go.uber.org/zap"
+)
+
+// ErrNotSupported is returned for the requests the EchoServer doesn't handle.
+var ErrNotSupported = errors.New("not supported")
+
+// maxRequests is the requests granted for the channels, the server never applies backpressure.
+const maxRequests = math.MaxInt32
+
+// Behavior produces the payloads responded to a stream request.
+type Behavior func(request *proto.Payload) *proto.PayloadStream
+
+// Echo responds the request payload, then completes the stream.
+func Echo() Behavior {
+	return func(request *proto.Payload) *proto.PayloadStream {
+		return results(proto.Ok(request))
+	}
+}
+
+// Count responds n payloads with the sequence numbers from 0, then completes the stream.
+func Count(n int) Behavior {
+	return func(request *proto.Payload) *proto.PayloadStream {
+		return results(count(n)...)
+	}
+}
+
+// ErrorAfter responds n payloads like Count, then fails the stream with the error.
+func ErrorAfter(n int, err error) Behavior {
+	return func(request *proto.Payload) *proto.PayloadStream {
+		return results(append(count(n), proto.Err(err))...)
+	}
+}
+
+func count(n int) (results []*proto.Result) {
+	for i := 0; i < n; i++ {
+		results = append(results, proto.Ok(proto.Text(strconv.Itoa(i))))
+	}
+
+	return
+}
+
+func results(results ...*proto.Result) *proto.PayloadStream {
+	stream, sink := proto.NewPayloadPipe(len(results))
+
+	for _, result := range results {
+		sink.Send(context.Background(), result)
+	}
+
+	sink.Close()
+
+	return stream
+}
+
+// EchoServer is a server for the tests, which echoes the request-response and channel payloads,
+// and responds the stream requests with the configured behavior.
+//
+// The SETUP is accepted silently, and the fragmented requests are not supported.
+type EchoServer struct {
+	*zap.Logger
+	stream Behavior
+}
+
+var _ proto.Responder = (*EchoServer)(nil)
+
+// Option configures an EchoServer.
+type Option func(*EchoServer)
+
+// WithLogger configures the logger of server.
+func WithLogger(logger *zap.Logger) Option {
+	return func(server *EchoServer) {
+		server.Logger = logger
+	}
+}
+
+// WithStreamBehavior configures the behavior of stream requests, which echoes the request by default.
+func WithStreamBehavior(behavior Behavior) Option {
+	return func(server *EchoServer) {
+		server.stream = behavior
+	}
+}
+
+// NewEchoServer creates an EchoServer with the options.
+func NewEchoServer(opts ...Option) *EchoServer {
+	server := &EchoServer{zap.NewNop(), Echo()}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	return server
+}
+
+// ServeTransport serves the connections accepted from the transport until ctx cancelled.
+func (server *EchoServer) ServeTransport(ctx context.Context, transport *Transport) error {
+	for {
+		conn, err := transport.Accept(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		go server.Serve(ctx, conn)
+	}
+}
+
+// Serve handles the frames received on the connection until it closed or ctx cancelled.
+func (server *EchoServer) Serve(ctx context.Context, conn proto.Conn) error {
+	defer conn.Close()
+
+	responder := proto.NewResponder(server.Logger, conn, server)
+	defer responder.(io.Closer).Close()
+
+	channels := make(map[proto.StreamID]bool)
+
+	for {
+		f, err := conn.Recv(ctx)
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		streamID := f.StreamID()
+
+		switch f := f.(type) {
+		case *frame.SetupFrame, *frame.RequestFireAndForgetFrame:
+			// no response
+
+		case *frame.KeepaliveFrame:
+			if f.NeedRespond() {
+				err = conn.Send(ctx, frame.NewKeepaliveFrame(false, 0, f.Data))
+			}
+
+		case *frame.RequestResponseFrame:
+			err = conn.Send(ctx, frame.NewPayloadFrame(streamID, false, true, true, f.HasMetadata(), f.Metadata, f.Data))
+
+		case *frame.RequestChannelFrame:
+			if err = conn.Send(ctx, frame.NewRequestNFrame(streamID, maxRequests)); err != nil {
+				break
+			}
+
+			if len(f.Data) > 0 || f.HasMetadata() {
+				if err = conn.Send(ctx, frame.NewPayloadFrame(streamID, false, false, true, f.HasMetadata(), f.Metadata, f.Data)); err != nil {
+					break
+				}
+			}
+
+			if f.Complete() {
+				err = conn.Send(ctx, frame.NewPayloadFrame(streamID, false, true, false, false, nil, nil))
+			} else {
+				channels[streamID] = true
+			}
+
+		case *frame.PayloadFrame:
+			if !channels[streamID] {
+				err = responder.HandleFrame(ctx, f)
+
+				break
+			}
+
+			if f.Next() {
+				if err = conn.Send(ctx, frame.NewPayloadFrame(streamID, false, false, true, f.HasMetadata(), f.Metadata, f.Data)); err != nil {
+					break
+				}
+			}
+
+			if f.Complete() {
+				delete(channels, streamID)
+
+				err = conn.Send(ctx, frame.NewPayloadFrame(streamID, false, true, false, false, nil, nil))
+			}
+
+		case *frame.CancelFrame, *frame.ErrorFrame:
+			if channels[streamID] {
+				delete(channels, streamID)
+			} else {
+				err = responder.HandleFrame(ctx, f)
+			}
+
+		default:
+			err = responder.HandleFrame(ctx, f)
+		}
+
+		if err != nil {
+			server.Warn("handle frame failed", zap.Stringer("type", f.Type()), zap.Error(err))
+
+			return err
+		}
+	}
+}
+
+// Close the server.
+func (server *EchoServer) Close() error {
+	return nil
+}
+
+// HandleRequestResponse is never called, the request-response is echoed by the server.
+func (server *EchoServer) HandleRequestResponse(ctx context.Context, streamID proto.StreamID, payload *proto.Payload) (*proto.Payload, error) {
+	return nil, ErrNotSupported
+}
+
+// HandleRequestStream responds the stream request with the configured behavior.
+func (server *EchoServer) HandleRequestStream(ctx context.Context, streamID proto.StreamID, payload *proto.Payload) (*proto.PayloadStream, error) {
+	return server.stream(payload), nil
+}
+
+// HandleRequestChannel is never called, the channel is echoed by the server.
+func (server *EchoServer) HandleRequestChannel(ctx context.Context, streamID proto.StreamID, payloads *proto.PayloadStream) (*proto.PayloadStream, error) {
+	return nil, ErrNotSupported
+}
+
+// HandleFireAndForget drops the payload.
+func (server *EchoServer) HandleFireAndForget(streamID proto.StreamID, payload *proto.Payload) error {
+	return nil
+}
+
+// HandleMetadataPush drops the metadata.
+func (server *EchoServer) HandleMetadataPush(metadata proto.Metadata) error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package prototest
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+)
+
+// pipeConn is an end of the in-memory connection.
+type pipeConn struct {
+	send   *proto.FrameChan
+	recv   *proto.FrameChan
+	closed chan struct{}
+	once   *sync.Once
+}
+
+var _ proto.Conn = (*pipeConn)(nil)
+
+// NewPipe creates an in-memory connection, the frames sent on one end are received on the other end.
+func NewPipe() (client proto.Conn, server proto.Conn) {
+	requests := proto.NewFrameChan(16)
+	responses := proto.NewFrameChan(16)
+	closed := make(chan struct{})
+	once := new(sync.Once)
+
+	return &pipeConn{requests, responses, closed, once}, &pipeConn{responses, requests, closed, once}
+}
+
+// Close both ends of the connection.
+func (conn *pipeConn) Close() error {
+	conn.once.Do(func() {
+		close(conn.closed)
+	})
+
+	return nil
+}
+
+func (conn *pipeConn) Send(ctx context.Context, f frame.Frame) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-conn.closed:
+		return io.ErrClosedPipe
+	case conn.send.C <- f:
+		return nil
+	}
+}
+
+func (conn *pipeConn) Recv(ctx context.Context) (frame.Frame, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-conn.closed:
+		return nil, io.EOF
+	case f := <-conn.recv.C:
+		return f, nil
+	}
+}
+
+// Transport connects to the server end of in-memory connections.
+type Transport struct {
+	conns chan proto.Conn
+}
+
+// NewTransport creates a Transport, the server end of connections is accepted with Accept.
+func NewTransport() *Transport {
+	return &Transport{make(chan proto.Conn)}
+}
+
+// Connect creates an in-memory connection, and waits the server end accepted.
+func (transport *Transport) Connect(ctx context.Context) (proto.Conn, error) {
+	client, server := NewPipe()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case transport.conns <- server:
+		return client, nil
+	}
+}
+
+// Accept returns the server end of a connection once the client connected.
+func (transport *Transport) Accept(ctx context.Context) (proto.Conn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case conn := <-transport.conns:
+		return conn, nil
+	}
+}
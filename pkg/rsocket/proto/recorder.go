@@ -0,0 +1,327 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"go.uber.org/zap"
+)
+
+// Record holds a request and its responses recorded by the Requester.
+type Record struct {
+	Type      frame.Type `json:"type"`
+	Request   *Payload   `json:"request,omitempty"`
+	Responses []*Result  `json:"responses,omitempty"` // A Result without Payload and error completes the stream.
+}
+
+// MarshalJSON encodes the Result as a JSON object.
+func (result *Result) MarshalJSON() ([]byte, error) {
+	var err *Error
+
+	if result.Err != nil {
+		err = toError(result.Err)
+	}
+
+	return json.Marshal(&recordedResult{result.Payload, err})
+}
+
+// UnmarshalJSON decodes the Result from a JSON object.
+func (result *Result) UnmarshalJSON(data []byte) error {
+	var recorded recordedResult
+
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return err
+	}
+
+	result.Payload = recorded.Payload
+	result.Err = nil
+
+	if recorded.Err != nil {
+		result.Err = recorded.Err
+	}
+
+	return nil
+}
+
+type recordedResult struct {
+	Payload *Payload `json:"payload,omitempty"`
+	Err     *Error   `json:"error,omitempty"`
+}
+
+// Step returns a ScriptStep expects the recorded request and replies the recorded responses.
+func (record *Record) Step() *ScriptStep {
+	step := Expect(MatchType(record.Type))
+
+	if record.Request != nil && record.Type != frame.TypeMetadataPush {
+		step.Matchers = append(step.Matchers, MatchPayload(record.Request))
+	}
+
+	step.Responses = record.Responses
+
+	return step
+}
+
+// MatchPayload matches the request frame with the metadata and data of payload.
+func MatchPayload(payload *Payload) FrameMatcher {
+	return func(f frame.Frame) bool {
+		request := framePayload(f)
+
+		return request != nil &&
+			request.HasMetadata == payload.HasMetadata &&
+			bytes.Equal(request.Metadata, payload.Metadata) &&
+			bytes.Equal(request.Data, payload.Data)
+	}
+}
+
+// RecordSink stores the recorded requests.
+type RecordSink interface {
+	Record(record *Record) error
+}
+
+// JSONRecordSink writes the records as JSON, one record per line.
+type JSONRecordSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+var _ RecordSink = (*JSONRecordSink)(nil)
+
+// NewJSONRecordSink creates a JSONRecordSink writes to w.
+func NewJSONRecordSink(w io.Writer) *JSONRecordSink {
+	return &JSONRecordSink{encoder: json.NewEncoder(w)}
+}
+
+// Record writes the record as a JSON line.
+func (sink *JSONRecordSink) Record(record *Record) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	return sink.encoder.Encode(record)
+}
+
+// LoadRecords reads the records written by JSONRecordSink.
+func LoadRecords(r io.Reader) (records []*Record, err error) {
+	decoder := json.NewDecoder(r)
+
+	for {
+		var record Record
+
+		if err = decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		records = append(records, &record)
+	}
+}
+
+// LoadScript reads the records written by JSONRecordSink as the steps of a ScriptedResponder.
+func LoadScript(r io.Reader) ([]*ScriptStep, error) {
+	records, err := LoadRecords(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]*ScriptStep, len(records))
+
+	for i, record := range records {
+		steps[i] = record.Step()
+	}
+
+	return steps, nil
+}
+
+// recordingRequester logs the requests and their responses to a RecordSink.
+type recordingRequester struct {
+	Requester
+	*zap.Logger
+	sink RecordSink
+}
+
+var (
+	_ Requester          = (*recordingRequester)(nil)
+	_ MetadataPushSyncer = (*recordingRequester)(nil)
+	_ MetadataMimeTyper  = (*recordingRequester)(nil)
+)
+
+// NewRecordingRequester wraps the Requester to log each request and its eventual responses,
+// the record is written to sink, if any, once the request completes.
+func NewRecordingRequester(logger *zap.Logger, requester Requester, sink RecordSink) Requester {
+	return &recordingRequester{requester, logger.Named("recorder"), sink}
+}
+
+func (recorder *recordingRequester) record(record *Record) {
+	recorder.Debug("record request",
+		zap.Stringer("type", record.Type),
+		zap.Int("responses", len(record.Responses)))
+
+	if recorder.sink == nil {
+		return
+	}
+
+	if err := recorder.sink.Record(record); err != nil {
+		recorder.Warn("fail to write record", zap.Stringer("type", record.Type), zap.Error(err))
+	}
+}
+
+func (recorder *recordingRequester) NewRequest() *RequestBuilder {
+	return NewRequest(recorder)
+}
+
+func (recorder *recordingRequester) RequestResponse(ctx context.Context, payload *Payload) (*Payload, error) {
+	response, err := recorder.Requester.RequestResponse(ctx, payload)
+
+	record := &Record{Type: frame.TypeRequestResponse, Request: payload}
+
+	switch {
+	case err != nil:
+		record.Responses = append(record.Responses, Err(err))
+	case response != nil:
+		record.Responses = append(record.Responses, Ok(response), &Result{})
+	default:
+		record.Responses = append(record.Responses, &Result{})
+	}
+
+	recorder.record(record)
+
+	return response, err
+}
+
+func (recorder *recordingRequester) FireAndForget(ctx context.Context, payload *Payload) error {
+	err := recorder.Requester.FireAndForget(ctx, payload)
+
+	if err == nil {
+		recorder.record(&Record{Type: frame.TypeRequestFireAndForget, Request: payload})
+	}
+
+	return err
+}
+
+func (recorder *recordingRequester) MetadataPush(ctx context.Context, metadata Metadata) error {
+	err := recorder.Requester.MetadataPush(ctx, metadata)
+
+	if err == nil {
+		recorder.record(&Record{Type: frame.TypeMetadataPush, Request: &Payload{true, metadata, nil}})
+	}
+
+	return err
+}
+
+// MetadataMimeType returns the metadata MIME type of the requester recorded, or empty if unknown.
+func (recorder *recordingRequester) MetadataMimeType() string {
+	if typer, ok := recorder.Requester.(MetadataMimeTyper); ok {
+		return typer.MetadataMimeType()
+	}
+
+	return ""
+}
+
+// MetadataPushSync waits the frame flushed if the requester recorded supports, or just sends it otherwise.
+func (recorder *recordingRequester) MetadataPushSync(ctx context.Context, metadata Metadata) error {
+	var err error
+
+	if syncer, ok := recorder.Requester.(MetadataPushSyncer); ok {
+		err = syncer.MetadataPushSync(ctx, metadata)
+	} else {
+		err = recorder.Requester.MetadataPush(ctx, metadata)
+	}
+
+	if err == nil {
+		recorder.record(&Record{Type: frame.TypeMetadataPush, Request: &Payload{true, metadata, nil}})
+	}
+
+	return err
+}
+
+func (recorder *recordingRequester) RequestStream(ctx context.Context, payload *Payload) (*PayloadStream, error) {
+	responses, err := recorder.Requester.RequestStream(ctx, payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{Type: frame.TypeRequestStream, Request: payload}
+
+	return teeStream(ctx, responses, func(result *Result) {
+		record.Responses = append(record.Responses, result)
+
+		if result.Payload == nil {
+			recorder.record(record)
+		}
+	}), nil
+}
+
+func (recorder *recordingRequester) RequestChannel(ctx context.Context, payloads *PayloadStream) (*PayloadStream, error) {
+	var lock sync.Mutex
+
+	record := &Record{Type: frame.TypeRequestChannel}
+
+	requests := teeStream(ctx, payloads, func(result *Result) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if record.Request == nil && result.Payload != nil {
+			record.Request = result.Payload
+		}
+	})
+
+	responses, err := recorder.Requester.RequestChannel(ctx, requests)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return teeStream(ctx, responses, func(result *Result) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		record.Responses = append(record.Responses, result)
+
+		if result.Payload == nil {
+			recorder.record(record)
+		}
+	}), nil
+}
+
+// teeStream forwards the payloads of stream to the returned stream,
+// and calls the function with each result, the last one has no Payload.
+func teeStream(ctx context.Context, stream *PayloadStream, fn func(result *Result)) *PayloadStream {
+	results := make(chan *Result, cap(stream.C))
+
+	go func() {
+		defer close(results)
+
+		for {
+			payload, err := stream.Recv(ctx)
+
+			if payload == nil {
+				fn(ErrResult(err))
+
+				if err != nil {
+					select {
+					case <-ctx.Done():
+					case results <- Err(err):
+					}
+				}
+
+				return
+			}
+
+			fn(Ok(payload))
+
+			select {
+			case <-ctx.Done():
+				return
+			case results <- Ok(payload):
+			}
+		}
+	}()
+
+	return &PayloadStream{C: results}
+}
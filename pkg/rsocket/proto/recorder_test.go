@@ -0,0 +1,63 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD with COMPLETE
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: ERROR[APPLICATION_ERROR]
+func TestRecordingRequester(t *testing.T) {
+	Convey("Given a recording requester", t, func() {
+		var buf bytes.Buffer
+
+		steps := []*ScriptStep{
+			Expect(MatchType(frame.TypeRequestResponse)).Respond(Text("world")).Complete(),
+			Expect(MatchType(frame.TypeRequestResponse)).Fail(frame.ErrApplicationError.WithMessage("for test")),
+		}
+
+		runScripted(t, steps, func(ctx context.Context, requester *rSocketRequester) {
+			recorder := NewRecordingRequester(logger, requester, NewJSONRecordSink(&buf))
+
+			payload, err := recorder.RequestResponse(ctx, Text("hello").WithMetadata([]byte("foo")))
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, Text("world"))
+
+			payload, err = recorder.RequestResponse(ctx, Text("bye"))
+			So(payload, ShouldBeNil)
+			So(err, ShouldResemble, frame.ErrApplicationError.WithMessage("for test"))
+		})
+
+		Convey("When load the recorded session", func() {
+			records, err := LoadRecords(bytes.NewReader(buf.Bytes()))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 2)
+			So(records[0].Type, ShouldEqual, frame.TypeRequestResponse)
+			So(records[0].Request, ShouldResemble, Text("hello").WithMetadata([]byte("foo")))
+			So(records[0].Responses, ShouldResemble, []*Result{Ok(Text("world")), {}})
+			So(records[1].Responses, ShouldResemble, []*Result{Err(frame.ErrApplicationError.WithMessage("for test"))})
+
+			Convey("Then the session should be replayed by the scripted responder", func() {
+				steps, err := LoadScript(bytes.NewReader(buf.Bytes()))
+				So(err, ShouldBeNil)
+
+				runScripted(t, steps, func(ctx context.Context, requester *rSocketRequester) {
+					payload, err := requester.RequestResponse(ctx, Text("hello").WithMetadata([]byte("foo")))
+					So(err, ShouldBeNil)
+					So(payload, ShouldResemble, Text("world"))
+
+					payload, err = requester.RequestResponse(ctx, Text("bye"))
+					So(payload, ShouldBeNil)
+					So(err, ShouldResemble, frame.ErrApplicationError.WithMessage("for test"))
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,38 @@
+package proto
+
+import (
+	"encoding/binary"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// ErrorMimeType is the MIME type of the composite metadata entry holds the code of an error relayed as a payload.
+const ErrorMimeType = "message/x.rsocket.error.v0"
+
+// ErrorToPayload encodes the error as a payload, so an intermediary can relay it across the connections,
+// the error code is carried in the composite metadata, and the message as the data.
+func ErrorToPayload(err *Error) *Payload {
+	var code [frame.ErrorCodeSize]byte
+
+	binary.BigEndian.PutUint32(code[:], uint32(err.Code))
+
+	// The entry is always valid with a short MIME type and a fixed size content.
+	metadata, _ := Metadata(nil).AppendEntry(ErrorMimeType, code[:])
+
+	return Bytes([]byte(err.Data)).WithMetadata(metadata)
+}
+
+// ErrorFromPayload decodes the error relayed as the payload, or returns false if the payload is not an error.
+func ErrorFromPayload(payload *Payload) (*Error, bool) {
+	if payload == nil || !payload.HasMetadata {
+		return nil, false
+	}
+
+	code, ok := payload.Metadata.StringEntry(ErrorMimeType)
+
+	if !ok || len(code) != frame.ErrorCodeSize {
+		return nil, false
+	}
+
+	return &Error{Code: frame.ErrorCode(binary.BigEndian.Uint32(code)), Data: string(payload.Data)}, true
+}
@@ -2,9 +2,14 @@ package proto
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
 	"github.com/prometheus/client_golang/prometheus"
@@ -51,6 +56,21 @@ func init() {
 	prometheus.MustRegister(currentChannels)
 }
 
+// DefaultInitialRequests is the initial requests of a response stream if not specified.
+const DefaultInitialRequests = 128
+
+// ErrMetadataNotNegotiated is returned when send metadata on a connection without metadata MIME type.
+var ErrMetadataNotNegotiated = errors.New("metadata MIME type not negotiated")
+
+// ErrCreditExceeded is returned when the responder sends more payloads than requested.
+var ErrCreditExceeded = frame.ErrConnectionError.WithMessage("payloads exceed the requested credit")
+
+// ErrFireAndForgetResponded is returned when the responder sends a frame on a FIRE_AND_FORGET stream.
+var ErrFireAndForgetResponded = frame.ErrConnectionError.WithMessage("unexpected frame on fire-and-forget stream")
+
+// maxRecentFireAndForget is the number of FIRE_AND_FORGET streams remembered to recognize the unexpected frames.
+const maxRecentFireAndForget = 1024
+
 // Requester to submit requests on an RSocket connection.
 type Requester interface {
 	io.Closer
@@ -62,6 +82,9 @@ type Requester interface {
 	RequestChannel(ctx context.Context, payloads *PayloadStream) (*PayloadStream, error)
 
 	// Send a single request and get a single response.
+	//
+	// An empty payload is returned if the responder responds with empty data,
+	// or nil without error if the responder completes without payload.
 	RequestResponse(ctx context.Context, payload *Payload) (*Payload, error)
 
 	// Send a single Payload with no response.
@@ -71,37 +94,375 @@ type Requester interface {
 	MetadataPush(ctx context.Context, metadata Metadata) error
 }
 
+// MetadataPushSyncer is implemented by the Requester which waits the METADATA_PUSH frame flushed.
+type MetadataPushSyncer interface {
+	// Send metadata without response, and wait the frame flushed to the transport.
+	MetadataPushSync(ctx context.Context, metadata Metadata) error
+}
+
+// MetadataMimeTyper is implemented by the Requester which knows the metadata MIME type of the connection.
+type MetadataMimeTyper interface {
+	// MetadataMimeType returns the metadata MIME type negotiated with the SETUP frame, or empty if unknown.
+	MetadataMimeType() string
+}
+
+// StreamLister is implemented by the Requester which tracks the streams in progress.
+type StreamLister interface {
+	// ActiveStreams returns a snapshot of the streams in progress for debugging.
+	ActiveStreams() []StreamInfo
+}
+
+// StreamInfo describes a stream in progress.
+type StreamInfo struct {
+	StreamID StreamID
+	Type     frame.Type    // The type of request started the stream.
+	Age      time.Duration // The time elapsed since the stream started.
+	Credits  int64         // The payloads requested but not received yet.
+	Received int64         // The payloads received.
+}
+
+// Aborter fails the streams in progress.
+type Aborter interface {
+	// Abort fails the streams in progress with the error, as if they were terminated by the responder.
+	Abort(ctx context.Context, err error)
+}
+
 // Requester Side of a RSocket. Sends [Frame]s to a [RSocketResponder]
 type rSocketRequester struct {
 	*zap.Logger
 	frameSender        FrameSender
 	streamIDs          StreamIDs
 	streamRequestLimit uint
+	defaultTimeout     time.Duration
+	flowControl        FlowControlStrategy
+	lowWatermark       uint32 // The outstanding requests to replenish a stream with the default flow control.
+	fragmentSize       uint
+	reassembler        *Reassembler
+	interceptors       []PayloadInterceptor
+	strictMetadata     bool
+	metadataMimeType   string
+	strictFlowControl  bool
+	strictFireForget   bool
+	fireAndForgets     *recentStreams // The latest FIRE_AND_FORGET streams, which never expect a frame.
+	byteBudget         int64          // The maximum bytes of payloads buffered for a stream, or 0 if unlimited.
+	echoKeepalive      bool           // Responds the KEEPALIVE frames requested a response without the keepalive driver.
+	lease              *Lease
+	errorMapper        ErrorMapper
+	observer           streamObserver
+	tap                chan TappedFrame
+	inflight           chan struct{} // The semaphore of in-flight requests, or nil if unlimited.
 	senders            *sync.Map
 	receivers          *sync.Map
+	earlyLock          sync.Mutex
+	earlyRequests      map[StreamID]uint32 // The requests received before the sender of stream registered.
+	closed             chan struct{}
+	closeOnce          sync.Once
 }
 
 var (
 	_ Requester    = (*rSocketRequester)(nil)
 	_ FrameHandler = (*rSocketRequester)(nil)
+	_ Aborter      = (*rSocketRequester)(nil)
+	_ QueueFlusher = (*rSocketRequester)(nil)
+
+	_ MetadataPushSyncer = (*rSocketRequester)(nil)
+	_ StreamLister       = (*rSocketRequester)(nil)
+	_ MetadataMimeTyper  = (*rSocketRequester)(nil)
 )
 
+// RequesterOption configures a Requester.
+type RequesterOption func(*rSocketRequester)
+
+// WithLogger configures the logger of requester.
+func WithLogger(logger *zap.Logger) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.Logger = logger
+	}
+}
+
+// WithStreamIDs configures the stream ID generator, the client stream IDs are used if not specified.
+func WithStreamIDs(streamIDs StreamIDs) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.streamIDs = streamIDs
+	}
+}
+
+// WithInitialRequests configures the initial requests of the response streams.
+func WithInitialRequests(n uint) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.streamRequestLimit = n
+	}
+}
+
+// WithDefaultTimeout configures the time limit of the requests without deadline.
+func WithDefaultTimeout(timeout time.Duration) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.defaultTimeout = timeout
+	}
+}
+
+// WithFlowControl configures the flow control strategy of the response streams.
+func WithFlowControl(strategy FlowControlStrategy) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.flowControl = strategy
+	}
+}
+
+// WithLowWatermark replenishes the payloads consumed of a stream once the outstanding requests drop to n,
+// e.g. a quarter of the initial requests, it only applies to the default flow control.
+func WithLowWatermark(n uint32) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.lowWatermark = n
+	}
+}
+
+// WithFragment configures the fragmentation of the outbound payloads.
+func WithFragment(fragment *FragmentOption) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.fragmentSize = fragment.FragmentSize()
+	}
+}
+
+// WithFragmentSize splits the outbound payloads into frames no larger than n bytes, or never splits if n is 0.
+func WithFragmentSize(n uint) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.fragmentSize = n
+	}
+}
+
+// PayloadInterceptor intercepts the outbound payload of a request,
+// it should return a new Payload instead of modifying the payload in place.
+type PayloadInterceptor func(ctx context.Context, payload *Payload) (*Payload, error)
+
+// WithInterceptors appends the interceptors of the outbound payloads, which run in the registration order.
+func WithInterceptors(interceptors ...PayloadInterceptor) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.interceptors = append(requester.interceptors, interceptors...)
+	}
+}
+
+// WithMetadataMimeType configures the metadata MIME type of the connection, which decides the encoding of the routing metadata.
+func WithMetadataMimeType(metadataMimeType string) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.metadataMimeType = metadataMimeType
+	}
+}
+
+// WithStrictMetadata rejects to send the payloads with metadata if the connection has no metadata MIME type.
+func WithStrictMetadata(metadataMimeType string) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.strictMetadata = true
+		requester.metadataMimeType = metadataMimeType
+	}
+}
+
+// WithLease requires a request to be admitted by the lease granted with the LEASE frames.
+func WithLease(lease *Lease) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.lease = lease
+	}
+}
+
+// ErrorMapper translates the error received with the ERROR frame to an application error.
+type ErrorMapper func(err *Error) error
+
+// WithErrorMapper translates the errors received before they delivered to the consumer.
+func WithErrorMapper(mapper ErrorMapper) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.errorMapper = mapper
+	}
+}
+
+// WithMaxConcurrentRequests limits the number of in-flight requests,
+// the new requests block until a request completes once the limit reached.
+func WithMaxConcurrentRequests(n uint) RequesterOption {
+	return func(requester *rSocketRequester) {
+		if n > 0 {
+			requester.inflight = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithStrictFlowControl raises CONNECTION_ERROR if the responder sends more payloads than requested.
+func WithStrictFlowControl() RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.strictFlowControl = true
+	}
+}
+
+// WithStrictFireAndForget raises CONNECTION_ERROR if the responder sends a frame on a FIRE_AND_FORGET stream,
+// which is ignored by default.
+func WithStrictFireAndForget() RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.strictFireForget = true
+	}
+}
+
+// WithStreamByteBudget bounds the bytes of payloads buffered for a stream but not consumed,
+// the requester stops granting more requests until the consumer drains the payloads below the budget.
+func WithStreamByteBudget(n int64) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.byteBudget = n
+	}
+}
+
+// WithKeepaliveEcho responds the KEEPALIVE frames requested a response,
+// so a connection without the keepalive driver still satisfies the keepalive checks of peer.
+func WithKeepaliveEcho() RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.echoKeepalive = true
+	}
+}
+
 // NewRequester create a new Requester.
-func NewRequester(logger *zap.Logger, frameSender FrameSender, streamIDs StreamIDs, streamRequestLimit uint) Requester {
-	return &rSocketRequester{
-		Logger:             logger,
+func NewRequester(logger *zap.Logger, frameSender FrameSender, streamIDs StreamIDs, streamRequestLimit uint, opts ...RequesterOption) Requester {
+	opts = append([]RequesterOption{
+		WithLogger(logger),
+		WithStreamIDs(streamIDs),
+		WithInitialRequests(streamRequestLimit),
+	}, opts...)
+
+	return NewRequesterWithOptions(frameSender, opts...)
+}
+
+// NewRequesterWithOptions create a new Requester with the options.
+//
+// The requester logs nothing, generates the client stream IDs, requests DefaultInitialRequests for a response stream,
+// and splits the payloads exceed DefaultFragmentSize, unless configured.
+func NewRequesterWithOptions(frameSender FrameSender, opts ...RequesterOption) Requester {
+	requester := &rSocketRequester{
+		Logger:             zap.NewNop(),
 		frameSender:        frameSender,
-		streamIDs:          streamIDs,
-		streamRequestLimit: streamRequestLimit,
+		streamIDs:          ClientStreamIDs(),
+		streamRequestLimit: DefaultInitialRequests,
+		fragmentSize:       DefaultFragmentSize,
+		reassembler:        NewReassembler(),
 		senders:            new(sync.Map),
 		receivers:          new(sync.Map),
+		fireAndForgets:     newRecentStreams(maxRecentFireAndForget),
+		earlyRequests:      make(map[StreamID]uint32),
+		closed:             make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(requester)
+	}
+
+	if requester.flowControl == nil {
+		requester.flowControl = &EagerStrategy{uint32(requester.streamRequestLimit), requester.lowWatermark}
 	}
+
+	return requester
 }
 
+// Close rejects the new requests, and cancels the streams in progress.
 func (requester *rSocketRequester) Close() (err error) {
+	requester.closeOnce.Do(func() {
+		close(requester.closed)
+	})
+
 	return nil
 }
 
+// Abort fails the streams in progress with the error, e.g. the session was lost and could not be resumed.
+func (requester *rSocketRequester) Abort(ctx context.Context, err error) {
+	requester.receivers.Range(func(key, value interface{}) bool {
+		streamID := key.(StreamID)
+
+		if _, loaded := requester.receivers.LoadAndDelete(streamID); !loaded {
+			return true
+		}
+
+		if sender, ok := requester.findSender(streamID); ok {
+			requester.senders.Delete(streamID)
+			sender.cancel()
+		}
+
+		receiver := value.(*resultReceiver)
+
+		if sendErr := receiver.Send(Err(err)); sendErr != nil {
+			requester.Warn("abort stream failed", zap.Uint32("stream", uint32(streamID)), zap.Error(sendErr))
+		}
+
+		receiver.Close()
+
+		requester.observer.terminated(streamID, err)
+
+		return true
+	})
+}
+
+func (requester *rSocketRequester) NewRequest() *RequestBuilder {
+	return NewRequest(requester)
+}
+
+// MetadataMimeType returns the metadata MIME type of the connection, or empty if not configured.
+func (requester *rSocketRequester) MetadataMimeType() string {
+	return requester.metadataMimeType
+}
+
+// newFlow creates the flow control of a stream, which requests the initial requests from context if present.
+func (requester *rSocketRequester) newFlow(ctx context.Context) FlowControl {
+	if n, ok := initialRequestsFromContext(ctx); ok {
+		return (&EagerStrategy{n, 0}).NewFlow()
+	}
+
+	return requester.flowControl.NewFlow()
+}
+
+// streamContext derives the context of a request, which is cancelled once the requester closed.
+//
+// The request waits for an in-flight slot if the concurrent requests limited,
+// which is released once the context cancelled.
+//
+// The default timeout applies if the context has no deadline.
+func (requester *rSocketRequester) streamContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	select {
+	case <-requester.closed:
+		return nil, nil, ErrClosed
+	default:
+	}
+
+	if requester.inflight != nil {
+		select {
+		case <-requester.closed:
+			return nil, nil, ErrClosed
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case requester.inflight <- struct{}{}:
+		}
+	}
+
+	var cancel context.CancelFunc
+
+	if _, ok := ctx.Deadline(); !ok && requester.defaultTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, requester.defaultTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	if requester.inflight != nil {
+		var once sync.Once
+
+		cancelCtx := cancel
+		cancel = func() {
+			cancelCtx()
+
+			once.Do(func() { <-requester.inflight })
+		}
+	}
+
+	go func() {
+		select {
+		case <-requester.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel, nil
+}
+
 type resultSender struct {
 	c        *sync.Cond
 	requests uint32
@@ -109,17 +470,84 @@ type resultSender struct {
 	cancel   context.CancelFunc
 }
 
-func (requester *rSocketRequester) newResultSender(ctx context.Context, streamID StreamID, initReqs uint) *resultSender {
+// newResultSender creates a resultSender with the initial requests, which are capped by limit unless it is 0,
+// the requests granted later are accumulated without the cap.
+func newResultSender(ctx context.Context, initReqs uint32, limit uint32) *resultSender {
 	ctx, cancel := context.WithCancel(ctx)
-	sender := &resultSender{sync.NewCond(new(sync.Mutex)), uint32(initReqs), ctx, cancel}
 
+	if limit > 0 && initReqs > limit {
+		initReqs = limit
+	}
+
+	sender := &resultSender{sync.NewCond(new(sync.Mutex)), initReqs, ctx, cancel}
+
+	go func() {
+		<-ctx.Done()
+
+		sender.Close()
+	}()
+
+	return sender
+}
+
+// newResultSender registers the sender of stream, which applies the requests received before registered.
+func (requester *rSocketRequester) newResultSender(ctx context.Context, streamID StreamID, initReqs uint) *resultSender {
+	sender := newResultSender(ctx, uint32(initReqs), 0)
+
+	requester.earlyLock.Lock()
+	early := requester.earlyRequests[streamID]
+	delete(requester.earlyRequests, streamID)
 	requester.senders.Store(streamID, sender)
+	requester.earlyLock.Unlock()
+
+	if early > 0 {
+		sender.Requests(early)
+	}
 
 	return sender
 }
 
+// requestSender grants the requests to the sender of stream,
+// or retains them until the sender registered if the stream is still in progress.
+//
+// Returns false if the stream has been terminated or never existed.
+func (requester *rSocketRequester) requestSender(streamID StreamID, n uint32) bool {
+	requester.earlyLock.Lock()
+
+	sender, ok := requester.findSender(streamID)
+	_, inProgress := requester.findReceiver(streamID)
+
+	if !ok {
+		if inProgress {
+			if early := requester.earlyRequests[streamID]; early+n < early {
+				requester.earlyRequests[streamID] = math.MaxUint32
+			} else {
+				requester.earlyRequests[streamID] = early + n
+			}
+		}
+	}
+
+	requester.earlyLock.Unlock()
+
+	if ok {
+		sender.Requests(n)
+	}
+
+	return ok || inProgress
+}
+
+// dropEarlyRequests drops the requests retained for the stream terminated.
+func (requester *rSocketRequester) dropEarlyRequests(streamID StreamID) {
+	requester.earlyLock.Lock()
+	delete(requester.earlyRequests, streamID)
+	requester.earlyLock.Unlock()
+}
+
 func (sender *resultSender) Close() error {
+	sender.c.L.Lock()
 	sender.cancel()
+	sender.c.L.Unlock()
+	sender.c.Broadcast()
 
 	return nil
 }
@@ -130,18 +558,27 @@ func (sender *resultSender) Acquire(ctx context.Context) error {
 	}
 
 	sender.c.L.Lock()
+	defer sender.c.L.Unlock()
+
 	for sender.requests == 0 {
+		if err := sender.ctx.Err(); err != nil {
+			return err
+		}
+
 		sender.c.Wait()
 	}
 	sender.requests--
-	sender.c.L.Unlock()
 
 	return nil
 }
 
 func (sender *resultSender) Requests(n uint32) {
 	sender.c.L.Lock()
-	sender.requests += n
+	if sender.requests+n < sender.requests {
+		sender.requests = math.MaxUint32
+	} else {
+		sender.requests += n
+	}
 	sender.c.L.Unlock()
 	sender.c.Broadcast()
 }
@@ -149,79 +586,341 @@ func (sender *resultSender) Requests(n uint32) {
 type resultReceiver struct {
 	*PayloadStream
 	*PayloadSink
+	credits     int64 // The payloads requested but not received yet.
+	buffered    int64 // The bytes of payloads received but not consumed yet.
+	received    int64 // The payloads received.
+	requestType frame.Type
+	started     time.Time
+	limit       int64 // The payloads requested or buffered at most, so the buffer never blocks the read loop.
+	lock        sync.Mutex
+	deferred    uint32     // The requests withheld until the payloads buffered consumed.
+	closeLock   sync.Mutex // Serializes the results sent by the read loop with closing the receiver, e.g. by Abort.
+	closed      bool
 }
 
-func (requester *rSocketRequester) newResultReceiver(streamID StreamID, capacity uint) *resultReceiver {
-	c := make(chan *Result, capacity)
-	receiver := &resultReceiver{&PayloadStream{c}, &PayloadSink{c}}
+// maxBufferedResults bounds the payloads requested or buffered for a stream.
+const maxBufferedResults = 1024
+
+// newResultReceiver creates a resultReceiver with the payloads requested,
+// returns the requests granted up front, the rest are granted once the payloads buffered consumed.
+func (requester *rSocketRequester) newResultReceiver(streamID StreamID, requestType frame.Type, requests uint) (*resultReceiver, uint32) {
+	limit := int64(maxBufferedResults)
+
+	if requestType == frame.TypeRequestResponse {
+		limit = 1
+	}
+
+	// One more for the payload in flight while the credit granted, and one for the result terminates the stream.
+	c := make(chan *Result, limit+2)
+	receiver := &resultReceiver{&PayloadStream{C: c}, &PayloadSink{C: c}, 0, 0, 0, requestType, time.Now(), limit, sync.Mutex{}, 0, sync.Mutex{}, false}
+
+	if requests > math.MaxUint32 {
+		requests = math.MaxUint32
+	}
+
+	granted := receiver.grant(uint32(requests))
 
 	requester.receivers.Store(streamID, receiver)
 
-	return receiver
+	return receiver, granted
+}
+
+// Send the result to the stream, the result is dropped and released if the stream has been terminated.
+//
+// The buffer never blocks the read loop, returns ErrCreditExceeded if the payloads exceed the buffer,
+// the last room of buffer is reserved for the result terminates the stream.
+func (receiver *resultReceiver) Send(result *Result) error {
+	receiver.closeLock.Lock()
+	defer receiver.closeLock.Unlock()
+
+	if receiver.closed {
+		result.release()
+
+		return nil
+	}
+
+	if result.Payload != nil && len(receiver.PayloadSink.C) >= cap(receiver.PayloadSink.C)-1 {
+		result.release()
+
+		return ErrCreditExceeded
+	}
+
+	select {
+	case receiver.PayloadSink.C <- result:
+		return nil
+	default:
+		result.release()
+
+		return ErrCreditExceeded
+	}
+}
+
+// discard closes the stream and releases the results buffered, once the consumer gone.
+func (receiver *resultReceiver) discard() {
+	receiver.Close()
+
+	for result := range receiver.PayloadStream.C {
+		if result != nil {
+			result.release()
+		}
+	}
+}
+
+// Close the stream once, after the results sent.
+func (receiver *resultReceiver) Close() error {
+	receiver.closeLock.Lock()
+	defer receiver.closeLock.Unlock()
+
+	if receiver.closed {
+		return nil
+	}
+
+	receiver.closed = true
+
+	return receiver.PayloadSink.Close()
+}
+
+// grant returns the requests could be granted without exceeding the limit of buffer,
+// and withholds the rest until the payloads buffered consumed.
+func (receiver *resultReceiver) grant(n uint32) uint32 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	if receiver.deferred+n < receiver.deferred {
+		receiver.deferred = math.MaxUint32
+	} else {
+		receiver.deferred += n
+	}
+
+	room := receiver.limit - atomic.LoadInt64(&receiver.credits) - int64(len(receiver.PayloadStream.C))
+
+	if room <= 0 || receiver.deferred == 0 {
+		return 0
+	}
+
+	granted := receiver.deferred
+
+	if int64(granted) > room {
+		granted = uint32(room)
+	}
+
+	receiver.deferred -= granted
+
+	atomic.AddInt64(&receiver.credits, int64(granted))
+
+	return granted
+}
+
+// ActiveStreams returns a snapshot of the streams in progress in the order of stream ID.
+func (requester *rSocketRequester) ActiveStreams() (streams []StreamInfo) {
+	now := time.Now()
+
+	requester.receivers.Range(func(key, value interface{}) bool {
+		receiver := value.(*resultReceiver)
+
+		streams = append(streams, StreamInfo{
+			key.(StreamID),
+			receiver.requestType,
+			now.Sub(receiver.started),
+			atomic.LoadInt64(&receiver.credits),
+			atomic.LoadInt64(&receiver.received),
+		})
+
+		return true
+	})
+
+	sort.Slice(streams, func(i, j int) bool { return streams[i].StreamID < streams[j].StreamID })
+
+	return
+}
+
+// acquireLease uses one of the requests granted by lease before a request initiated.
+func (requester *rSocketRequester) acquireLease() error {
+	if requester.lease == nil {
+		return nil
+	}
+
+	return requester.lease.Acquire()
 }
 
 func (requester *rSocketRequester) RequestResponse(ctx context.Context, payload *Payload) (*Payload, error) {
+	ctx, cancel, err := requester.streamContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cancel()
+
+	if err := requester.acquireLease(); err != nil {
+		return nil, err
+	}
+
 	streamID := requester.streamIDs.Next()
-	receiver := requester.newResultReceiver(streamID, 1)
+	receiver, _ := requester.newResultReceiver(streamID, frame.TypeRequestResponse, 1)
 
-	request := payload.buildRequestResponseFrame(streamID)
-	if err := requester.sendFrame(ctx, request); err != nil {
+	request := func(fragment *Payload, follows bool) frame.Frame {
+		return fragment.buildRequestResponseFrame(streamID, follows)
+	}
+	if err := requester.sendFragments(ctx, streamID, payload, false, request); err != nil {
 		return nil, err
 	}
 
-	payload, err := receiver.Recv(ctx)
+	requester.observer.started(streamID, frame.TypeRequestResponse, payload)
 
-	if err == context.Canceled {
-		return nil, requester.sendFrame(ctx, frame.NewCancelFrame(streamID))
+	payload, err = receiver.Recv(ctx)
+
+	if err != nil && ctx.Err() != nil {
+		// The response may complete the stream while cancelling, only the one removes the receiver cleans up.
+		if _, loaded := requester.receivers.LoadAndDelete(streamID); loaded {
+			// The request context is done, the CANCEL frame is sent regardless.
+			requester.sendFrame(context.Background(), frame.NewCancelFrame(streamID))
+			requester.observer.terminated(streamID, ctx.Err())
+			receiver.discard()
+
+			return nil, ctx.Err()
+		}
+
+		if err == ctx.Err() {
+			// The stream is completed or aborted by the other one, e.g. the connection closed with an error,
+			// which delivers the result soon.
+			payload, err = receiver.Recv(context.Background())
+		}
+	}
+
+	if payload != nil && payload.Data == nil {
+		payload.Data = []byte{}
 	}
 
 	return payload, err
 }
 
 func (requester *rSocketRequester) FireAndForget(ctx context.Context, payload *Payload) error {
+	ctx, cancel, err := requester.streamContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer cancel()
+
+	if err := requester.acquireLease(); err != nil {
+		return err
+	}
+
 	streamID := requester.streamIDs.Next()
 
-	return requester.sendFrame(ctx, payload.buildRequestFireAndForgetFrame(streamID))
+	err = requester.sendFragments(ctx, streamID, payload, false, func(fragment *Payload, follows bool) frame.Frame {
+		return fragment.buildRequestFireAndForgetFrame(streamID, follows)
+	})
+
+	if err == nil {
+		requester.fireAndForgets.Add(streamID)
+
+		// No response for the request, the stream completes once sent.
+		requester.observer.started(streamID, frame.TypeRequestFireAndForget, payload)
+		requester.observer.terminated(streamID, nil)
+	}
+
+	return err
 }
 
 func (requester *rSocketRequester) MetadataPush(ctx context.Context, metadata Metadata) (err error) {
+	if err = requester.checkMetadata(true); err != nil {
+		return
+	}
+
 	return requester.sendFrame(ctx, frame.NewMetadataPushFrame(metadata))
 }
 
+// MetadataPushSync pushes the metadata, and returns after the queued frames flushed to the transport,
+// it is the same as MetadataPush if the frames are written to the transport once sent.
+func (requester *rSocketRequester) MetadataPushSync(ctx context.Context, metadata Metadata) error {
+	if err := requester.MetadataPush(ctx, metadata); err != nil {
+		return err
+	}
+
+	return requester.Flush(ctx)
+}
+
+// Flush waits the frames sent written and flushed to the transport,
+// it returns immediately if the frames are written to the transport once sent.
+func (requester *rSocketRequester) Flush(ctx context.Context) error {
+	switch flusher := requester.frameSender.(type) {
+	case QueueFlusher:
+		return flusher.Flush(ctx)
+	case Flusher:
+		return flusher.Flush()
+	default:
+		return nil
+	}
+}
+
 func (requester *rSocketRequester) RequestStream(ctx context.Context, payload *Payload) (*PayloadStream, error) {
+	ctx, cancel, err := requester.streamContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requester.acquireLease(); err != nil {
+		cancel()
+
+		return nil, err
+	}
+
 	streamID := requester.streamIDs.Next()
-	initReqs := requester.streamRequestLimit
-	receiver := requester.newResultReceiver(streamID, initReqs)
+	flow := requester.newFlow(ctx)
+	receiver, initReqs := requester.newResultReceiver(streamID, frame.TypeRequestStream, uint(flow.InitialRequests()))
+
+	request := func(fragment *Payload, follows bool) frame.Frame {
+		return fragment.buildRequestStreamFrame(streamID, follows, initReqs)
+	}
+	if err := requester.sendFragments(ctx, streamID, payload, false, request); err != nil {
+		cancel()
 
-	request := payload.buildRequestStreamFrame(streamID, uint32(initReqs))
-	if err := requester.sendFrame(ctx, request); err != nil {
 		return nil, err
 	}
 
+	requester.observer.started(streamID, frame.TypeRequestStream, payload)
+
 	currentStreams.Inc()
 
-	return requester.receivePayloads(ctx, streamID, receiver, func() {
+	return requester.receivePayloads(ctx, streamID, receiver, flow, func() {
+		cancel()
+
 		currentStreams.Dec()
 	}), nil
 }
 
 func (requester *rSocketRequester) RequestChannel(ctx context.Context, payloads *PayloadStream) (*PayloadStream, error) {
+	ctx, cancel, err := requester.streamContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requester.acquireLease(); err != nil {
+		cancel()
+
+		return nil, err
+	}
+
 	streamID := requester.streamIDs.Next()
-	initReqs := requester.streamRequestLimit
-	receiver := requester.newResultReceiver(streamID, initReqs)
+	flow := requester.newFlow(ctx)
+	receiver, initReqs := requester.newResultReceiver(streamID, frame.TypeRequestChannel, uint(flow.InitialRequests()))
 
 	var complete bool
 	var payload *Payload
 
 	if result, ok := payloads.TryRecv(ctx); ok {
-		if result.Payload != nil {
+		if result != nil && result.Payload != nil {
 			payload = result.Payload
 		} else {
-			if result.Err != nil {
+			if result != nil && result.Err != nil {
 				defer requester.sendError(ctx, streamID, result.Err)
-			} else if result.Payload == nil {
-				defer requester.sendFrame(ctx, buildCompleteFrame(streamID))
-
+			} else {
+				// The REQUEST_CHANNEL frame with COMPLETE flag completes the requests stream.
 				complete = true
 			}
 
@@ -229,46 +928,103 @@ func (requester *rSocketRequester) RequestChannel(ctx context.Context, payloads
 		}
 	}
 
-	requestChannelFrame := payload.buildRequestChannelFrame(streamID, complete, uint32(initReqs))
+	if payload == nil {
+		err = requester.sendFrame(ctx, payload.buildRequestChannelFrame(streamID, false, complete, initReqs))
+	} else {
+		request := func(fragment *Payload, follows bool) frame.Frame {
+			return fragment.buildRequestChannelFrame(streamID, follows, false, initReqs)
+		}
 
-	if err := requester.sendFrame(ctx, requestChannelFrame); err != nil {
-		return nil, err
+		err = requester.sendFragments(ctx, streamID, payload, false, request)
 	}
 
-	if payloads != nil {
-		sender := requester.newResultSender(ctx, streamID, 0)
+	if err != nil {
+		cancel()
 
-		go func() error {
-			defer sender.Close()
-			defer requester.senders.Delete(streamID)
+		return nil, err
+	}
 
-			for {
-				payload, err := payloads.Recv(ctx)
+	requester.observer.started(streamID, frame.TypeRequestChannel, payload)
 
-				if err != nil {
-					return requester.sendError(ctx, streamID, err)
-				} else if payload == nil {
-					return requester.sendFrame(ctx, buildCompleteFrame(streamID))
-				}
+	// The context is cancelled once both directions of the channel terminated.
+	pending := int32(1)
+	release := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			cancel()
+		}
+	}
 
-				if err := sender.Acquire(ctx); err != nil {
-					return requester.sendError(ctx, streamID, err)
-				}
+	var sender *resultSender
 
-				payloadFrame := payload.buildPayloadFrame(streamID, false)
+	if payloads != nil {
+		sender = requester.newResultSender(ctx, streamID, 0)
 
-				if err := requester.sendFrame(ctx, payloadFrame); err != nil {
-					return requester.sendError(ctx, streamID, err)
-				}
-			}
-		}()
+		atomic.AddInt32(&pending, 1)
 	}
 
 	currentChannels.Inc()
 
-	return requester.receivePayloads(ctx, streamID, receiver, func() {
+	responses := requester.receivePayloads(ctx, streamID, receiver, flow, func() {
+		release()
+
 		currentChannels.Dec()
-	}), nil
+	})
+
+	if payloads == nil {
+		return responses, nil
+	}
+
+	// fail tells the responder with an ERROR frame, which terminates both directions of the channel,
+	// or a CANCEL frame if cancelled, unless the channel has been terminated, e.g. cancelled by the responder,
+	// or failed by the consumer, whose ERROR frame is sent once the responses terminated.
+	fail := func(err error) error {
+		if _, ok := requester.findSender(streamID); !ok || responses.cancelError() != nil {
+			return nil
+		}
+
+		if err == context.Canceled {
+			return requester.sendError(ctx, streamID, err)
+		}
+
+		if _, loaded := requester.receivers.LoadAndDelete(streamID); loaded {
+			// The responses fail with the error of payloads sent.
+			receiver.Send(Err(err))
+			receiver.Close()
+
+			requester.observer.terminated(streamID, err)
+		}
+
+		return requester.sendError(ctx, streamID, err)
+	}
+
+	go func() error {
+		defer release()
+		defer sender.Close()
+		defer requester.senders.Delete(streamID)
+
+		// The sink of payloads stops accepting payloads once no longer sent.
+		defer payloads.Cancel()
+
+		for {
+			payload, err := payloads.Recv(ctx)
+
+			if err != nil {
+				return fail(err)
+			} else if payload == nil {
+				return requester.sendFrame(ctx, buildCompleteFrame(streamID))
+			}
+
+			if err := sender.Acquire(ctx); err != nil {
+				return fail(err)
+			}
+
+			if err := requester.sendFragments(ctx, streamID, payload, false, payloadFragment(streamID, false)); err != nil {
+				return fail(err)
+			}
+		}
+	}()
+
+	return responses, nil
 }
 
 func (requester *rSocketRequester) sendFrame(ctx context.Context, frame frame.Frame) error {
@@ -281,20 +1037,62 @@ func (requester *rSocketRequester) sendFrame(ctx context.Context, frame frame.Fr
 
 	if err == nil {
 		frameSent.With(prometheus.Labels{typeLabel: frame.Type().String()}).Inc()
+
+		requester.tapFrame(Outbound, frame)
 	}
 
 	return err
 }
 
+func (requester *rSocketRequester) intercept(ctx context.Context, payload *Payload) (*Payload, error) {
+	for _, interceptor := range requester.interceptors {
+		var err error
+
+		if payload, err = interceptor(ctx, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	return payload, nil
+}
+
+func (requester *rSocketRequester) checkMetadata(hasMetadata bool) error {
+	if requester.strictMetadata && hasMetadata && requester.metadataMimeType == "" {
+		return ErrMetadataNotNegotiated
+	}
+
+	return nil
+}
+
+func (requester *rSocketRequester) sendFragments(ctx context.Context, streamID StreamID, payload *Payload, complete bool, build fragmentBuilder) error {
+	payload, err := requester.intercept(ctx, payload)
+
+	if err != nil {
+		return err
+	}
+
+	if err = requester.checkMetadata(payload.HasMetadata); err != nil {
+		return err
+	}
+
+	logRequestID(requester.Logger, "send payload", streamID, payload)
+
+	for _, f := range fragmentFrames(streamID, requester.fragmentSize, payload, complete, build) {
+		if err := requester.sendFrame(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (requester *rSocketRequester) sendError(ctx context.Context, streamID StreamID, err error) error {
 	var f frame.Frame
 
 	if err == context.Canceled {
 		f = frame.NewCancelFrame(streamID)
-	} else if errorFrame, ok := err.(*frame.Error); ok {
-		f = frame.NewErrorFrame(streamID, errorFrame.Code, errorFrame.Data)
 	} else {
-		f = frame.NewErrorFrame(streamID, frame.ErrApplicationError, err.Error())
+		f = buildErrorFrame(streamID, err)
 	}
 
 	return requester.sendFrame(ctx, f)
@@ -304,45 +1102,188 @@ func (requester *rSocketRequester) receivePayloads(
 	ctx context.Context,
 	streamID StreamID,
 	receiver *resultReceiver,
+	flow FlowControl,
 	destructor func(),
 ) *PayloadStream {
+	ctx, cancel := context.WithCancel(ctx)
+	cancelled := make(chan struct{})
 	results := make(chan *Result)
-	sink := &PayloadSink{results}
+	sink := &PayloadSink{C: results, cancelled: cancelled}
+	stream := &PayloadStream{C: results, streamID: streamID, cancelled: cancelled}
+	stream.requestN = func(n uint32) error {
+		// The credit never exceeds the buffer, the requests beyond are granted once the payloads buffered consumed.
+		if n = receiver.grant(n); n == 0 {
+			return nil
+		}
+
+		return requester.sendFrame(ctx, frame.NewRequestNFrame(streamID, n))
+	}
+
+	go func() {
+		// The stream cancelled by the consumer stops receiving the payloads.
+		select {
+		case <-cancelled:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	go func() (err error) {
+		var undelivered error // The error received but not delivered to the consumer.
 
-	go func() error {
 		defer destructor()
+		defer cancel()
+		defer receiver.discard()
 		defer close(results)
-		defer requester.receivers.Delete(streamID)
+		defer func() {
+			if ctx.Err() != nil {
+				if undelivered == nil || undelivered == ctx.Err() {
+					undelivered = pendingError(receiver)
+				}
 
-		requestN := requester.streamRequestLimit
+				if err := undelivered; err != nil {
+					// The stream is aborted before the consumer receives the error, e.g. the connection closed.
+					stream.fail(err)
+				} else {
+					// The stream is cancelled before the consumer receives the completion.
+					stream.terminate(ctx.Err())
+				}
+			}
+		}()
+		defer requester.dropEarlyRequests(streamID)
+		defer func() {
+			// The stream is terminated by the requester, it was not completed by the responder.
+			if _, loaded := requester.receivers.LoadAndDelete(streamID); loaded {
+				select {
+				case <-cancelled:
+					if failure := stream.cancelError(); failure != nil && receiver.requestType == frame.TypeRequestChannel {
+						// The ERROR frame terminates both directions of the channel, the payloads are no longer sent.
+						requester.sendError(context.Background(), streamID, failure)
+
+						if sender, ok := requester.senders.LoadAndDelete(streamID); ok {
+							sender.(*resultSender).Close()
+						}
+					} else {
+						// The stream context is done, the CANCEL frame is sent regardless.
+						requester.sendFrame(context.Background(), frame.NewCancelFrame(streamID))
+					}
+				default:
+				}
+
+				requester.observer.terminated(streamID, err)
+			}
+		}()
+
+		var withheld uint32 // The requests withheld while the payloads buffered exceed the byte budget.
 
 		for {
-			if requestN == 0 {
-				requestN = requester.streamRequestLimit
-				requestNFrame := frame.NewRequestNFrame(streamID, uint32(requestN))
+			payload, err := receiver.Recv(ctx)
+
+			if err != nil && err == ctx.Err() {
+				// The stream is aborted, the error received but not delivered takes precedence, e.g. the connection closed.
+				if pending := pendingError(receiver); pending != nil {
+					err = pending
+				}
+			}
 
-				if err := requester.sendFrame(ctx, requestNFrame); err != nil {
+			if payload == nil && err == nil {
+				return nil
+			}
+
+			if payload != nil {
+				// The payload consumed makes room for the requests withheld.
+				if err := stream.requestN(0); err != nil {
 					return err
 				}
 			}
 
-			payload, err := receiver.Recv(ctx)
+			if timer, ok := flow.(consumerTimer); ok && payload != nil {
+				timer.Ready()
+			}
 
-			if payload == nil && err == nil {
+			// The result may be released by the consumer once sent.
+			failed := err != nil
+			size := payloadBytes(payload)
+
+			if sendErr := sink.Send(ctx, newResult(payload, err)); sendErr != nil {
+				undelivered = err
+
+				return sendErr
+			}
+
+			if failed {
+				continue
+			}
+
+			buffered := atomic.AddInt64(&receiver.buffered, -size)
+
+			withheld += flow.Received()
+
+			if withheld == 0 || (requester.byteBudget > 0 && buffered >= requester.byteBudget) {
+				continue
+			}
+
+			requestN := withheld
+			withheld = 0
+
+			if err := stream.request(requestN); err != nil {
+				return err
+			}
+		}
+	}()
+
+	return stream
+}
+
+// pendingError returns the error received but not delivered to the consumer, or nil if not failed.
+func pendingError(receiver *resultReceiver) error {
+	for {
+		select {
+		case result, ok := <-receiver.PayloadStream.C:
+			if !ok || result == nil {
 				return nil
 			}
 
-			err = sink.Send(ctx, &Result{payload, err})
+			// The payloads are dropped, the stream is aborted.
+			err := result.Err
+
+			result.release()
 
 			if err != nil {
 				return err
 			}
-
-			requestN--
+		default:
+			return nil
 		}
-	}()
+	}
+}
+
+// creditExceeded closes the connection with CONNECTION_ERROR once the responder sends more payloads than requested.
+func (requester *rSocketRequester) creditExceeded(ctx context.Context, streamID StreamID) error {
+	requester.Warn("payloads exceed the requested credit", zap.Uint32("stream", uint32(streamID)))
 
-	return &PayloadStream{results}
+	if err := requester.sendError(ctx, 0, ErrCreditExceeded); err != nil {
+		return err
+	}
+
+	return ErrCreditExceeded
+}
+
+// payloadBytes returns the bytes of payload counted in the byte budget.
+func payloadBytes(payload *Payload) int64 {
+	if payload == nil {
+		return 0
+	}
+
+	return int64(len(payload.Metadata) + len(payload.Data))
+}
+
+func (requester *rSocketRequester) mapError(err *Error) error {
+	if requester.errorMapper == nil {
+		return err
+	}
+
+	return requester.errorMapper(err)
 }
 
 func (requester *rSocketRequester) findSender(streamID StreamID) (*resultSender, bool) {
@@ -368,6 +1309,23 @@ func (requester *rSocketRequester) findReceiver(streamID StreamID) (*resultRecei
 func (requester *rSocketRequester) HandleFrame(ctx context.Context, f frame.Frame) error {
 	frameReceived.With(prometheus.Labels{typeLabel: f.Type().String()}).Inc()
 
+	requester.tapFrame(Inbound, f)
+
+	received := f
+
+	defer func() {
+		// The frame is released once handled, unless its payload buffered for the consumer.
+		if received != nil {
+			frame.Release(received)
+		}
+	}()
+
+	f, err := requester.reassembler.Reassemble(f)
+
+	if f == nil || err != nil {
+		return err
+	}
+
 	streamID := f.StreamID()
 
 	requester.Debug("handle frame",
@@ -375,21 +1333,61 @@ func (requester *rSocketRequester) HandleFrame(ctx context.Context, f frame.Fram
 		zap.Stringer("type", f.Type()),
 		zap.Uint16("flags", uint16(f.Flags())))
 
+	if leaseFrame, ok := f.(*frame.LeaseFrame); ok && requester.lease != nil {
+		return requester.lease.Grant(leaseFrame.TimeToLive, leaseFrame.NumberOfRequests)
+	}
+
+	if keepaliveFrame, ok := f.(*frame.KeepaliveFrame); ok {
+		if requester.echoKeepalive && keepaliveFrame.NeedRespond() {
+			return requester.sendFrame(ctx, frame.NewKeepaliveFrame(false, 0, keepaliveFrame.Data))
+		}
+
+		return nil
+	}
+
+	if errorFrame, ok := f.(*frame.ErrorFrame); ok && (streamID == 0 || errorFrame.IsConnectionError()) {
+		// The connection-level error tears down the whole connection, the streams in progress fail with it.
+		err := requester.mapError(errorFrame.Error)
+
+		requester.Warn("connection terminated by peer", zap.Uint32("stream", uint32(streamID)), zap.Error(err))
+
+		requester.Abort(ctx, err)
+		requester.Close()
+
+		return errorFrame.Error
+	}
+
+	if requestN, ok := f.(*frame.RequestNFrame); ok {
+		// The REQUEST_N may race with the termination of stream, it is benign and ignored.
+		if !requester.requestSender(streamID, requestN.N) {
+			requester.Debug("ignore REQUEST_N for terminated stream",
+				zap.Uint32("stream", uint32(streamID)),
+				zap.Uint32("n", requestN.N))
+		}
+
+		return nil
+	}
+
 	if receiver, ok := requester.findReceiver(streamID); ok {
 		complete := func(reason error) {
 			requester.Debug("stream complete",
 				zap.Uint32("stream", uint32(streamID)),
 				zap.Error(reason))
 
-			requester.receivers.Delete(streamID)
-			receiver.Close()
+			if _, loaded := requester.receivers.LoadAndDelete(streamID); loaded {
+				receiver.Close()
+
+				requester.observer.terminated(streamID, reason)
+			}
 		}
 
 		switch f := f.(type) {
 		case *frame.ErrorFrame:
-			defer complete(f.Err())
+			err := requester.mapError(f.Error)
+
+			defer complete(err)
 
-			return receiver.Send(ctx, Err(f.Err()))
+			return receiver.Send(Err(err))
 
 		case *frame.CancelFrame:
 			defer complete(context.Canceled)
@@ -399,7 +1397,7 @@ func (requester *rSocketRequester) HandleFrame(ctx context.Context, f frame.Fram
 				sender.cancel()
 			}
 
-			return receiver.Send(ctx, Err(context.Canceled))
+			return receiver.Send(Err(context.Canceled))
 
 		case *frame.PayloadFrame:
 			if f.Complete() {
@@ -407,29 +1405,57 @@ func (requester *rSocketRequester) HandleFrame(ctx context.Context, f frame.Fram
 			}
 
 			if f.Next() {
-				return receiver.Send(ctx, Ok(&Payload{
+				atomic.AddInt64(&receiver.received, 1)
+
+				if credits := atomic.AddInt64(&receiver.credits, -1); requester.strictFlowControl && credits < 0 {
+					return requester.creditExceeded(ctx, streamID)
+				}
+
+				payload := &Payload{
 					HasMetadata: f.HasMetadata(),
 					Metadata:    f.Metadata,
 					Data:        f.Data,
-				}))
-			}
+				}
 
-			if !f.Complete() && !f.Next() {
-				return frame.ErrInvalid
-			}
+				requester.observer.next(streamID, payload)
 
-		case *frame.RequestNFrame:
-			if sender, ok := requester.findSender(streamID); ok {
-				sender.Requests(f.N)
+				atomic.AddInt64(&receiver.buffered, payloadBytes(payload))
+
+				result := newResult(payload, nil)
+
+				// The buffer of frame is held until the payload consumed.
+				result.source, received = received, nil
+
+				if err := receiver.Send(result); err != nil {
+					// The responder ignores the credit, the buffer would block the read loop otherwise.
+					return requester.creditExceeded(ctx, streamID)
+				}
 
 				return nil
 			}
 
+			if !f.Complete() && !f.Next() {
+				return frame.ErrInvalid
+			}
+
 		default:
 			return fmt.Errorf("Client received unsupported %s frame on stream (%d)", f, streamID)
 		}
 	} else if streamID > requester.streamIDs.Current() {
 		return fmt.Errorf("Client received %s frame for non-existent stream (%d)", f, streamID)
+	} else if requester.fireAndForgets.Contains(streamID) {
+		// No one consumes the frames on a FIRE_AND_FORGET stream, the responder misbehaves.
+		requester.Warn("received frame on fire-and-forget stream",
+			zap.Uint32("stream", uint32(streamID)),
+			zap.Stringer("type", f.Type()))
+
+		if requester.strictFireForget {
+			if err := requester.sendError(ctx, 0, ErrFireAndForgetResponded); err != nil {
+				return err
+			}
+
+			return ErrFireAndForgetResponded
+		}
 	} else {
 		// Receiving a Request frame on a Stream ID that is already in use MUST be ignored.
 	}
@@ -1,7 +1,9 @@
 package proto
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"sync"
@@ -33,6 +35,12 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+type frameChan = *FrameChan
+
+func buildPayloadFrame(streamID StreamID, complete bool, payload *Payload) *frame.PayloadFrame {
+	return payload.buildPayloadFrame(streamID, complete)
+}
+
 type testEnv struct {
 	t         *testing.T
 	ctx       context.Context
@@ -96,7 +104,7 @@ type logFrameSender struct {
 }
 
 func (sender logFrameSender) Close() error {
-	close(sender.c)
+	sender.c.Close()
 
 	return nil
 }
@@ -111,8 +119,8 @@ func run(t *testing.T, callbacks ...runCallback) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	requests := make(frameChan)
-	responses := make(frameChan)
+	requests := NewFrameChan(0)
+	responses := NewFrameChan(0)
 	requester := NewRequester(logger, logFrameSender{t, requests}, ClientStreamIDs(), uint(initReqs)).(*rSocketRequester)
 
 	wg := new(sync.WaitGroup)
@@ -297,6 +305,122 @@ func TestRequestStreamCanceled(t *testing.T) {
 	)
 }
 
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: PAYLOAD
+// RQ -> RS: CANCEL
+func TestRequestStreamCancelledByConsumer(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When the consumer cancels a stream in progress", func() {
+			stream, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+			So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+
+			payload, err := stream.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(payload, ShouldResemble, Text("foo"))
+
+			stream.Cancel()
+
+			Convey("Then the responder should be told with CANCEL", func() {
+				f, err := requests.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeCancel, 0)
+
+				_, ok := requester.findReceiver(1)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Then the stream should end as cancelled", func() {
+				payload, err := stream.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+				So(stream.Context().Err(), ShouldEqual, context.Canceled)
+			})
+		})
+	})
+}
+
+func TestRequestStreamReleasesFrames(t *testing.T) {
+	Convey("Given a requester receives the frames read with an allocator", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		allocator := frame.NewBudgetAllocator(1 << 10)
+
+		var buf bytes.Buffer
+
+		w := frame.NewWriter(logger, &buf)
+
+		for i := 0; i < 3; i++ {
+			_, err := w.WriteFrame(Text("foo").buildPayloadFrame(1, false))
+			So(err, ShouldBeNil)
+		}
+
+		r := frame.NewReader(logger, &buf)
+		r.Allocator = allocator
+
+		stream, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+		for i := 0; i < 3; i++ {
+			f, err := r.ReadFrame()
+			So(err, ShouldBeNil)
+			So(requester.HandleFrame(ctx, f), ShouldBeNil)
+		}
+
+		Convey("When the payloads are not consumed", func() {
+			Convey("Then the buffers should be held", func() {
+				So(allocator.Used(), ShouldBeGreaterThan, 0)
+			})
+		})
+
+		Convey("When the payloads are consumed", func() {
+			for i := 0; i < 3; i++ {
+				payload, err := stream.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(payload, ShouldResemble, Text("foo"))
+			}
+
+			Convey("Then the buffers should be released", func() {
+				So(allocator.Used(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the stream is cancelled with the payloads buffered", func() {
+			stream.Cancel()
+
+			f, err := requests.Recv(ctx)
+			So(err, ShouldBeNil)
+			checkFrameHeader(f, 1, frame.TypeCancel, 0)
+
+			Convey("Then the buffers should be released", func() {
+				for allocator.Used() > 0 && ctx.Err() == nil {
+					time.Sleep(time.Millisecond)
+				}
+
+				So(allocator.Used(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
 // RQ -> RS: REQUEST_STREAM
 // RS -> RQ: PAYLOAD*
 // RQ -> RS: REQUEST_N
@@ -375,13 +499,13 @@ func TestRequestChannelCompleteFromRequesterAndResponder(t *testing.T) {
 		asClient(func(ctx context.Context, requester *rSocketRequester) {
 			Convey("RQ -> RS: When payloads be ready before send request", func() {
 				requests := make(chan *Result, 16)
-				sink := &PayloadSink{requests}
+				sink := &PayloadSink{C: requests}
 
 				So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 				So(sink.Send(ctx, Ok(Text("world"))), ShouldBeNil)
 				So(sink.Close(), ShouldBeNil)
 
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 
 				So(err, ShouldBeNil)
 
@@ -461,11 +585,11 @@ func TestRequestChannelErrorFromRequesterAndResponderTerminates(t *testing.T) {
 			requests := make(chan *Result, 128)
 
 			Convey("Then send request immediately", func() {
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 
 				So(err, ShouldBeNil)
 				Convey("When payloads sent after request", func() {
-					sink := &PayloadSink{requests}
+					sink := &PayloadSink{C: requests}
 
 					So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 
@@ -553,11 +677,11 @@ func TestRequestChannelErrorFromRequesterAndResponderAlreadyCompleted(t *testing
 			requests := make(chan *Result, 128)
 
 			Convey("RQ -> RS: Then send request immediately", func() {
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 				So(err, ShouldBeNil)
 
 				Convey("RQ -> RS: When payloads sent after request", func() {
-					sink := &PayloadSink{requests}
+					sink := &PayloadSink{C: requests}
 
 					So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 
@@ -644,11 +768,11 @@ func TestRequestChannelErrorFromResponderAndRequesterTerminates(t *testing.T) {
 			requests := make(chan *Result, 128)
 
 			Convey("RQ -> RS: Then send request immediately", func() {
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 				So(err, ShouldBeNil)
 
 				Convey("RQ -> When payloads sent after request", func() {
-					sink := &PayloadSink{requests}
+					sink := &PayloadSink{C: requests}
 
 					So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 
@@ -724,13 +848,13 @@ func TestRequestChannelErrorFromResponderAndRequesterAlreadyCompleted(t *testing
 		asClient(func(ctx context.Context, requester *rSocketRequester) {
 			Convey("RQ -> RS: When payloads be ready before send request", func() {
 				requests := make(chan *Result, 16)
-				sink := &PayloadSink{requests}
+				sink := &PayloadSink{C: requests}
 
 				So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 				So(sink.Send(ctx, Ok(Text("world"))), ShouldBeNil)
 				So(sink.Close(), ShouldBeNil)
 
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 
 				So(err, ShouldBeNil)
 
@@ -801,14 +925,14 @@ func TestRequestChannelCancelFromRequesterAndResponderTerminates(t *testing.T) {
 		asClient(func(ctx context.Context, requester *rSocketRequester) {
 			Convey("RQ -> RS: When payloads be ready before send request", func() {
 				requests := make(chan *Result, 16)
-				sink := &PayloadSink{requests}
+				sink := &PayloadSink{C: requests}
 
 				So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 				So(sink.Send(ctx, Ok(Text("world"))), ShouldBeNil)
 				So(sink.Send(ctx, Err(context.Canceled)), ShouldBeNil)
 				So(sink.Close(), ShouldBeNil)
 
-				responses, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 
 				So(err, ShouldBeNil)
 
@@ -874,7 +998,7 @@ func TestRequestChannelCompleteWithFlowControl(t *testing.T) {
 		asClient(func(ctx context.Context, requester *rSocketRequester) {
 			Convey("RQ -> RS: When payloads be ready before send request", func() {
 				requests := make(chan *Result, 16)
-				sink := &PayloadSink{requests}
+				sink := &PayloadSink{C: requests}
 
 				So(sink.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
 				So(sink.Send(ctx, Ok(Text("world"))), ShouldBeNil)
@@ -882,7 +1006,7 @@ func TestRequestChannelCompleteWithFlowControl(t *testing.T) {
 				So(sink.Send(ctx, Ok(Text("bar"))), ShouldBeNil)
 				So(sink.Close(), ShouldBeNil)
 
-				_, err := requester.RequestChannel(ctx, &PayloadStream{requests})
+				_, err := requester.RequestChannel(ctx, &PayloadStream{C: requests})
 
 				So(err, ShouldBeNil)
 			})
@@ -982,6 +1106,58 @@ func TestRequestResponseComplete(t *testing.T) {
 	)
 }
 
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD[NEXT|COMPLETE] or PAYLOAD[COMPLETE] without data
+func TestRequestResponseWithEmptyPayload(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		respond := func(response *frame.PayloadFrame) (*Payload, error) {
+			result := make(chan *Payload, 1)
+			failure := make(chan error, 1)
+
+			go func() {
+				payload, err := requester.RequestResponse(ctx, Text("hello"))
+
+				result <- payload
+				failure <- err
+			}()
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestResponse, 0)
+
+			So(requester.HandleFrame(ctx, response), ShouldBeNil)
+
+			return <-result, <-failure
+		}
+
+		Convey("When the responder completes with empty data", func() {
+			payload, err := respond(frame.NewPayloadFrame(1, false, true, true, false, nil, nil))
+
+			Convey("Then an empty payload should be returned", func() {
+				So(err, ShouldBeNil)
+				So(payload, ShouldNotBeNil)
+				So(payload.HasMetadata, ShouldBeFalse)
+				So(payload.Data, ShouldNotBeNil)
+				So(payload.Data, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the responder completes without payload", func() {
+			payload, err := respond(frame.NewPayloadFrame(1, false, true, false, false, nil, nil))
+
+			Convey("Then no payload should be returned", func() {
+				So(err, ShouldBeNil)
+				So(payload, ShouldBeNil)
+			})
+		})
+	})
+}
+
 // RQ -> RS: REQUEST_RESPONSE
 // RS -> RQ: ERROR[APPLICATION_ERROR|REJECTED|CANCELED|INVALID]
 func TestRequestResponseWithError(t *testing.T) {
@@ -1040,6 +1216,16 @@ func TestRequestResponseCanceled(t *testing.T) {
 
 				Convey("RS -> RQ: Then cancel the request", func() {
 					cancel()
+
+					Convey("RQ -> RS: Then CANCEL should be sent", func() {
+						ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+						defer cancel()
+
+						f, err := requests.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						checkFrameHeader(f, 1, frame.TypeCancel, 0)
+					})
 				})
 			})
 		}),
@@ -1093,3 +1279,735 @@ func TestMetadataPush(t *testing.T) {
 		}),
 	)
 }
+
+func TestRequesterWithStrictMetadata(t *testing.T) {
+	Convey("Given a strict requester on a connection without metadata MIME type", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(1)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithStrictMetadata(""))
+
+		Convey("Then the payload with metadata should be rejected before sent", func() {
+			So(requester.FireAndForget(ctx, Text("hello").WithMetadata([]byte("world"))), ShouldEqual, ErrMetadataNotNegotiated)
+			So(requester.MetadataPush(ctx, []byte("world")), ShouldEqual, ErrMetadataNotNegotiated)
+			So(requests.C, ShouldBeEmpty)
+		})
+
+		Convey("Then the payload without metadata should be sent", func() {
+			So(requester.FireAndForget(ctx, Text("hello")), ShouldBeNil)
+			So(requests.C, ShouldHaveLength, 1)
+		})
+	})
+}
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+const errQuotaExceededCode = frame.ErrorCode(0x00000301)
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: ERROR[0x00000301]
+func TestRequesterWithErrorMapper(t *testing.T) {
+	Convey("Given a requester maps the custom error code to a sentinel error", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requester := NewRequester(logger, NewFrameChan(1), ClientStreamIDs(), initReqs, WithErrorMapper(func(err *Error) error {
+			if err.Code == errQuotaExceededCode {
+				return errQuotaExceeded
+			}
+
+			return err
+		})).(*rSocketRequester)
+
+		Convey("When the responder fails the stream with the custom error", func() {
+			stream, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			So(requester.HandleFrame(ctx, frame.NewErrorFrame(1, errQuotaExceededCode, "quota")), ShouldBeNil)
+
+			Convey("Then the consumer should observe the sentinel error", func() {
+				payload, err := stream.Recv(ctx)
+
+				So(payload, ShouldBeNil)
+				So(err, ShouldEqual, errQuotaExceeded)
+			})
+		})
+
+		Convey("When the responder fails the stream with other error", func() {
+			stream, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			So(requester.HandleFrame(ctx, frame.NewErrorFrame(1, frame.ErrApplicationError, "failed")), ShouldBeNil)
+
+			Convey("Then the consumer should observe the protocol error", func() {
+				_, err := stream.Recv(ctx)
+
+				So(err, ShouldResemble, frame.ErrApplicationError.WithMessage("failed"))
+			})
+		})
+	})
+}
+
+func TestRequesterOnConnectionError(t *testing.T) {
+	Convey("Given a requester with a stream in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requester := NewRequester(logger, NewFrameChan(4), ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		stream, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		Convey("When the responder terminates the connection", func() {
+			err := requester.HandleFrame(ctx, frame.NewErrorFrame(0, frame.ErrConnectionError, "shutdown"))
+
+			Convey("Then the connection-level error should be returned to tear down the connection", func() {
+				So(err, ShouldResemble, frame.ErrConnectionError.WithMessage("shutdown"))
+
+				Convey("And the stream in progress should fail with it", func() {
+					_, err := stream.Recv(ctx)
+
+					So(err, ShouldResemble, frame.ErrConnectionError.WithMessage("shutdown"))
+				})
+
+				Convey("And the following requests should fail with ErrClosed", func() {
+					_, err := requester.RequestResponse(ctx, Text("hello"))
+
+					So(err, ShouldEqual, ErrClosed)
+				})
+			})
+		})
+
+		Convey("When the responder fails the stream with a stream-level error", func() {
+			So(requester.HandleFrame(ctx, frame.NewErrorFrame(1, frame.ErrRejected, "busy")), ShouldBeNil)
+
+			Convey("Then the following requests should still be accepted", func() {
+				_, err := requester.RequestStream(ctx, Text("hello"))
+
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestRequesterOnConnectionErrorWhileReceiving(t *testing.T) {
+	Convey("Given a requester with a stream receiving payloads", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(0)
+		defer requests.Close()
+
+		go func() {
+			for range requests.C {
+			}
+		}()
+
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		stream, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		consumed := make(chan error, 1)
+
+		go func() {
+			for {
+				payload, err := stream.Recv(ctx)
+
+				if err != nil || payload == nil {
+					consumed <- err
+
+					return
+				}
+			}
+		}()
+
+		Convey("When the responder terminates the connection with the payloads in flight", func() {
+			for i := 0; i < 100; i++ {
+				So(requester.HandleFrame(ctx, Text("foo").buildPayloadFrame(1, false)), ShouldBeNil)
+			}
+
+			err := requester.HandleFrame(ctx, frame.NewErrorFrame(0, frame.ErrConnectionError, "shutdown"))
+
+			Convey("Then the stream should fail with the connection error", func() {
+				So(err, ShouldResemble, frame.ErrConnectionError.WithMessage("shutdown"))
+				So(<-consumed, ShouldResemble, frame.ErrConnectionError.WithMessage("shutdown"))
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL
+// RQ -> RS: COMPLETE
+func TestRequestChannelCompleteOnceSourceClosed(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When request channel with a source closed after the first payload", func() {
+			c := make(chan *Result, 1)
+			source := &PayloadSink{C: c}
+
+			So(source.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
+
+			_, err := requester.RequestChannel(ctx, &PayloadStream{C: c})
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestChannel, 0)
+			So(string(f.(*frame.RequestChannelFrame).Data), ShouldEqual, "hello")
+
+			So(source.Close(), ShouldBeNil)
+
+			Convey("Then exactly one COMPLETE without data should be sent", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagComplete)
+				So(f.(*frame.PayloadFrame).Data, ShouldBeNil)
+
+				time.Sleep(10 * time.Millisecond)
+
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When request channel with a source closed before the request", func() {
+			c := make(chan *Result)
+			close(c)
+
+			_, err := requester.RequestChannel(ctx, &PayloadStream{C: c})
+			So(err, ShouldBeNil)
+
+			Convey("Then the request should complete the requests stream without extra COMPLETE", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypeRequestChannel, frame.FlagComplete)
+				So(f.(*frame.RequestChannelFrame).Data, ShouldBeNil)
+
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL
+// RQ -> RS: COMPLETE
+//
+// racing with
+//
+// RS -> RQ: COMPLETE
+func TestRequestChannelCompleteFromBothSidesConcurrently(t *testing.T) {
+	Convey("Given a requester with a stream observer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		const iterations = 100
+
+		observer := &recordingObserver{terminated: make(chan StreamID, iterations*2)}
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs,
+			WithStreamObserver(observer)).(*rSocketRequester)
+
+		Convey("When both sides complete the channels at the same time", func() {
+			for i := 0; i < iterations; i++ {
+				streamID := StreamID(i*2 + 1)
+
+				c := make(chan *Result, 1)
+				source := &PayloadSink{C: c}
+
+				So(source.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
+
+				responses, err := requester.RequestChannel(ctx, &PayloadStream{C: c})
+				So(err, ShouldBeNil)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, streamID, frame.TypeRequestChannel, 0)
+
+				go source.Close()
+
+				So(func() {
+					So(requester.HandleFrame(ctx, buildCompleteFrame(streamID)), ShouldBeNil)
+				}, ShouldNotPanic)
+
+				payload, err := responses.Recv(ctx)
+				So(payload, ShouldBeNil)
+				So(err, ShouldBeNil)
+
+				f, _ = requests.Recv(ctx)
+				checkFrameHeader(f, streamID, frame.TypePayload, frame.FlagComplete)
+
+				// The sender is removed once the COMPLETE sent.
+				for _, ok := requester.findSender(streamID); ok && ctx.Err() == nil; _, ok = requester.findSender(streamID) {
+					time.Sleep(time.Millisecond)
+				}
+
+				_, ok := requester.findReceiver(streamID)
+				So(ok, ShouldBeFalse)
+				_, ok = requester.findSender(streamID)
+				So(ok, ShouldBeFalse)
+			}
+
+			Convey("Then each stream should be terminated exactly once", func() {
+				So(requester.ActiveStreams(), ShouldBeEmpty)
+				So(requests.C, ShouldBeEmpty)
+				So(observer.terminated, ShouldHaveLength, iterations)
+
+				for _, event := range observer.Events() {
+					So(event, ShouldNotStartWith, "error")
+				}
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD with COMPLETE
+//
+// racing with
+//
+// RQ -> RS: CANCEL
+func TestRequestResponseCancelRacesWithResponse(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When cancel the requests while the responses arriving", func() {
+			for i := 0; i < 100; i++ {
+				reqCtx, reqCancel := context.WithCancel(ctx)
+				done := make(chan struct{})
+
+				var payload *Payload
+				var err error
+
+				go func() {
+					defer close(done)
+
+					payload, err = requester.RequestResponse(reqCtx, Text("hello"))
+				}()
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, StreamID(i*2+1), frame.TypeRequestResponse, 0)
+
+				if i%2 == 0 {
+					// The response arrives after the request cancelled.
+					reqCancel()
+					<-done
+				} else {
+					go reqCancel()
+				}
+
+				So(requester.HandleFrame(ctx, Text("world").buildPayloadFrame(f.StreamID(), true)), ShouldBeNil)
+
+				<-done
+
+				// Either the response is delivered, or the request is cancelled with a CANCEL frame.
+				if err == nil {
+					So(payload, ShouldResemble, Text("world"))
+				} else {
+					So(err, ShouldEqual, context.Canceled)
+					So(payload, ShouldBeNil)
+
+					f, err := requests.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, StreamID(i*2+1), frame.TypeCancel, 0)
+				}
+
+				So(requests.C, ShouldBeEmpty)
+
+				_, ok := requester.findReceiver(f.StreamID())
+				So(ok, ShouldBeFalse)
+			}
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD with COMPLETE
+// RQ -> RS: REQUEST_RESPONSE once the first request completed
+func TestRequesterWithMaxConcurrentRequests(t *testing.T) {
+	Convey("Given a requester limits 1 concurrent request", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithMaxConcurrentRequests(1)).(*rSocketRequester)
+
+		Convey("When send two requests concurrently", func() {
+			first := make(chan error, 1)
+			second := make(chan error, 1)
+
+			go func() {
+				_, err := requester.RequestResponse(ctx, Text("foo"))
+
+				first <- err
+			}()
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestResponse, 0)
+
+			go func() {
+				_, err := requester.RequestResponse(ctx, Text("bar"))
+
+				second <- err
+			}()
+
+			Convey("Then the second request should block until the first completes", func() {
+				time.Sleep(10 * time.Millisecond)
+
+				So(requests.C, ShouldBeEmpty)
+
+				So(requester.HandleFrame(ctx, Text("hello").buildPayloadFrame(1, true)), ShouldBeNil)
+				So(<-first, ShouldBeNil)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 3, frame.TypeRequestResponse, 0)
+
+				So(requester.HandleFrame(ctx, Text("world").buildPayloadFrame(3, true)), ShouldBeNil)
+				So(<-second, ShouldBeNil)
+			})
+		})
+
+		Convey("When the waiting request is cancelled", func() {
+			go requester.RequestResponse(ctx, Text("foo"))
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestResponse, 0)
+
+			waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer waitCancel()
+
+			_, err := requester.RequestResponse(waitCtx, Text("bar"))
+
+			Convey("Then the request should fail with the context error", func() {
+				So(err, ShouldResemble, context.DeadlineExceeded)
+				So(requests.C, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL
+// RS -> RQ: REQUEST_N
+// RQ -> RS: PAYLOAD with metadata
+// RQ -> RS: PAYLOAD with metadata
+func TestRequestChannelPreservesMetadata(t *testing.T) {
+	Convey("Given a requester", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		Convey("When request channel with the items carry distinct metadata", func() {
+			c := make(chan *Result, 3)
+			source := &PayloadSink{C: c}
+
+			So(source.Send(ctx, Ok(Text("hello"))), ShouldBeNil)
+
+			_, err := requester.RequestChannel(ctx, &PayloadStream{C: c})
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestChannel, 0)
+
+			So(requester.HandleFrame(ctx, frame.NewRequestNFrame(1, 2)), ShouldBeNil)
+
+			So(source.Send(ctx, Ok(Text("foo").WithMetadata([]byte("route.foo")))), ShouldBeNil)
+			So(source.Send(ctx, Ok(Text("bar").WithMetadata([]byte("route.bar")))), ShouldBeNil)
+
+			Convey("Then each PAYLOAD frame should carry the metadata of its item", func() {
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext|frame.FlagMetadata)
+				So(string(f.(*frame.PayloadFrame).Metadata), ShouldEqual, "route.foo")
+				So(string(f.(*frame.PayloadFrame).Data), ShouldEqual, "foo")
+
+				f, _ = requests.Recv(ctx)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext|frame.FlagMetadata)
+				So(string(f.(*frame.PayloadFrame).Metadata), ShouldEqual, "route.bar")
+				So(string(f.(*frame.PayloadFrame).Data), ShouldEqual, "bar")
+			})
+		})
+	})
+}
+
+func TestRequesterRetainsEarlyRequests(t *testing.T) {
+	Convey("Given a requester with a channel in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requester := NewRequester(logger, NewFrameChan(4), ClientStreamIDs(), initReqs).(*rSocketRequester)
+		streamID := requester.streamIDs.Next()
+		requester.newResultReceiver(streamID, frame.TypeRequestChannel, uint(initReqs))
+
+		Convey("When a REQUEST_N received before the sender registered", func() {
+			So(requester.HandleFrame(ctx, frame.NewRequestNFrame(streamID, 3)), ShouldBeNil)
+			So(requester.HandleFrame(ctx, frame.NewRequestNFrame(streamID, 2)), ShouldBeNil)
+
+			sender := requester.newResultSender(ctx, streamID, 0)
+
+			Convey("Then the requests should be applied once registered", func() {
+				So(sender.requests, ShouldEqual, 5)
+				So(requester.earlyRequests, ShouldBeEmpty)
+
+				So(requester.HandleFrame(ctx, frame.NewRequestNFrame(streamID, 1)), ShouldBeNil)
+				So(sender.requests, ShouldEqual, 6)
+			})
+		})
+
+		Convey("When a REQUEST_N received for a stream not in progress", func() {
+			So(requester.HandleFrame(ctx, frame.NewRequestNFrame(streamID+2, 3)), ShouldBeNil)
+
+			Convey("Then the requests should be ignored", func() {
+				So(requester.earlyRequests, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestRequestNAfterStreamComplete(t *testing.T) {
+	Convey("Given a requester with a stream completed", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		responses, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+
+		So(requester.HandleFrame(ctx, buildCompleteFrame(1)), ShouldBeNil)
+
+		payload, err := responses.Recv(ctx)
+		So(payload, ShouldBeNil)
+		So(err, ShouldBeNil)
+
+		Convey("When a REQUEST_N received for the stream", func() {
+			So(func() {
+				So(requester.HandleFrame(ctx, frame.NewRequestNFrame(1, 3)), ShouldBeNil)
+			}, ShouldNotPanic)
+
+			Convey("Then the requester should still serve the requests", func() {
+				So(requester.earlyRequests, ShouldBeEmpty)
+
+				_, err := requester.RequestStream(ctx, Text("world"))
+				So(err, ShouldBeNil)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 3, frame.TypeRequestStream, 0)
+			})
+		})
+	})
+}
+
+func TestRequesterActiveStreams(t *testing.T) {
+	Convey("Given a requester with streams of different types in progress", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(8)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs).(*rSocketRequester)
+
+		go requester.RequestResponse(ctx, Text("hello"))
+
+		f, _ := requests.Recv(ctx)
+		checkFrameHeader(f, 1, frame.TypeRequestResponse, 0)
+
+		_, err := requester.RequestStream(ctx, Text("hello"))
+		So(err, ShouldBeNil)
+
+		f, _ = requests.Recv(ctx)
+		checkFrameHeader(f, 3, frame.TypeRequestStream, 0)
+
+		_, err = requester.RequestChannel(ctx, textStream(2))
+		So(err, ShouldBeNil)
+
+		f, _ = requests.Recv(ctx)
+		checkFrameHeader(f, 5, frame.TypeRequestChannel, 0)
+
+		Convey("When the stream received a payload", func() {
+			So(requester.HandleFrame(ctx, Text("world").buildPayloadFrame(3, false)), ShouldBeNil)
+
+			Convey("Then the active streams should be listed in the order of stream ID", func() {
+				streams := requester.ActiveStreams()
+
+				So(streams, ShouldHaveLength, 3)
+
+				So(streams[0].StreamID, ShouldEqual, 1)
+				So(streams[0].Type, ShouldEqual, frame.TypeRequestResponse)
+				So(streams[0].Credits, ShouldEqual, 1)
+				So(streams[0].Received, ShouldEqual, 0)
+
+				So(streams[1].StreamID, ShouldEqual, 3)
+				So(streams[1].Type, ShouldEqual, frame.TypeRequestStream)
+				So(streams[1].Credits, ShouldEqual, initReqs-1)
+				So(streams[1].Received, ShouldEqual, 1)
+
+				So(streams[2].StreamID, ShouldEqual, 5)
+				So(streams[2].Type, ShouldEqual, frame.TypeRequestChannel)
+				So(streams[2].Age, ShouldBeGreaterThanOrEqualTo, 0)
+			})
+		})
+
+		Convey("When the stream completed", func() {
+			So(requester.HandleFrame(ctx, buildCompleteFrame(3)), ShouldBeNil)
+
+			Convey("Then the stream should no longer be listed", func() {
+				for _, stream := range requester.ActiveStreams() {
+					So(stream.StreamID, ShouldNotEqual, 3)
+				}
+			})
+		})
+	})
+}
+
+func TestFrameOnFireAndForgetStream(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []RequesterOption
+		err  error
+	}{
+		{"lenient", nil, nil},
+		{"strict", []RequesterOption{WithStrictFireAndForget()}, ErrFireAndForgetResponded},
+	}
+
+	for _, c := range cases {
+		Convey("Given a "+c.name+" requester sent a FIRE_AND_FORGET request", t, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			requests := NewFrameChan(4)
+			requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, c.opts...).(*rSocketRequester)
+
+			So(requester.FireAndForget(ctx, Text("hello")), ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestFireAndForget, 0)
+
+			Convey("When the responder sends a PAYLOAD on the stream", func() {
+				var err error
+
+				So(func() {
+					err = requester.HandleFrame(ctx, Text("world").buildPayloadFrame(1, true))
+				}, ShouldNotPanic)
+
+				Convey("Then the frame should be ignored in lenient mode, or flagged in strict mode", func() {
+					So(err, ShouldEqual, c.err)
+
+					if c.err != nil {
+						f, _ := requests.Recv(ctx)
+						checkFrameHeader(f, 0, frame.TypeError, 0)
+						So(f.(*frame.ErrorFrame).Code, ShouldEqual, frame.ErrConnectionError)
+					} else {
+						So(requests.C, ShouldBeEmpty)
+					}
+				})
+			})
+
+			Convey("When the responder sends an ERROR on the stream", func() {
+				err := requester.HandleFrame(ctx, frame.NewErrorFrame(1, frame.ErrApplicationError, "oops"))
+
+				Convey("Then the frame should be handled the same", func() {
+					So(err, ShouldEqual, c.err)
+				})
+			})
+		})
+	}
+}
+
+func TestRequestOnConnectionClosedConcurrently(t *testing.T) {
+	Convey("Given a requester on a connection nobody receives from", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(0)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs)
+
+		Convey("When the connection closed while sending a request", func() {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+
+				requests.Close()
+			}()
+
+			var err error
+
+			So(func() { err = requester.FireAndForget(ctx, Text("hello")) }, ShouldNotPanic)
+
+			Convey("Then the request should fail with ErrClosed", func() {
+				So(err, ShouldEqual, ErrClosed)
+
+				Convey("And the following requests should fail with ErrClosed", func() {
+					_, err := requester.RequestResponse(ctx, Text("hello"))
+					So(err, ShouldEqual, ErrClosed)
+				})
+			})
+		})
+	})
+}
+
+func TestRequesterWithOptions(t *testing.T) {
+	Convey("Given a requester created without options", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequesterWithOptions(requests).(*rSocketRequester)
+
+		Convey("Then the defaults should be used", func() {
+			So(requester.Logger, ShouldNotBeNil)
+			So(requester.streamRequestLimit, ShouldEqual, DefaultInitialRequests)
+			So(requester.flowControl, ShouldResemble, &EagerStrategy{DefaultInitialRequests, 0})
+			So(requester.defaultTimeout, ShouldEqual, 0)
+
+			_, err := requester.RequestStream(ctx, Text("foo"))
+			So(err, ShouldBeNil)
+
+			f, _ := requests.Recv(ctx)
+			checkFrameHeader(f, 1, frame.TypeRequestStream, 0)
+			So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, DefaultInitialRequests)
+		})
+	})
+
+	Convey("Given a requester created with options", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequesterWithOptions(requests,
+			WithLogger(logger),
+			WithStreamIDs(ServerStreamIDs()),
+			WithInitialRequests(8),
+			WithDefaultTimeout(10*time.Millisecond),
+		).(*rSocketRequester)
+
+		Convey("When send a stream request", func() {
+			_, err := requester.RequestStream(ctx, Text("foo"))
+			So(err, ShouldBeNil)
+
+			Convey("Then the options should be applied", func() {
+				So(requester.Logger, ShouldEqual, logger)
+
+				f, _ := requests.Recv(ctx)
+				checkFrameHeader(f, 2, frame.TypeRequestStream, 0)
+				So(f.(*frame.RequestStreamFrame).InitialRequests, ShouldEqual, 8)
+			})
+		})
+
+		Convey("When send a request without deadline", func() {
+			_, err := requester.RequestResponse(context.Background(), Text("foo"))
+
+			Convey("Then the request should be timeout", func() {
+				So(err, ShouldResemble, context.DeadlineExceeded)
+			})
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package proto
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDMimeType is the MIME type of the composite metadata entry holds the request ID.
+const RequestIDMimeType = "message/x.rsocket.request-id.v0"
+
+// NewRequestID generates a random (version 4) UUID as the request ID.
+func NewRequestID() (string, error) {
+	var uuid [16]byte
+
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+
+	uuid[6] = uuid[6]&0x0F | 0x40
+	uuid[8] = uuid[8]&0x3F | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// RequestIDFromMetadata returns the request ID in the composite metadata.
+func RequestIDFromMetadata(metadata Metadata) (string, bool) {
+	id, ok := metadata.StringEntry(RequestIDMimeType)
+
+	return string(id), ok
+}
+
+// logRequestID logs the request ID in the metadata of payload for correlation if present.
+func logRequestID(logger *zap.Logger, msg string, streamID StreamID, payload *Payload) {
+	if !payload.HasMetadata || !logger.Core().Enabled(zap.DebugLevel) {
+		return
+	}
+
+	if id, ok := RequestIDFromMetadata(payload.Metadata); ok {
+		logger.Debug(msg, zap.Stringer("stream", streamID), zap.String("requestID", id))
+	}
+}
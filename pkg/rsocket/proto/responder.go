@@ -1,21 +1,31 @@
 package proto
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"go.uber.org/zap"
 )
 
 // Responder to handle requests on an RSocket connection.
 type Responder interface {
 	io.Closer
 
-	// Called when a new `requestResponse` occurs from an Requester.
-	HandleRequestResponse(streamID StreamID, payload *Payload) (*Result, error)
+	// Called when a new `requestResponse` occurs from an Requester,
+	// the ctx carries the stream ID and is cancelled once the requester cancels the request.
+	HandleRequestResponse(ctx context.Context, streamID StreamID, payload *Payload) (*Payload, error)
 
-	// Called when a new `requestStream` occurs from an Requester.
-	HandleRequestStream(streamID StreamID, payload *Payload) (*PayloadStream, error)
+	// Called when a new `requestStream` occurs from an Requester,
+	// the ctx carries the stream ID and is cancelled once the requester cancels the stream.
+	HandleRequestStream(ctx context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error)
 
-	// Called when a new `requestChannel` occurs from an RSocketRequester.
-	HandleRequestChannel(streamID StreamID, payloads *PayloadStream) (*PayloadStream, error)
+	// Called when a new `requestChannel` occurs from an RSocketRequester, the payloads of requester are received from payloads,
+	// the ctx carries the stream ID and is cancelled once both directions of the channel terminated.
+	HandleRequestChannel(ctx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error)
 
 	// Called when a new `fireAndForget` occurs from an RSocketRequester.
 	HandleFireAndForget(streamID StreamID, payload *Payload) error
@@ -23,3 +33,675 @@ type Responder interface {
 	// Called when a new `metadataPush` occurs from an RSocketRequester.
 	HandleMetadataPush(metadata Metadata) error
 }
+
+// defaultChannelRequests is the number of payloads requested from the requester of a channel in advance.
+const defaultChannelRequests = 32
+
+// maxRecentChannels is the number of channels stopped receiving remembered to drop the late payloads in flight.
+const maxRecentChannels = 1024
+
+// Responder Side of a RSocket. Dispatches the request [Frame]s to a [Responder].
+type rSocketResponder struct {
+	*zap.Logger
+	frameSender        FrameSender
+	handler            Responder
+	maxInitialRequests uint32
+	reassembler        *Reassembler
+	observer           streamObserver
+	senders            *sync.Map
+	receivers          *sync.Map      // The channels receiving payloads from the requester.
+	stoppedReceivers   *recentStreams // The latest channels stopped receiving, the payloads in flight are dropped.
+}
+
+var _ FrameHandler = (*rSocketResponder)(nil)
+
+// ResponderOption configures a Responder.
+type ResponderOption func(*rSocketResponder)
+
+// WithMaxInitialRequests caps the initial requests honored for a stream,
+// the payloads beyond the cap are held back until the requester grants more by REQUEST_N, which is not capped.
+func WithMaxInitialRequests(n uint32) ResponderOption {
+	return func(responder *rSocketResponder) {
+		responder.maxInitialRequests = n
+	}
+}
+
+// NewResponder creates a FrameHandler dispatches the requests to the Responder.
+func NewResponder(logger *zap.Logger, frameSender FrameSender, handler Responder, opts ...ResponderOption) FrameHandler {
+	responder := &rSocketResponder{
+		Logger:           logger,
+		frameSender:      frameSender,
+		handler:          handler,
+		reassembler:      NewReassembler(),
+		senders:          new(sync.Map),
+		receivers:        new(sync.Map),
+		stoppedReceivers: newRecentStreams(maxRecentChannels),
+	}
+
+	for _, opt := range opts {
+		opt(responder)
+	}
+
+	return responder
+}
+
+// Close cancels the streams in progress.
+func (responder *rSocketResponder) Close() error {
+	responder.senders.Range(func(streamID, sender interface{}) bool {
+		responder.senders.Delete(streamID)
+		sender.(*resultSender).Close()
+
+		return true
+	})
+
+	responder.receivers.Range(func(streamID, receiver interface{}) bool {
+		responder.receivers.Delete(streamID)
+		receiver.(*channelReceiver).Close()
+
+		return true
+	})
+
+	return nil
+}
+
+func (responder *rSocketResponder) findSender(streamID StreamID) (*resultSender, bool) {
+	sender, ok := responder.senders.Load(streamID)
+
+	if ok {
+		return sender.(*resultSender), true
+	}
+
+	return nil, false
+}
+
+func (responder *rSocketResponder) findReceiver(streamID StreamID) (*channelReceiver, bool) {
+	receiver, ok := responder.receivers.Load(streamID)
+
+	if ok {
+		return receiver.(*channelReceiver), true
+	}
+
+	return nil, false
+}
+
+// inProgress reports whether the stream is sending or receiving payloads.
+func (responder *rSocketResponder) inProgress(streamID StreamID) bool {
+	if _, ok := responder.findSender(streamID); ok {
+		return true
+	}
+
+	_, ok := responder.findReceiver(streamID)
+
+	return ok
+}
+
+// removeReceiver stops the channel receiving payloads, and remembers it to drop the payloads sent before the requester knows.
+func (responder *rSocketResponder) removeReceiver(streamID StreamID) (*channelReceiver, bool) {
+	receiver, ok := responder.receivers.LoadAndDelete(streamID)
+
+	if !ok {
+		return nil, false
+	}
+
+	responder.stoppedReceivers.Add(streamID)
+
+	return receiver.(*channelReceiver), true
+}
+
+func (responder *rSocketResponder) HandleFrame(ctx context.Context, f frame.Frame) error {
+	streamID := f.StreamID()
+
+	responder.Debug("handle frame",
+		zap.Uint32("stream", uint32(streamID)),
+		zap.Stringer("type", f.Type()),
+		zap.Uint16("flags", uint16(f.Flags())))
+
+	received := f
+
+	defer func() {
+		// The frame is released once handled, unless its payload buffered for the handler.
+		if received != nil {
+			frame.Release(received)
+		}
+	}()
+
+	if f.Type() == frame.TypePayload && !responder.reassembler.InProgress(streamID) {
+		if !responder.inProgress(streamID) && !responder.stoppedReceivers.Contains(streamID) {
+			// The request never starts with a PAYLOAD frame, it must follow a fragment of request.
+			return ErrUnexpectedFragment
+		}
+	}
+
+	f, err := responder.reassembler.Reassemble(f)
+
+	if f == nil || err != nil {
+		return err
+	}
+
+	switch f := f.(type) {
+	case *frame.RequestResponseFrame:
+		if responder.inProgress(streamID) {
+			// Receiving a Request frame on a Stream ID that is already in use MUST be ignored.
+			return nil
+		}
+
+		return responder.handleRequestResponse(ctx, f)
+
+	case *frame.RequestStreamFrame:
+		if responder.inProgress(streamID) {
+			// Receiving a Request frame on a Stream ID that is already in use MUST be ignored.
+			return nil
+		}
+
+		return responder.handleRequestStream(ctx, f)
+
+	case *frame.RequestChannelFrame:
+		if responder.inProgress(streamID) {
+			// Receiving a Request frame on a Stream ID that is already in use MUST be ignored.
+			return nil
+		}
+
+		return responder.handleRequestChannel(ctx, f)
+
+	case *frame.RequestFireAndForgetFrame:
+		payload := &Payload{HasMetadata: f.HasMetadata(), Metadata: f.Metadata, Data: f.Data}
+
+		logRequestID(responder.Logger, "handle request", streamID, payload)
+
+		if err := responder.fireAndForget(streamID, payload); err != nil {
+			// FIRE_AND_FORGET has no response, the error is only reported to the log.
+			responder.Warn("handle fire and forget failed", zap.Uint32("stream", uint32(streamID)), zap.Error(err))
+		}
+
+	case *frame.PayloadFrame:
+		receiver, ok := responder.findReceiver(streamID)
+
+		if !ok {
+			// The requester completed or the handler cancelled the payloads of channel, the late payloads are dropped.
+			return nil
+		}
+
+		if f.Next() {
+			result := Ok(&Payload{HasMetadata: f.HasMetadata(), Metadata: f.Metadata, Data: f.Data})
+
+			// The buffer of frame is held until the payload consumed.
+			result.source, received = received, nil
+
+			if !receiver.Send(result) {
+				result.release()
+
+				responder.Warn("payloads exceed the requested credit", zap.Uint32("stream", uint32(streamID)))
+
+				if err := responder.sendError(ctx, 0, ErrCreditExceeded); err != nil {
+					return err
+				}
+
+				return ErrCreditExceeded
+			}
+		}
+
+		if f.Complete() {
+			// The requester completed its payloads, the handler keeps sending until it completes too.
+			responder.removeReceiver(streamID)
+			receiver.Close()
+		}
+
+	case *frame.ErrorFrame:
+		// The ERROR frame of requester terminates the channel in both directions.
+		if receiver, ok := responder.removeReceiver(streamID); ok {
+			receiver.Send(Err(f.Error))
+			receiver.Close()
+		}
+
+		if sender, ok := responder.senders.LoadAndDelete(streamID); ok {
+			sender.(*resultSender).Close()
+		}
+
+	case *frame.RequestNFrame:
+		if sender, ok := responder.findSender(streamID); ok {
+			sender.Requests(f.N)
+		}
+
+	case *frame.CancelFrame:
+		if sender, ok := responder.findSender(streamID); ok {
+			responder.senders.Delete(streamID)
+			sender.Close()
+		}
+
+	case *frame.MetadataPushFrame:
+		if err := responder.metadataPush(f.Metadata); err != nil {
+			// METADATA_PUSH has no response, the error is only reported to the log.
+			responder.Warn("handle metadata push failed", zap.Error(err))
+		}
+
+	default:
+		return fmt.Errorf("Server received unsupported %s frame on stream (%d)", f, streamID)
+	}
+
+	return nil
+}
+
+func (responder *rSocketResponder) handleRequestResponse(ctx context.Context, request *frame.RequestResponseFrame) error {
+	streamID := request.StreamID()
+	payload := &Payload{
+		HasMetadata: request.HasMetadata(),
+		Metadata:    request.Metadata,
+		Data:        request.Data,
+	}
+
+	logRequestID(responder.Logger, "handle request", streamID, payload)
+
+	responder.observer.started(streamID, frame.TypeRequestResponse, payload)
+
+	// The sender tracks the request in progress, a CANCEL frame cancels the context of handler.
+	sender := newResultSender(ctx, 0, 0)
+
+	responder.senders.Store(streamID, sender)
+
+	go responder.sendResponse(streamID, sender, payload)
+
+	return nil
+}
+
+// requestResponse calls the handler, the panic of handler fails the request with APPLICATION_ERROR.
+func (responder *rSocketResponder) requestResponse(ctx context.Context, streamID StreamID, request *Payload) (payload *Payload, err error) {
+	defer responder.recoverPanic(streamID, &err)
+
+	return responder.handler.HandleRequestResponse(ctx, streamID, request)
+}
+
+// sendResponse sends the response of handler with a PAYLOAD frame completes the stream, or an ERROR frame if it failed,
+// the response is dropped if the requester cancelled the request.
+func (responder *rSocketResponder) sendResponse(streamID StreamID, sender *resultSender, request *Payload) (err error) {
+	defer sender.Close()
+	defer responder.senders.Delete(streamID)
+
+	ctx := sender.ctx
+
+	payload, reason := responder.requestResponse(ContextWithStreamID(ctx, streamID), streamID, request)
+
+	defer func() {
+		if ctx.Err() != nil {
+			reason = ctx.Err()
+		} else if reason == nil {
+			reason = err
+		}
+
+		responder.observer.terminated(streamID, reason)
+	}()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	} else if reason != nil {
+		return responder.sendError(ctx, streamID, reason)
+	} else if payload == nil {
+		return responder.sendFrame(ctx, buildCompleteFrame(streamID))
+	}
+
+	if err := responder.sendFrame(ctx, payload.buildPayloadFrame(streamID, true)); err != nil {
+		return err
+	}
+
+	responder.observer.next(streamID, payload)
+
+	return nil
+}
+
+func (responder *rSocketResponder) handleRequestStream(ctx context.Context, request *frame.RequestStreamFrame) error {
+	streamID := request.StreamID()
+	payload := &Payload{
+		HasMetadata: request.HasMetadata(),
+		Metadata:    request.Metadata,
+		Data:        request.Data,
+	}
+
+	logRequestID(responder.Logger, "handle request", streamID, payload)
+
+	responder.observer.started(streamID, frame.TypeRequestStream, payload)
+
+	// The initial requests seed the credit of stream, a CANCEL frame cancels the context of handler.
+	sender := newResultSender(ctx, request.InitialRequests, responder.maxInitialRequests)
+
+	payloads, err := responder.requestStream(ContextWithStreamID(sender.ctx, streamID), streamID, payload)
+
+	if err != nil {
+		sender.Close()
+
+		responder.observer.terminated(streamID, err)
+
+		return responder.sendError(ctx, streamID, err)
+	}
+
+	payloads.bind(streamID)
+
+	responder.senders.Store(streamID, sender)
+
+	go responder.sendPayloads(streamID, sender, payloads)
+
+	return nil
+}
+
+// requestStream calls the handler, the panic of handler fails the stream with APPLICATION_ERROR.
+func (responder *rSocketResponder) requestStream(ctx context.Context, streamID StreamID, payload *Payload) (payloads *PayloadStream, err error) {
+	defer responder.recoverPanic(streamID, &err)
+
+	return responder.handler.HandleRequestStream(ctx, streamID, payload)
+}
+
+func (responder *rSocketResponder) handleRequestChannel(ctx context.Context, request *frame.RequestChannelFrame) error {
+	streamID := request.StreamID()
+	payload := &Payload{
+		HasMetadata: request.HasMetadata(),
+		Metadata:    request.Metadata,
+		Data:        request.Data,
+	}
+
+	// The REQUEST_CHANNEL frame without data and metadata carries no payload.
+	hasPayload := len(payload.Data) > 0 || payload.HasMetadata
+
+	logRequestID(responder.Logger, "handle request", streamID, payload)
+
+	responder.observer.started(streamID, frame.TypeRequestChannel, payload)
+
+	// The context is cancelled once both directions of the channel terminated.
+	channelCtx, cancel := context.WithCancel(ctx)
+
+	receiver := newChannelReceiver(defaultChannelRequests)
+
+	if hasPayload {
+		receiver.Send(Ok(payload))
+	}
+
+	if request.Complete() {
+		receiver.Close()
+	} else {
+		responder.receivers.Store(streamID, receiver)
+	}
+
+	inbound, sink := NewPayloadPipe(0)
+	inbound.bind(streamID)
+
+	// The initial requests seed the credit of the payloads sent by the handler.
+	sender := newResultSender(channelCtx, request.InitialRequests, responder.maxInitialRequests)
+
+	pending := int32(2)
+	release := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			cancel()
+		}
+	}
+
+	// The payloads of requester are delivered before the handler returns, which may receive them in place.
+	go func() {
+		defer release()
+
+		responder.deliverPayloads(channelCtx, streamID, receiver, sink)
+	}()
+
+	payloads, err := responder.requestChannel(ContextWithStreamID(channelCtx, streamID), streamID, inbound)
+
+	if err != nil {
+		responder.removeReceiver(streamID)
+		receiver.Close()
+		cancel()
+
+		responder.observer.terminated(streamID, err)
+
+		return responder.sendError(ctx, streamID, err)
+	}
+
+	payloads.bind(streamID)
+
+	responder.senders.Store(streamID, sender)
+
+	if !request.Complete() {
+		n := uint32(defaultChannelRequests)
+
+		if hasPayload {
+			n-- // The payload of REQUEST_CHANNEL frame is the first one requested.
+		}
+
+		if err := responder.sendFrame(ctx, frame.NewRequestNFrame(streamID, n)); err != nil {
+			responder.removeReceiver(streamID)
+			responder.senders.Delete(streamID)
+			receiver.Close()
+			cancel()
+
+			return err
+		}
+	}
+
+	failed := make(chan error, 1)
+
+	payloads.OnClose(func(err error) {
+		if err != nil && sender.ctx.Err() == nil {
+			failed <- err
+		}
+	})
+
+	go func() {
+		defer release()
+
+		responder.sendPayloads(streamID, sender, payloads)
+
+		select {
+		case <-failed:
+			// The ERROR frame sent for the handler terminates the channel in both directions.
+			if _, ok := responder.removeReceiver(streamID); ok {
+				receiver.Close()
+			}
+
+			cancel()
+		default:
+		}
+	}()
+
+	return nil
+}
+
+// requestChannel calls the handler, the panic of handler fails the channel with APPLICATION_ERROR.
+func (responder *rSocketResponder) requestChannel(ctx context.Context, streamID StreamID, payloads *PayloadStream) (stream *PayloadStream, err error) {
+	defer responder.recoverPanic(streamID, &err)
+
+	return responder.handler.HandleRequestChannel(ctx, streamID, payloads)
+}
+
+// deliverPayloads delivers the payloads of requester to the handler of channel,
+// and requests more payloads once the handler consumed half of the payloads requested in advance.
+func (responder *rSocketResponder) deliverPayloads(ctx context.Context, streamID StreamID, receiver *channelReceiver, sink *PayloadSink) {
+	defer sink.Close()
+	defer receiver.discard()
+
+	var consumed uint32
+
+	for {
+		var result *Result
+		var ok bool
+
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok = <-receiver.C:
+			if !ok {
+				return
+			}
+		}
+
+		if err := sink.Send(ctx, result); err != nil {
+			result.release()
+
+			if ctx.Err() == nil {
+				// The handler cancelled the payloads of requester, the requester stops sending.
+				if _, ok := responder.removeReceiver(streamID); ok {
+					receiver.Close()
+
+					if err := responder.sendFrame(ctx, frame.NewCancelFrame(streamID)); err != nil {
+						responder.Warn("cancel channel failed", zap.Uint32("stream", uint32(streamID)), zap.Error(err))
+					}
+				}
+			}
+
+			return
+		}
+
+		if result.Payload == nil {
+			continue
+		}
+
+		if consumed++; consumed >= defaultChannelRequests/2 {
+			if _, ok := responder.findReceiver(streamID); ok {
+				if err := responder.sendFrame(ctx, frame.NewRequestNFrame(streamID, consumed)); err != nil {
+					responder.Warn("request channel payloads failed", zap.Uint32("stream", uint32(streamID)), zap.Error(err))
+				}
+			}
+
+			consumed = 0
+		}
+	}
+}
+
+// fireAndForget calls the handler, the panic of handler is reported as an error.
+func (responder *rSocketResponder) fireAndForget(streamID StreamID, payload *Payload) (err error) {
+	defer responder.recoverPanic(streamID, &err)
+
+	return responder.handler.HandleFireAndForget(streamID, payload)
+}
+
+// metadataPush calls the handler, the panic of handler is reported as an error.
+func (responder *rSocketResponder) metadataPush(metadata Metadata) (err error) {
+	defer responder.recoverPanic(0, &err)
+
+	return responder.handler.HandleMetadataPush(metadata)
+}
+
+// recoverPanic recovers the panic of handler, which never crashes the connection or the other streams.
+func (responder *rSocketResponder) recoverPanic(streamID StreamID, err *error) {
+	if r := recover(); r != nil {
+		responder.Error("handler panic", zap.Stringer("stream", streamID), zap.Any("panic", r), zap.Stack("stack"))
+
+		*err = frame.ErrApplicationError.WithMessage(fmt.Sprintf("handler panic: %v", r))
+	}
+}
+
+// sendPayloads sends the payloads of handler as the requester grants the credit,
+// the handler's stream is consumed at most one payload ahead of the credit.
+func (responder *rSocketResponder) sendPayloads(streamID StreamID, sender *resultSender, payloads *PayloadStream) (err error) {
+	defer sender.Close()
+	defer responder.senders.Delete(streamID)
+
+	ctx := sender.ctx
+
+	var reason error // The error terminates the stream, or nil if completed.
+
+	defer func() {
+		if ctx.Err() != nil {
+			reason = ctx.Err()
+		} else if reason == nil {
+			reason = err
+		}
+
+		responder.observer.terminated(streamID, reason)
+	}()
+
+	defer func() {
+		if ctx.Err() != nil {
+			// The stream is cancelled by the requester, stops the handler sending payloads.
+			payloads.Cancel()
+		}
+	}()
+
+	for {
+		payload, err := payloads.Recv(ctx)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			reason = err
+
+			return responder.sendError(ctx, streamID, err)
+		} else if payload == nil {
+			return responder.sendFrame(ctx, buildCompleteFrame(streamID))
+		}
+
+		if err := sender.Acquire(ctx); err != nil {
+			return err
+		}
+
+		if err := responder.sendFrame(ctx, payload.buildPayloadFrame(streamID, false)); err != nil {
+			return err
+		}
+
+		responder.observer.next(streamID, payload)
+	}
+}
+
+func (responder *rSocketResponder) sendFrame(ctx context.Context, frame frame.Frame) error {
+	responder.Debug("send frame",
+		zap.Stringer("stream", frame.StreamID()),
+		zap.Stringer("type", frame.Type()),
+		zap.Reflect("frame", frame))
+
+	return responder.frameSender.Send(ctx, frame)
+}
+
+func (responder *rSocketResponder) sendError(ctx context.Context, streamID StreamID, err error) error {
+	return responder.sendFrame(ctx, buildErrorFrame(streamID, err))
+}
+
+// channelReceiver buffers the payloads of requester for the handler of channel,
+// the requester never sends more payloads than requested, which always fit in the buffer.
+type channelReceiver struct {
+	C chan *Result
+
+	lock   sync.Mutex
+	closed bool
+}
+
+func newChannelReceiver(requests uint32) *channelReceiver {
+	// One more for the error terminates the channel.
+	return &channelReceiver{C: make(chan *Result, requests+1)}
+}
+
+// Send buffers the result, returns false if the buffer is full or the receiver closed.
+func (receiver *channelReceiver) Send(result *Result) bool {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	if receiver.closed {
+		return false
+	}
+
+	select {
+	case receiver.C <- result:
+		return true
+	default:
+		return false
+	}
+}
+
+// discard releases the results buffered but not delivered, once the handler gone.
+func (receiver *channelReceiver) discard() {
+	for {
+		select {
+		case result, ok := <-receiver.C:
+			if !ok {
+				return
+			}
+
+			result.release()
+		default:
+			return
+		}
+	}
+}
+
+// Close the receiver, the results buffered are still delivered.
+func (receiver *channelReceiver) Close() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+
+	if !receiver.closed {
+		receiver.closed = true
+		close(receiver.C)
+	}
+}
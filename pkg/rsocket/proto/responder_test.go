@@ -0,0 +1,783 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errNotImplemented = errors.New("not implemented")
+
+type testResponder struct {
+	requestResponse func(ctx context.Context, streamID StreamID, payload *Payload) (*Payload, error)
+	requestStream   func(ctx context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error)
+	requestChannel  func(ctx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error)
+	fireAndForget   func(streamID StreamID, payload *Payload) error
+	metadataPush    func(metadata Metadata) error
+}
+
+var _ Responder = (*testResponder)(nil)
+
+func (responder *testResponder) Close() error {
+	return nil
+}
+
+func (responder *testResponder) HandleRequestResponse(ctx context.Context, streamID StreamID, payload *Payload) (*Payload, error) {
+	if responder.requestResponse == nil {
+		return nil, errNotImplemented
+	}
+
+	return responder.requestResponse(ctx, streamID, payload)
+}
+
+func (responder *testResponder) HandleRequestStream(ctx context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+	if responder.requestStream == nil {
+		return nil, errNotImplemented
+	}
+
+	return responder.requestStream(ctx, streamID, payload)
+}
+
+func (responder *testResponder) HandleRequestChannel(ctx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error) {
+	if responder.requestChannel == nil {
+		return nil, errNotImplemented
+	}
+
+	return responder.requestChannel(ctx, streamID, payloads)
+}
+
+func (responder *testResponder) HandleFireAndForget(streamID StreamID, payload *Payload) error {
+	if responder.fireAndForget == nil {
+		return errNotImplemented
+	}
+
+	return responder.fireAndForget(streamID, payload)
+}
+
+func (responder *testResponder) HandleMetadataPush(metadata Metadata) error {
+	if responder.metadataPush == nil {
+		return errNotImplemented
+	}
+
+	return responder.metadataPush(metadata)
+}
+
+func textStream(n int) *PayloadStream {
+	c := make(chan *Result, n)
+
+	for i := 0; i < n; i++ {
+		c <- Ok(Text(fmt.Sprintf("item-%d", i)))
+	}
+
+	close(c)
+
+	return &PayloadStream{C: c}
+}
+
+func shouldBeIdle(c *FrameChan) {
+	select {
+	case f := <-c.C:
+		So(f, ShouldBeNil)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD+COMPLETE
+func TestResponderRequestResponse(t *testing.T) {
+	Convey("Given a responder handler echoes the request", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses := NewFrameChan(1)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestResponse: func(ctx context.Context, streamID StreamID, payload *Payload) (*Payload, error) {
+				if payload.Text() == "boom" {
+					return nil, errors.New("boom")
+				}
+
+				if id, ok := StreamIDFromContext(ctx); !ok || id != streamID {
+					return nil, frame.ErrInvalid.WithMessage("stream ID not in context")
+				}
+
+				return Text("echo: " + payload.Text()), nil
+			},
+		})
+
+		Convey("When a client sends a request", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestResponseFrame(1, false, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then the response should complete the stream", func() {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext|frame.FlagComplete)
+				So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte("echo: hello"))
+			})
+		})
+
+		Convey("When the handler fails the request", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestResponseFrame(1, false, false, nil, []byte("boom"))), ShouldBeNil)
+
+			Convey("Then the error should be sent as APPLICATION_ERROR", func() {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeError, 0)
+				So(f.(*frame.ErrorFrame).Err(), ShouldResemble, frame.ErrApplicationError.WithMessage("boom"))
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_RESPONSE
+// RQ -> RS: CANCEL
+func TestResponderCancelsRequestResponse(t *testing.T) {
+	Convey("Given a responder handler waits until cancelled", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		cancelled := make(chan error, 1)
+
+		responses := NewFrameChan(1)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestResponse: func(ctx context.Context, streamID StreamID, payload *Payload) (*Payload, error) {
+				<-ctx.Done()
+
+				cancelled <- ctx.Err()
+
+				return Text("late"), nil
+			},
+		})
+
+		Convey("When the requester cancels the request in progress", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestResponseFrame(1, false, false, nil, []byte("hello"))), ShouldBeNil)
+			So(responder.HandleFrame(ctx, frame.NewCancelFrame(1)), ShouldBeNil)
+
+			Convey("Then the context of handler should be cancelled", func() {
+				So(<-cancelled, ShouldEqual, context.Canceled)
+
+				Convey("And the response should be dropped", func() {
+					shouldBeIdle(responses)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL[8]
+// RS -> RQ: REQUEST_N
+// RS -> RQ: PAYLOAD*
+// RQ -> RS: PAYLOAD*, COMPLETE
+// RS -> RQ: PAYLOAD*
+// RS -> RQ: PAYLOAD*, COMPLETE
+func TestResponderRequestChannel(t *testing.T) {
+	Convey("Given a responder handler echoes the payloads of channel", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses := NewFrameChan(8)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestChannel: func(streamCtx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error) {
+				stream, sink := NewPayloadPipe(0)
+
+				go func() {
+					defer sink.Close()
+
+					payloads.ForEach(streamCtx, func(payload *Payload) error {
+						return sink.Send(streamCtx, Ok(Text("echo: "+payload.Text())))
+					})
+
+					// The handler keeps sending once the requester completed.
+					sink.Send(streamCtx, Ok(Text("bye")))
+				}()
+
+				return stream, nil
+			},
+		})
+
+		Convey("When a client opens a channel with the first payload", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestChannelFrame(1, false, false, 8, false, nil, []byte("a"))), ShouldBeNil)
+
+			Convey("Then the responder should request more payloads and echo the first one", func() {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+				So(f.(*frame.RequestNFrame).N, ShouldEqual, defaultChannelRequests-1)
+
+				f, err = responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+				So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte("echo: a"))
+
+				Convey("And the handler should complete after the requester completed", func() {
+					So(responder.HandleFrame(ctx, frame.NewPayloadFrame(1, false, true, true, false, nil, []byte("b"))), ShouldBeNil)
+
+					f, err := responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte("echo: b"))
+
+					f, err = responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte("bye"))
+
+					f, err = responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 1, frame.TypePayload, frame.FlagComplete)
+
+					shouldBeIdle(responses)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL[2], COMPLETE
+// RS -> RQ: PAYLOAD*[2]
+// RQ -> RS: REQUEST_N[3]
+// RS -> RQ: PAYLOAD*[3], COMPLETE
+func TestResponderRequestChannelInitialRequests(t *testing.T) {
+	Convey("Given a responder handler produces 5 payloads for a channel", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		completed := make(chan bool, 1)
+
+		responses := NewFrameChan(8)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestChannel: func(streamCtx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error) {
+				payload, err := payloads.Recv(streamCtx)
+
+				completed <- payload == nil && err == nil
+
+				return textStream(5), nil
+			},
+		})
+
+		Convey("When a client opens a completed channel with 2 initial requests", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestChannelFrame(1, false, true, 2, false, nil, nil)), ShouldBeNil)
+
+			Convey("Then the handler should see the payloads of requester completed", func() {
+				So(<-completed, ShouldBeTrue)
+
+				Convey("And only 2 payloads should be sent", func() {
+					for i := 0; i < 2; i++ {
+						f, err := responses.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+					}
+
+					shouldBeIdle(responses)
+
+					Convey("And the rest should be sent after REQUEST_N", func() {
+						So(responder.HandleFrame(ctx, frame.NewRequestNFrame(1, 3)), ShouldBeNil)
+
+						for i := 2; i < 5; i++ {
+							f, err := responses.Recv(ctx)
+
+							So(err, ShouldBeNil)
+							So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte(fmt.Sprintf("item-%d", i)))
+						}
+
+						f, err := responses.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						checkFrameHeader(f, 1, frame.TypePayload, frame.FlagComplete)
+					})
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_CHANNEL
+// RS -> RQ: REQUEST_N
+// RQ -> RS: CANCEL
+// RQ -> RS: PAYLOAD*
+// RQ -> RS: ERROR
+func TestResponderRequestChannelTermination(t *testing.T) {
+	Convey("Given a responder handler collects the payloads of channel", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := make(chan *Result, 4)
+		outbound := make(chan *Result)
+
+		responses := NewFrameChan(8)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestChannel: func(streamCtx context.Context, streamID StreamID, payloads *PayloadStream) (*PayloadStream, error) {
+				go func() {
+					for result := range payloads.C {
+						received <- result
+					}
+
+					close(received)
+				}()
+
+				return &PayloadStream{C: outbound}, nil
+			},
+		})
+
+		So(responder.HandleFrame(ctx, frame.NewRequestChannelFrame(1, false, false, 8, false, nil, nil)), ShouldBeNil)
+
+		f, err := responses.Recv(ctx)
+		So(err, ShouldBeNil)
+		checkFrameHeader(f, 1, frame.TypeRequestN, 0)
+		So(f.(*frame.RequestNFrame).N, ShouldEqual, defaultChannelRequests)
+
+		Convey("When the requester cancels the payloads of handler", func() {
+			So(responder.HandleFrame(ctx, frame.NewCancelFrame(1)), ShouldBeNil)
+
+			Convey("Then the payloads of requester should still be delivered", func() {
+				So(responder.HandleFrame(ctx, frame.NewPayloadFrame(1, false, false, true, false, nil, []byte("a"))), ShouldBeNil)
+
+				result := <-received
+				So(result.Payload.Text(), ShouldEqual, "a")
+
+				Convey("And the ERROR of requester should terminate the channel", func() {
+					So(responder.HandleFrame(ctx, frame.NewErrorFrame(1, frame.ErrApplicationError, "failed")), ShouldBeNil)
+
+					result := <-received
+					So(result.Err, ShouldResemble, frame.ErrApplicationError.WithMessage("failed"))
+
+					_, ok := <-received
+					So(ok, ShouldBeFalse)
+
+					shouldBeIdle(responses)
+				})
+			})
+		})
+
+		Convey("When the handler fails while the payloads of requester in flight", func() {
+			outbound <- Err(frame.ErrApplicationError.WithMessage("failed"))
+
+			f, err := responses.Recv(ctx)
+			So(err, ShouldBeNil)
+			checkFrameHeader(f, 1, frame.TypeError, 0)
+
+			_, ok := <-received
+			So(ok, ShouldBeFalse)
+
+			Convey("Then the late payloads should be dropped without tearing down the connection", func() {
+				So(responder.HandleFrame(ctx, frame.NewPayloadFrame(1, false, false, true, false, nil, []byte("late"))), ShouldBeNil)
+
+				shouldBeIdle(responses)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM[1000000000]
+// RS -> RQ: PAYLOAD*[max]
+// RQ -> RS: REQUEST_N
+// RS -> RQ: PAYLOAD*
+// RS -> RQ: COMPLETE
+func TestResponderCapsInitialRequests(t *testing.T) {
+	Convey("Given a responder caps the initial requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		const maxInitialRequests = 8
+
+		responses := NewFrameChan(32)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				return textStream(maxInitialRequests * 4), nil
+			},
+		}, WithMaxInitialRequests(maxInitialRequests))
+
+		Convey("When a client requests a billion payloads", func() {
+			err := responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 1000*1000*1000, false, nil, []byte("hello")))
+			So(err, ShouldBeNil)
+
+			Convey("Then the payloads should be capped to the maximum", func() {
+				for i := 0; i < maxInitialRequests; i++ {
+					f, err := responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+					So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte(fmt.Sprintf("item-%d", i)))
+				}
+
+				shouldBeIdle(responses)
+
+				Convey("Then the remaining payloads should be sent after more requests", func() {
+					So(responder.HandleFrame(ctx, frame.NewRequestNFrame(1, 2)), ShouldBeNil)
+
+					for i := maxInitialRequests; i < maxInitialRequests+2; i++ {
+						f, err := responses.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+						So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte(fmt.Sprintf("item-%d", i)))
+					}
+
+					shouldBeIdle(responses)
+				})
+
+				Convey("Then the later requests beyond the maximum should not be capped", func() {
+					So(responder.HandleFrame(ctx, frame.NewRequestNFrame(1, maxInitialRequests*3)), ShouldBeNil)
+
+					for i := maxInitialRequests; i < maxInitialRequests*4; i++ {
+						f, err := responses.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+						So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte(fmt.Sprintf("item-%d", i)))
+					}
+
+					f, err := responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 1, frame.TypePayload, frame.FlagComplete)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM[1]
+// RS -> RQ: PAYLOAD
+// RQ -> RS: CANCEL
+func TestResponderStopsSinkOnCancel(t *testing.T) {
+	Convey("Given a responder streams payloads until cancelled", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		sent := make(chan error, 1)
+		sinks := make(chan *PayloadSink, 1)
+
+		responses := NewFrameChan(4)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				stream, sink := NewPayloadPipe(0)
+
+				go func() {
+					for i := 0; ; i++ {
+						if err := sink.Send(ctx, Ok(Text(fmt.Sprintf("item-%d", i)))); err != nil {
+							sinks <- sink
+							sent <- err
+
+							return
+						}
+					}
+				}()
+
+				return stream, nil
+			},
+		})
+
+		Convey("When the requester cancels the stream", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 1, false, nil, []byte("hello"))), ShouldBeNil)
+
+			f, err := responses.Recv(ctx)
+			So(err, ShouldBeNil)
+			checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+
+			So(responder.HandleFrame(ctx, frame.NewCancelFrame(1)), ShouldBeNil)
+
+			Convey("Then the pending send should return the context error", func() {
+				So(<-sent, ShouldEqual, context.Canceled)
+
+				sink := <-sinks
+
+				Convey("And the sink should stop accepting payloads", func() {
+					So(sink.Send(ctx, Ok(Text("late"))), ShouldEqual, context.Canceled)
+					So(sink.Close(), ShouldBeNil)
+
+					shouldBeIdle(responses)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM[2]
+// RS -> RQ: PAYLOAD*[2]
+// RQ -> RS: CANCEL
+func TestResponderCancelsHandlerContext(t *testing.T) {
+	Convey("Given a responder handler produces payloads until its context cancelled", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		stopped := make(chan error, 1)
+
+		responses := NewFrameChan(4)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(streamCtx context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				c := make(chan *Result)
+
+				go func() {
+					for i := 0; ; i++ {
+						select {
+						case <-streamCtx.Done():
+							stopped <- streamCtx.Err()
+
+							return
+						case c <- Ok(Text(fmt.Sprintf("item-%d", i))):
+						}
+					}
+				}()
+
+				return &PayloadStream{C: c}, nil
+			},
+		})
+
+		Convey("When the requester cancels the stream after the initial requests", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 2, false, nil, []byte("hello"))), ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+			}
+
+			shouldBeIdle(responses)
+
+			So(responder.HandleFrame(ctx, frame.NewCancelFrame(1)), ShouldBeNil)
+
+			Convey("Then the handler should stop producing payloads", func() {
+				So(<-stopped, ShouldEqual, context.Canceled)
+
+				shouldBeIdle(responses)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM[10]
+// RS -> RQ: PAYLOAD*[10]
+// RQ -> RS: REQUEST_N[5]
+// RS -> RQ: PAYLOAD*[5]
+func TestResponderPacesHandlerStream(t *testing.T) {
+	Convey("Given a responder handler produces 100 payloads", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var produced int32
+
+		responses := NewFrameChan(128)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				stream, sink := NewPayloadPipe(0)
+
+				go func() {
+					defer sink.Close()
+
+					for i := 0; i < 100; i++ {
+						if err := sink.Send(ctx, Ok(Text(fmt.Sprintf("item-%d", i)))); err != nil {
+							return
+						}
+
+						atomic.AddInt32(&produced, 1)
+					}
+				}()
+
+				return stream, nil
+			},
+		})
+
+		Convey("When a client requests 10 payloads up front", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 10, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then only 10 payloads should be sent", func() {
+				for i := 0; i < 10; i++ {
+					f, err := responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 1, frame.TypePayload, frame.FlagNext)
+				}
+
+				shouldBeIdle(responses)
+
+				// The responder holds at most one payload waiting for the credit.
+				So(atomic.LoadInt32(&produced), ShouldBeLessThanOrEqualTo, 11)
+
+				Convey("And more payloads should be sent after REQUEST_N", func() {
+					So(responder.HandleFrame(ctx, frame.NewRequestNFrame(1, 5)), ShouldBeNil)
+
+					for i := 10; i < 15; i++ {
+						f, err := responses.Recv(ctx)
+
+						So(err, ShouldBeNil)
+						So(f.(*frame.PayloadFrame).Data, ShouldResemble, []byte(fmt.Sprintf("item-%d", i)))
+					}
+
+					shouldBeIdle(responses)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM[1]
+// RQ -> RS: REQUEST_STREAM[3]
+// RS -> RQ: ERROR[APPLICATION_ERROR] on stream 1
+// RS -> RQ: PAYLOAD*, COMPLETE on stream 3
+func TestResponderRecoversHandlerPanic(t *testing.T) {
+	Convey("Given a responder handler panics for some requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses := NewFrameChan(4)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				if payload.Text() == "boom" {
+					panic("boom")
+				}
+
+				return textStream(1), nil
+			},
+		})
+
+		Convey("When the requests are sent on the concurrent streams", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, 8, false, nil, []byte("boom"))), ShouldBeNil)
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(3, false, 8, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then the panic should fail its stream with APPLICATION_ERROR", func() {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeError, 0)
+				So(f.(*frame.ErrorFrame).Err(), ShouldResemble, frame.ErrApplicationError.WithMessage("handler panic: boom"))
+
+				Convey("And the other stream should be unaffected", func() {
+					f, err := responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 3, frame.TypePayload, frame.FlagNext)
+
+					f, err = responses.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					checkFrameHeader(f, 3, frame.TypePayload, frame.FlagComplete)
+				})
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_FNF[1]
+// RQ -> RS: REQUEST_FNF[3]
+func TestResponderFireAndForget(t *testing.T) {
+	Convey("Given a responder handler panics for some fire and forget requests", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := make(chan string, 2)
+		responses := NewFrameChan(1)
+		responder := NewResponder(logger, responses, &testResponder{
+			fireAndForget: func(streamID StreamID, payload *Payload) error {
+				if payload.Text() == "boom" {
+					panic("boom")
+				}
+
+				received <- payload.Text()
+
+				return nil
+			},
+		})
+
+		Convey("When the requests are received", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestFireAndForgetFrame(1, false, false, nil, []byte("boom"))), ShouldBeNil)
+			So(responder.HandleFrame(ctx, frame.NewRequestFireAndForgetFrame(3, false, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then the handler should receive the payload without response", func() {
+				So(<-received, ShouldEqual, "hello")
+
+				shouldBeIdle(responses)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: ERROR[APPLICATION_ERROR]
+func TestResponderMapsErrors(t *testing.T) {
+	Convey("Given a responder handler fails with a plain error", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		responses := NewFrameChan(1)
+		responder := NewResponder(logger, responses, &testResponder{
+			requestStream: func(_ context.Context, streamID StreamID, payload *Payload) (*PayloadStream, error) {
+				return nil, errors.New("boom")
+			},
+		})
+
+		Convey("When a client requests a stream", func() {
+			So(responder.HandleFrame(ctx, frame.NewRequestStreamFrame(1, false, initReqs, false, nil, []byte("hello"))), ShouldBeNil)
+
+			Convey("Then the error should be sent as APPLICATION_ERROR", func() {
+				f, err := responses.Recv(ctx)
+
+				So(err, ShouldBeNil)
+				checkFrameHeader(f, 1, frame.TypeError, 0)
+				So(f.(*frame.ErrorFrame).Code, ShouldEqual, frame.ErrApplicationError)
+				So(f.(*frame.ErrorFrame).Data, ShouldEqual, "boom")
+			})
+		})
+	})
+
+	Convey("Given the errors of results", t, func() {
+		Convey("Then a plain error should be mapped to APPLICATION_ERROR", func() {
+			So(ErrResult(errors.New("boom")).Err, ShouldResemble, frame.ErrApplicationError.WithMessage("boom"))
+		})
+
+		Convey("Then a protocol error should keep its code", func() {
+			So(ErrResult(frame.ErrRejected.WithMessage("busy")).Err, ShouldResemble, frame.ErrRejected.WithMessage("busy"))
+		})
+	})
+}
+
+// RS -> RQ: METADATA_PUSH
+func TestServerMetadataPush(t *testing.T) {
+	Convey("Given a server requester paired with a client responder", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		frames := NewFrameChan(1)
+		pushed := make(chan Metadata, 1)
+		server := NewRequester(logger, frames, ServerStreamIDs(), initReqs)
+		client := NewResponder(logger, NewFrameChan(1), &testResponder{metadataPush: func(metadata Metadata) error {
+			pushed <- metadata
+
+			return nil
+		}})
+
+		Convey("When the server pushes metadata", func() {
+			So(server.MetadataPush(ctx, Metadata("config")), ShouldBeNil)
+
+			f, err := frames.Recv(ctx)
+			So(err, ShouldBeNil)
+			checkFrameHeader(f, 0, frame.TypeMetadataPush, frame.FlagMetadata)
+
+			So(client.HandleFrame(ctx, f), ShouldBeNil)
+
+			Convey("Then the client handler should receive the metadata", func() {
+				So(<-pushed, ShouldResemble, Metadata("config"))
+			})
+
+			Convey("Then the stream id should not be consumed", func() {
+				_, err := server.RequestStream(ctx, Text("hello"))
+				So(err, ShouldBeNil)
+
+				f, _ := frames.Recv(ctx)
+				checkFrameHeader(f, 2, frame.TypeRequestStream, 0)
+			})
+		})
+	})
+}
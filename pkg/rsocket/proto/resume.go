@@ -0,0 +1,226 @@
+package proto
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+// isResumable indicates the frame is retained for resumption,
+// the frames on stream 0 are about the connection and never resent.
+func isResumable(f frame.Frame) bool {
+	return f.StreamID() != 0
+}
+
+type bufferedFrame struct {
+	frame    frame.Frame
+	position Position // The implied position after the frame.
+}
+
+// ResumeBuffer retains the frames sent until the peer acknowledges them with the implied position.
+type ResumeBuffer struct {
+	lock     sync.Mutex
+	size     int // The maximum frames retained, or 0 if unbounded.
+	first    Position
+	position Position
+	frames   []bufferedFrame
+}
+
+// NewResumeBuffer creates an empty ResumeBuffer without bound.
+func NewResumeBuffer() *ResumeBuffer {
+	return new(ResumeBuffer)
+}
+
+// NewBoundedResumeBuffer creates an empty ResumeBuffer retains at most size frames,
+// the oldest frame is dropped once full, and the connection can't be resumed before it any more.
+func NewBoundedResumeBuffer(size int) *ResumeBuffer {
+	return &ResumeBuffer{size: size}
+}
+
+// Append retains the resumable frame sent, and advances the implied position with its size.
+func (buffer *ResumeBuffer) Append(f frame.Frame) {
+	if !isResumable(f) {
+		return
+	}
+
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if buffer.size > 0 && len(buffer.frames) == buffer.size {
+		buffer.first = buffer.frames[0].position
+		buffer.frames = append(buffer.frames[:0], buffer.frames[1:]...)
+	}
+
+	buffer.position += Position(f.Size())
+	buffer.frames = append(buffer.frames, bufferedFrame{f, buffer.position})
+}
+
+// Trim drops the frames at or below the position acknowledged by the peer.
+func (buffer *ResumeBuffer) Trim(position Position) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	n := 0
+
+	for n < len(buffer.frames) && buffer.frames[n].position <= position {
+		buffer.first = buffer.frames[n].position
+		n++
+	}
+
+	buffer.frames = append(buffer.frames[:0], buffer.frames[n:]...)
+}
+
+// FirstAvailable returns the earliest position the buffer can rewind back to.
+func (buffer *ResumeBuffer) FirstAvailable() Position {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return buffer.first
+}
+
+// Position returns the implied position after the last frame sent.
+func (buffer *ResumeBuffer) Position() Position {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	return buffer.position
+}
+
+// Since returns the frames sent after the position in the order sent, the frame acknowledged partially is included,
+// returns ErrResumePositionLost if the frames after the position have been dropped or the position was never sent.
+func (buffer *ResumeBuffer) Since(position Position) ([]frame.Frame, error) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	if position < buffer.first || position > buffer.position {
+		return nil, ErrResumePositionLost
+	}
+
+	var frames []frame.Frame
+
+	for _, buffered := range buffer.frames {
+		if buffered.position > position {
+			frames = append(frames, buffered.frame)
+		}
+	}
+
+	return frames, nil
+}
+
+// resend the frames retained after the position to the connection once resumed,
+// and drops the frames the peer has received.
+func resend(ctx context.Context, conn Conn, buffer *ResumeBuffer, position Position) error {
+	frames, err := buffer.Since(position)
+
+	if err != nil {
+		return err
+	}
+
+	buffer.Trim(position)
+
+	for _, f := range frames {
+		if err := conn.Send(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Frames returns the frames retained in the order sent.
+func (buffer *ResumeBuffer) Frames() []frame.Frame {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	frames := make([]frame.Frame, len(buffer.frames))
+
+	for i, buffered := range buffer.frames {
+		frames[i] = buffered.frame
+	}
+
+	return frames
+}
+
+// ResumptionState tracks the positions of a resumable connection as the frames flow,
+// which survives across the connections to resume the session after the transport dropped.
+type ResumptionState struct {
+	*ResumeBuffer // The frames sent but not acknowledged by the peer.
+	lock          sync.Mutex
+	lastReceived  Position // The implied position of the resumable frames received.
+}
+
+// NewResumptionState creates a ResumptionState retains the frames sent in the buffer.
+func NewResumptionState(buffer *ResumeBuffer) *ResumptionState {
+	return &ResumptionState{ResumeBuffer: buffer}
+}
+
+// Received advances the last received position with the size of resumable frame received,
+// and trims the buffer with the position acknowledged by the peer if it is a KEEPALIVE frame.
+func (state *ResumptionState) Received(f frame.Frame) {
+	if keepaliveFrame, ok := f.(*frame.KeepaliveFrame); ok {
+		state.Trim(keepaliveFrame.LastReceived)
+	}
+
+	if !isResumable(f) {
+		return
+	}
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.lastReceived += Position(f.Size())
+}
+
+// LastReceived returns the implied position of the resumable frames received.
+func (state *ResumptionState) LastReceived() Position {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	return state.lastReceived
+}
+
+// ResumeFrame creates a RESUME frame resumes the session from the positions tracked.
+func (state *ResumptionState) ResumeFrame(version Version, token Token) *frame.ResumeFrame {
+	return frame.NewResumeFrame(version, token, state.LastReceived(), state.FirstAvailable())
+}
+
+// ResumableConn retains the frames sent in the ResumptionState,
+// and tracks the positions of the frames received.
+type ResumableConn struct {
+	Conn
+	State *ResumptionState
+}
+
+// NewResumableConn creates a ResumableConn tracks the frames sent and received in the state.
+func NewResumableConn(conn Conn, state *ResumptionState) *ResumableConn {
+	return &ResumableConn{conn, state}
+}
+
+// Send the frame and retains it for resumption.
+func (conn *ResumableConn) Send(ctx context.Context, f frame.Frame) error {
+	if err := conn.Conn.Send(ctx, f); err != nil {
+		return err
+	}
+
+	conn.State.Append(f)
+
+	return nil
+}
+
+// Resend the frames not received by the peer once resumed, which are retained without advancing the position,
+// returns ErrResumePositionLost if the frames after the last position received by the peer have been dropped.
+func (conn *ResumableConn) Resend(ctx context.Context, lastReceived Position) error {
+	return resend(ctx, conn.Conn, conn.State.ResumeBuffer, lastReceived)
+}
+
+// Recv returns a Frame received, and tracks the position of it.
+func (conn *ResumableConn) Recv(ctx context.Context) (f frame.Frame, err error) {
+	if f, err = conn.Conn.Recv(ctx); err != nil {
+		return
+	}
+
+	conn.State.Received(f)
+
+	return
+}
@@ -0,0 +1,221 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResumeBufferTrimmedByKeepalive(t *testing.T) {
+	Convey("Given a resumable connection sent frames", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := NewFrameChan(1)
+		buffer := NewResumptionState(NewResumeBuffer())
+		resumableConn := NewResumableConn(&receivingConn{&bufferedConn{}, received}, buffer)
+
+		frames := []frame.Frame{
+			frame.NewRequestFireAndForgetFrame(1, false, false, nil, []byte("foo")),
+			frame.NewRequestFireAndForgetFrame(3, false, false, nil, []byte("bar")),
+			frame.NewKeepaliveFrame(true, 0, nil),
+			frame.NewRequestFireAndForgetFrame(5, false, false, nil, []byte("baz")),
+		}
+
+		for _, f := range frames {
+			So(resumableConn.Send(ctx, f), ShouldBeNil)
+		}
+
+		Convey("Then only the resumable frames should be retained", func() {
+			So(buffer.Frames(), ShouldResemble, []frame.Frame{frames[0], frames[1], frames[3]})
+			So(buffer.Position(), ShouldEqual, Position(frames[0].Size()+frames[1].Size()+frames[3].Size()))
+		})
+
+		Convey("When receive a KEEPALIVE frame acknowledged the first two frames", func() {
+			acknowledged := Position(frames[0].Size() + frames[1].Size())
+
+			So(received.Send(ctx, frame.NewKeepaliveFrame(false, acknowledged, nil)), ShouldBeNil)
+
+			_, err := resumableConn.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then the acknowledged frames should be dropped", func() {
+				So(buffer.Frames(), ShouldResemble, []frame.Frame{frames[3]})
+				So(buffer.FirstAvailable(), ShouldEqual, acknowledged)
+			})
+		})
+
+		Convey("When receive a KEEPALIVE frame acknowledged a part of frame", func() {
+			So(received.Send(ctx, frame.NewKeepaliveFrame(false, Position(frames[0].Size()+1), nil)), ShouldBeNil)
+
+			_, err := resumableConn.Recv(ctx)
+			So(err, ShouldBeNil)
+
+			Convey("Then the partially acknowledged frame should be retained", func() {
+				So(buffer.Frames(), ShouldResemble, []frame.Frame{frames[1], frames[3]})
+			})
+		})
+	})
+}
+
+func TestResumptionStateTracksPositions(t *testing.T) {
+	Convey("Given a resumable connection with a bounded resume buffer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		received := NewFrameChan(3)
+		state := NewResumptionState(NewBoundedResumeBuffer(2))
+		resumableConn := NewResumableConn(&receivingConn{&bufferedConn{}, received}, state)
+
+		sent := []frame.Frame{
+			frame.NewRequestFireAndForgetFrame(1, false, false, nil, []byte("foo")),
+			frame.NewRequestFireAndForgetFrame(3, false, false, nil, []byte("bar")),
+			frame.NewRequestFireAndForgetFrame(5, false, false, nil, []byte("baz")),
+		}
+
+		for _, f := range sent {
+			So(resumableConn.Send(ctx, f), ShouldBeNil)
+		}
+
+		Convey("Then the oldest frame should be dropped once the buffer full", func() {
+			So(state.Frames(), ShouldResemble, []frame.Frame{sent[1], sent[2]})
+			So(state.FirstAvailable(), ShouldEqual, Position(sent[0].Size()))
+		})
+
+		Convey("When receive the frames from the peer", func() {
+			payload := Text("hello").buildPayloadFrame(2, false)
+
+			So(received.Send(ctx, payload), ShouldBeNil)
+			So(received.Send(ctx, frame.NewKeepaliveFrame(false, 0, nil)), ShouldBeNil)
+			So(received.Send(ctx, payload), ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, err := resumableConn.Recv(ctx)
+				So(err, ShouldBeNil)
+			}
+
+			Convey("Then the last received position should only count the resumable frames", func() {
+				So(state.LastReceived(), ShouldEqual, Position(2*payload.Size()))
+
+				Convey("And the RESUME frame should carry the positions tracked", func() {
+					resumeFrame := state.ResumeFrame(LatestVersion, Token("token"))
+
+					So(resumeFrame.LastReceived, ShouldEqual, Position(2*payload.Size()))
+					So(resumeFrame.FirstAvailable, ShouldEqual, Position(sent[0].Size()))
+				})
+			})
+		})
+	})
+}
+
+func TestResumeResendsFramesSincePosition(t *testing.T) {
+	Convey("Given a resumable connection sent frames", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn := &bufferedConn{}
+		state := NewResumptionState(NewResumeBuffer())
+		resumableConn := NewResumableConn(&receivingConn{conn, NewFrameChan(0)}, state)
+
+		sent := []frame.Frame{
+			frame.NewRequestFireAndForgetFrame(1, false, false, nil, []byte("foo")),
+			frame.NewRequestFireAndForgetFrame(3, false, false, nil, []byte("bar")),
+			frame.NewRequestFireAndForgetFrame(5, false, false, nil, []byte("baz")),
+		}
+
+		for _, f := range sent {
+			So(resumableConn.Send(ctx, f), ShouldBeNil)
+		}
+
+		position := state.Position()
+		acknowledged := Position(sent[0].Size())
+
+		Convey("When resumed with the first frame received by the peer", func() {
+			conn.buffered = nil
+
+			So(resumableConn.Resend(ctx, acknowledged), ShouldBeNil)
+
+			Convey("Then only the frames not received should be resent without advancing the position", func() {
+				So(conn.buffered, ShouldResemble, []frame.Frame{sent[1], sent[2]})
+				So(state.Frames(), ShouldResemble, []frame.Frame{sent[1], sent[2]})
+				So(state.FirstAvailable(), ShouldEqual, acknowledged)
+				So(state.Position(), ShouldEqual, position)
+			})
+		})
+
+		Convey("When resumed from a position has been dropped", func() {
+			state.Trim(acknowledged)
+
+			_, err := state.Since(0)
+
+			Convey("Then the resumption should be rejected", func() {
+				So(err, ShouldEqual, ErrResumePositionLost)
+				So(resumableConn.Resend(ctx, 0), ShouldEqual, ErrResumePositionLost)
+			})
+		})
+
+		Convey("When resumed from a position never sent", func() {
+			_, err := state.Since(position + 1)
+
+			Convey("Then the resumption should be rejected", func() {
+				So(err, ShouldEqual, ErrResumePositionLost)
+			})
+		})
+	})
+}
+
+func TestAcceptResumeWithStore(t *testing.T) {
+	Convey("Given a resume store with a session", t, func() {
+		store := NewMemoryResumeStore()
+
+		token, err := store.Create()
+		So(err, ShouldBeNil)
+
+		Convey("When resume the session with the known token", func() {
+			session, err := AcceptResume(store, frame.NewResumeFrame(LatestVersion, token, 0, 0))
+
+			Convey("Then the resume should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(session.Token, ShouldResemble, token)
+			})
+		})
+
+		Convey("When resume a session with an unknown token", func() {
+			session, err := AcceptResume(store, frame.NewResumeFrame(LatestVersion, frame.NewToken(), 0, 0))
+
+			Convey("Then the resume should be rejected", func() {
+				So(session, ShouldBeNil)
+				So(err, ShouldEqual, ErrUnknownResumeToken)
+				So(err.(*Error).Code, ShouldEqual, frame.ErrRejectedResume)
+			})
+		})
+
+		Convey("When resume a removed session", func() {
+			store.Remove(token)
+
+			_, err := AcceptResume(store, frame.NewResumeFrame(LatestVersion, token, 0, 0))
+
+			Convey("Then the resume should be rejected", func() {
+				So(err, ShouldEqual, ErrUnknownResumeToken)
+			})
+		})
+
+		Convey("When resume from a position has been trimmed", func() {
+			session, _ := store.Lookup(token)
+
+			f := frame.NewRequestFireAndForgetFrame(1, false, false, nil, []byte("foo"))
+			session.Buffer.Append(f)
+			session.Buffer.Append(frame.NewRequestFireAndForgetFrame(3, false, false, nil, []byte("bar")))
+			session.Buffer.Trim(Position(f.Size()))
+
+			_, err := AcceptResume(store, frame.NewResumeFrame(LatestVersion, token, 0, 0))
+
+			Convey("Then the resume should be rejected", func() {
+				So(err, ShouldEqual, ErrResumePositionLost)
+			})
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+)
+
+// RoutingMimeType is the MIME type of the routing metadata.
+const RoutingMimeType = "message/x.rsocket.routing.v0"
+
+const maxTagLength = 0xFF
+
+// ErrInvalidRouting is returned when encode or decode a malformed routing metadata.
+var ErrInvalidRouting = errors.New("invalid routing metadata")
+
+// RoutingMetadata holds the routing tags of a request.
+type RoutingMetadata []string
+
+// NewRoutingMetadata creates a RoutingMetadata with tags.
+func NewRoutingMetadata(tags ...string) RoutingMetadata {
+	return RoutingMetadata(tags)
+}
+
+// DecodeRoutingMetadata decodes the routing tags from metadata.
+func DecodeRoutingMetadata(metadata Metadata) (routing RoutingMetadata, err error) {
+	buf := []byte(metadata)
+
+	for len(buf) > 0 {
+		n := int(buf[0])
+
+		if n == 0 || n >= len(buf) {
+			return nil, ErrInvalidRouting
+		}
+
+		routing = append(routing, string(buf[1:n+1]))
+		buf = buf[n+1:]
+	}
+
+	return
+}
+
+// Route returns the first routing tag.
+func (routing RoutingMetadata) Route() string {
+	if len(routing) == 0 {
+		return ""
+	}
+
+	return routing[0]
+}
+
+// Encode the routing tags as metadata.
+func (routing RoutingMetadata) Encode() (Metadata, error) {
+	var buf bytes.Buffer
+
+	for _, tag := range routing {
+		if len(tag) == 0 || len(tag) > maxTagLength {
+			return nil, ErrInvalidRouting
+		}
+
+		buf.WriteByte(byte(len(tag)))
+		buf.WriteString(tag)
+	}
+
+	return Metadata(buf.Bytes()), nil
+}
+
+// WithRoute appends the routing entry with tags to the composite metadata of payload,
+// so the responder could dispatch the request with the route.
+func (payload *Payload) WithRoute(tags ...string) (*Payload, error) {
+	routing, err := NewRoutingMetadata(tags...).Encode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := payload.Metadata.AppendEntry(RoutingMimeType, routing)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.WithMetadata(metadata), nil
+}
@@ -0,0 +1,189 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"go.uber.org/zap"
+)
+
+// FrameMatcher reports whether a request frame matches the expectation.
+type FrameMatcher func(f frame.Frame) bool
+
+// MatchType matches the request frame with type.
+func MatchType(tp frame.Type) FrameMatcher {
+	return func(f frame.Frame) bool {
+		return f.Type() == tp
+	}
+}
+
+// MatchRoute matches the request frame routed to the route.
+func MatchRoute(route string) FrameMatcher {
+	return func(f frame.Frame) bool {
+		metadata, ok := requestMetadata(f)
+
+		if !ok {
+			return false
+		}
+
+		routing, err := DecodeRoutingMetadata(metadata)
+
+		return err == nil && routing.Route() == route
+	}
+}
+
+func requestMetadata(f frame.Frame) (Metadata, bool) {
+	switch f := f.(type) {
+	case *frame.RequestResponseFrame:
+		return f.Metadata, f.HasMetadata()
+	case *frame.RequestFireAndForgetFrame:
+		return f.Metadata, f.HasMetadata()
+	case *frame.RequestStreamFrame:
+		return f.Metadata, f.HasMetadata()
+	case *frame.RequestChannelFrame:
+		return f.Metadata, f.HasMetadata()
+	default:
+		return nil, false
+	}
+}
+
+// ScriptStep expects a request frame and replies with the canned responses.
+type ScriptStep struct {
+	Matchers  []FrameMatcher
+	Responses []*Result // A Result without Payload and error completes the stream.
+}
+
+// Expect creates a ScriptStep expects a request frame matches all the matchers.
+func Expect(matchers ...FrameMatcher) *ScriptStep {
+	return &ScriptStep{Matchers: matchers}
+}
+
+// Respond replies the payloads.
+func (step *ScriptStep) Respond(payloads ...*Payload) *ScriptStep {
+	for _, payload := range payloads {
+		step.Responses = append(step.Responses, Ok(payload))
+	}
+
+	return step
+}
+
+// Fail replies an error.
+func (step *ScriptStep) Fail(err error) *ScriptStep {
+	step.Responses = append(step.Responses, Err(err))
+
+	return step
+}
+
+// Complete replies the stream completion.
+func (step *ScriptStep) Complete() *ScriptStep {
+	step.Responses = append(step.Responses, &Result{})
+
+	return step
+}
+
+// Match returns the request frame matches the step or not.
+func (step *ScriptStep) Match(f frame.Frame) bool {
+	for _, match := range step.Matchers {
+		if !match(f) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (step *ScriptStep) buildFrames(streamID StreamID) (frames []frame.Frame) {
+	for i, result := range step.Responses {
+		switch {
+		case result.Err != nil:
+			// The ERROR terminates the stream, nothing follows it.
+			return append(frames, buildErrorFrame(streamID, result.Err))
+
+		case result.Payload != nil:
+			next := i + 1
+			complete := next < len(step.Responses) && step.Responses[next].Payload == nil && step.Responses[next].Err == nil
+
+			frames = append(frames, result.Payload.buildPayloadFrame(streamID, complete))
+
+		case i == 0 || step.Responses[i-1].Payload == nil:
+			frames = append(frames, buildCompleteFrame(streamID))
+		}
+	}
+
+	return
+}
+
+// ScriptedResponder replies the requests sent by a Requester with a script,
+// and drives the Requester to handle the responses.
+type ScriptedResponder struct {
+	*zap.Logger
+	requests FrameReceiver
+	handler  FrameHandler
+	steps    []*ScriptStep
+}
+
+// NewScriptedResponder creates a ScriptedResponder receives requests and replies to the handler.
+func NewScriptedResponder(logger *zap.Logger, requests FrameReceiver, handler FrameHandler, steps ...*ScriptStep) *ScriptedResponder {
+	return &ScriptedResponder{logger.Named("scripted"), requests, handler, steps}
+}
+
+// Serve handles the requests until all the steps of script be replied.
+func (responder *ScriptedResponder) Serve(ctx context.Context) error {
+	replied := make(chan error, len(responder.steps))
+
+	for _, step := range responder.steps {
+		f, err := responder.expect(ctx, step)
+
+		if err != nil {
+			return err
+		}
+
+		go func(frames []frame.Frame) {
+			for _, f := range frames {
+				if err := responder.handler.HandleFrame(ctx, f); err != nil {
+					replied <- err
+					return
+				}
+			}
+
+			replied <- nil
+		}(step.buildFrames(f.StreamID()))
+	}
+
+	for range responder.steps {
+		if err := <-replied; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (responder *ScriptedResponder) expect(ctx context.Context, step *ScriptStep) (frame.Frame, error) {
+	for {
+		f, err := responder.requests.Recv(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f == nil {
+			return nil, fmt.Errorf("requests closed before %d steps replied", len(responder.steps))
+		}
+
+		if step.Match(f) {
+			responder.Debug("matched request", zap.Stringer("stream", f.StreamID()), zap.Stringer("type", f.Type()))
+
+			return f, nil
+		}
+
+		switch f.Type() {
+		case frame.TypeRequestN, frame.TypeCancel:
+			responder.Debug("skip request", zap.Stringer("stream", f.StreamID()), zap.Stringer("type", f.Type()))
+
+		default:
+			return nil, fmt.Errorf("unexpected %s frame on stream (%d)", f, f.StreamID())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func runScripted(t *testing.T, steps []*ScriptStep, callback func(ctx context.Context, requester *rSocketRequester)) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	requests := NewFrameChan(0)
+	requester := NewRequester(logger, logFrameSender{t, requests}, ClientStreamIDs(), uint(initReqs)).(*rSocketRequester)
+	responder := NewScriptedResponder(logger, requests, requester, steps...)
+
+	replied := make(chan error, 1)
+
+	go func() {
+		replied <- responder.Serve(ctx)
+	}()
+
+	callback(ctx, requester)
+
+	So(<-replied, ShouldBeNil)
+}
+
+// RQ -> RS: REQUEST_STREAM
+// RS -> RQ: PAYLOAD*
+// RS -> RQ: COMPLETE
+func TestScriptedRequestStreamComplete(t *testing.T) {
+	Convey("Given a requester driven by a scripted responder", t, func() {
+		steps := []*ScriptStep{
+			Expect(MatchType(frame.TypeRequestStream)).Respond(Text("foo"), Text("bar")).Complete(),
+		}
+
+		runScripted(t, steps, func(ctx context.Context, requester *rSocketRequester) {
+			Convey("When request stream for payloads", func() {
+				responses, err := requester.RequestStream(ctx, Text("hello").WithMetadata([]byte("world")))
+				So(err, ShouldBeNil)
+
+				Convey("Then payload stream should be ready", func() {
+					payload, _ := responses.Recv(ctx)
+					So(payload, ShouldResemble, Text("foo"))
+
+					payload, _ = responses.Recv(ctx)
+					So(payload, ShouldResemble, Text("bar"))
+
+					payload, _ = responses.Recv(ctx)
+					So(payload, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
+
+func TestScriptStepStopsAfterError(t *testing.T) {
+	Convey("Given a script step fails then completes", t, func() {
+		step := Expect(MatchType(frame.TypeRequestStream)).Respond(Text("foo")).Fail(frame.ErrApplicationError.WithMessage("for test")).Complete()
+
+		Convey("When build the response frames", func() {
+			frames := step.buildFrames(1)
+
+			Convey("Then nothing should follow the ERROR frame", func() {
+				So(frames, ShouldHaveLength, 2)
+
+				checkFrameHeader(frames[0], 1, frame.TypePayload, frame.FlagNext)
+				checkFrameHeader(frames[1], 1, frame.TypeError, 0)
+			})
+		})
+	})
+}
+
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: PAYLOAD with COMPLETE
+// RQ -> RS: REQUEST_RESPONSE
+// RS -> RQ: ERROR[APPLICATION_ERROR]
+func TestScriptedRequestResponseWithRoute(t *testing.T) {
+	Convey("Given a scripted responder matches the route", t, func() {
+		steps := []*ScriptStep{
+			Expect(MatchType(frame.TypeRequestResponse), MatchRoute("echo")).Respond(Text("hello")).Complete(),
+			Expect(MatchType(frame.TypeRequestResponse), MatchRoute("fail")).Fail(frame.ErrApplicationError.WithMessage("for test")),
+		}
+
+		runScripted(t, steps, func(ctx context.Context, requester *rSocketRequester) {
+			Convey("When request for responses with routes", func() {
+				echo, err := NewRoutingMetadata("echo").Encode()
+				So(err, ShouldBeNil)
+
+				payload, err := requester.RequestResponse(ctx, Text("hello").WithMetadata(echo))
+				So(err, ShouldBeNil)
+				So(payload.Text(), ShouldEqual, "hello")
+
+				fail, err := NewRoutingMetadata("fail").Encode()
+				So(err, ShouldBeNil)
+
+				payload, err = requester.RequestResponse(ctx, Text("hello").WithMetadata(fail))
+				So(payload, ShouldBeNil)
+				So(err, ShouldResemble, frame.ErrApplicationError.WithMessage("for test"))
+			})
+		})
+	})
+}
+
+func TestRoutingMetadata(t *testing.T) {
+	Convey("Given a routing metadata with tags", t, func() {
+		metadata, err := NewRoutingMetadata("foo", "bar").Encode()
+
+		So(err, ShouldBeNil)
+		So([]byte(metadata), ShouldResemble, []byte("\x03foo\x03bar"))
+
+		Convey("Then the tags should be decoded", func() {
+			routing, err := DecodeRoutingMetadata(metadata)
+
+			So(err, ShouldBeNil)
+			So(routing, ShouldResemble, NewRoutingMetadata("foo", "bar"))
+			So(routing.Route(), ShouldEqual, "foo")
+		})
+
+		Convey("Then the truncated tags should be rejected", func() {
+			_, err := DecodeRoutingMetadata(metadata[:len(metadata)-1])
+
+			So(err, ShouldEqual, ErrInvalidRouting)
+		})
+	})
+}
+
+func TestPayloadWithRoute(t *testing.T) {
+	Convey("Given a payload with the data MIME type in composite metadata", t, func() {
+		payload, err := Text("hello").WithDataMimeType("text/plain")
+		So(err, ShouldBeNil)
+
+		Convey("When append the route", func() {
+			payload, err := payload.WithRoute("foo", "bar")
+			So(err, ShouldBeNil)
+
+			Convey("Then the routing entry should be appended to the composite metadata", func() {
+				content, ok := payload.Metadata.Entry(0x7E)
+				So(ok, ShouldBeTrue)
+
+				routing, err := DecodeRoutingMetadata(content)
+				So(err, ShouldBeNil)
+				So(routing, ShouldResemble, NewRoutingMetadata("foo", "bar"))
+
+				mime, ok := payload.DataMimeType()
+				So(ok, ShouldBeTrue)
+				So(mime, ShouldEqual, "text/plain")
+			})
+		})
+
+		Convey("When append an empty route", func() {
+			_, err := payload.WithRoute("")
+
+			Convey("Then it should fail", func() {
+				So(err, ShouldEqual, ErrInvalidRouting)
+			})
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package proto
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+)
+
+var (
+	// ErrUnknownResumeToken is returned when resume a session not found in the store.
+	ErrUnknownResumeToken = frame.ErrRejectedResume.WithMessage("unknown resume token")
+
+	// ErrResumePositionLost is returned when the frames since the last position received by the client have been dropped.
+	ErrResumePositionLost = frame.ErrRejectedResume.WithMessage("resume position lost")
+)
+
+// Session is the state of a resumable connection, which survives across the connections.
+type Session struct {
+	Token  Token
+	Buffer *ResumeBuffer // The frames sent by the server but not acknowledged by the client.
+}
+
+// Resend the frames not received by the client to the new connection once the resumption accepted,
+// and drops the frames the client has received.
+func (session *Session) Resend(ctx context.Context, conn Conn, lastReceived Position) error {
+	return resend(ctx, conn, session.Buffer, lastReceived)
+}
+
+// ResumeStore creates, finds and removes the sessions by the resume token,
+// it may be backed by a persistent storage to share the sessions between servers.
+type ResumeStore interface {
+	// Create a session with a new resume token.
+	Create() (Token, error)
+
+	// Lookup the session of the resume token.
+	Lookup(token Token) (*Session, bool)
+
+	// Remove the session of the resume token.
+	Remove(token Token)
+}
+
+// MemoryResumeStore keeps the sessions in memory.
+type MemoryResumeStore struct {
+	lock     sync.Mutex
+	sessions map[string]*Session
+}
+
+var _ ResumeStore = (*MemoryResumeStore)(nil)
+
+// NewMemoryResumeStore creates an empty MemoryResumeStore.
+func NewMemoryResumeStore() *MemoryResumeStore {
+	return &MemoryResumeStore{sessions: make(map[string]*Session)}
+}
+
+// Create a session with a new random resume token.
+func (store *MemoryResumeStore) Create() (Token, error) {
+	token := frame.NewToken()
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.sessions[string(token)] = &Session{token, NewResumeBuffer()}
+
+	return token, nil
+}
+
+// Lookup the session of the resume token.
+func (store *MemoryResumeStore) Lookup(token Token) (*Session, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	session, ok := store.sessions[string(token)]
+
+	return session, ok
+}
+
+// Remove the session of the resume token.
+func (store *MemoryResumeStore) Remove(token Token) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.sessions, string(token))
+}
+
+// AcceptResume decides whether the server accepts the RESUME frame,
+// returns the session to resume, or a REJECTED_RESUME error if the token is unknown
+// or the server can't rewind back to the last position received by the client.
+func AcceptResume(store ResumeStore, resume *frame.ResumeFrame) (*Session, error) {
+	session, ok := store.Lookup(resume.Token)
+
+	if !ok {
+		return nil, ErrUnknownResumeToken
+	}
+
+	if _, err := session.Buffer.Since(resume.LastReceived); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
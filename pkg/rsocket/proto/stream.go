@@ -1,6 +1,8 @@
 package proto
 
 import (
+	"context"
+	"sync"
 	"sync/atomic"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
@@ -9,6 +11,20 @@ import (
 // StreamID representing the stream identifier.
 type StreamID = frame.StreamID
 
+type streamIDKey struct{}
+
+// ContextWithStreamID returns a context carries the stream ID.
+func ContextWithStreamID(ctx context.Context, streamID StreamID) context.Context {
+	return context.WithValue(ctx, streamIDKey{}, streamID)
+}
+
+// StreamIDFromContext returns the stream ID carried by the context.
+func StreamIDFromContext(ctx context.Context) (StreamID, bool) {
+	streamID, ok := ctx.Value(streamIDKey{}).(StreamID)
+
+	return streamID, ok
+}
+
 // StreamIDs generates StreamID.
 type StreamIDs struct {
 	streamID int32
@@ -29,3 +45,42 @@ func (ids *StreamIDs) Current() StreamID {
 func (ids *StreamIDs) Next() StreamID {
 	return StreamID(atomic.AddInt32(&ids.streamID, 2))
 }
+
+// recentStreams remembers the latest stream IDs added, the oldest one is forgotten once full.
+type recentStreams struct {
+	lock    sync.Mutex
+	ring    []StreamID
+	next    int
+	streams map[StreamID]struct{}
+}
+
+func newRecentStreams(size int) *recentStreams {
+	return &recentStreams{ring: make([]StreamID, 0, size), streams: make(map[StreamID]struct{}, size)}
+}
+
+// Add remembers the stream ID.
+func (recent *recentStreams) Add(streamID StreamID) {
+	recent.lock.Lock()
+	defer recent.lock.Unlock()
+
+	if len(recent.ring) < cap(recent.ring) {
+		recent.ring = append(recent.ring, streamID)
+	} else {
+		delete(recent.streams, recent.ring[recent.next])
+
+		recent.ring[recent.next] = streamID
+		recent.next = (recent.next + 1) % len(recent.ring)
+	}
+
+	recent.streams[streamID] = struct{}{}
+}
+
+// Contains indicates the stream ID is remembered.
+func (recent *recentStreams) Contains(streamID StreamID) bool {
+	recent.lock.Lock()
+	defer recent.lock.Unlock()
+
+	_, ok := recent.streams[streamID]
+
+	return ok
+}
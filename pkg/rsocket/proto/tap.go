@@ -0,0 +1,79 @@
+package proto
+
+import (
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"go.uber.org/zap"
+)
+
+// Direction of the frame tapped.
+type Direction int
+
+const (
+	// Outbound is the direction of frame sent.
+	Outbound Direction = iota
+	// Inbound is the direction of frame received.
+	Inbound
+)
+
+func (direction Direction) String() string {
+	switch direction {
+	case Outbound:
+		return "OUT"
+	case Inbound:
+		return "IN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// TappedFrame is a copy of the frame sent or received.
+type TappedFrame struct {
+	Direction Direction
+	Frame     frame.Frame
+}
+
+// Tapper mirrors the frames sent and received.
+type Tapper interface {
+	// Tap returns the channel of frames mirrored, or nil if the tap is not enabled.
+	Tap() <-chan TappedFrame
+}
+
+var _ Tapper = (*rSocketRequester)(nil)
+
+// WithTap mirrors the frames sent and received by the requester to a channel with the capacity,
+// the frames are dropped if the channel is full.
+func WithTap(capacity int) RequesterOption {
+	return func(requester *rSocketRequester) {
+		requester.tap = make(chan TappedFrame, capacity)
+	}
+}
+
+func (requester *rSocketRequester) Tap() <-chan TappedFrame {
+	return requester.tap
+}
+
+func (requester *rSocketRequester) tapFrame(direction Direction, f frame.Frame) {
+	if requester.tap == nil {
+		return
+	}
+
+	var copied frame.Frame
+
+	buf, err := frame.Encode(f)
+
+	if err == nil {
+		copied, err = frame.Decode(buf)
+	}
+
+	if err != nil {
+		requester.Warn("copy tapped frame failed", zap.Stringer("type", f.Type()), zap.Error(err))
+
+		return
+	}
+
+	select {
+	case requester.tap <- TappedFrame{direction, copied}:
+	default:
+		requester.Debug("drop tapped frame", zap.Stringer("direction", direction), zap.Stringer("type", f.Type()))
+	}
+}
@@ -0,0 +1,59 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequesterTap(t *testing.T) {
+	Convey("Given a requester with a tap", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		requests := NewFrameChan(4)
+		requester := NewRequester(logger, requests, ClientStreamIDs(), initReqs, WithTap(2)).(*rSocketRequester)
+
+		Convey("When send and receive frames", func() {
+			stream, err := requester.RequestStream(ctx, Text("hello"))
+			So(err, ShouldBeNil)
+
+			So(requester.HandleFrame(ctx, frame.NewPayloadFrame(1, false, true, true, false, nil, []byte("world"))), ShouldBeNil)
+
+			Convey("Then the frames should be mirrored with direction", func() {
+				tapped := <-requester.Tap()
+				So(tapped.Direction, ShouldEqual, Outbound)
+				checkFrameHeader(tapped.Frame, 1, frame.TypeRequestStream, 0)
+				So(tapped.Frame.(*frame.RequestStreamFrame).Data, ShouldResemble, []byte("hello"))
+
+				tapped = <-requester.Tap()
+				So(tapped.Direction, ShouldEqual, Inbound)
+				checkFrameHeader(tapped.Frame, 1, frame.TypePayload, frame.FlagComplete|frame.FlagNext)
+
+				Convey("Then the normal processing should not be affected", func() {
+					payload, err := stream.Recv(ctx)
+
+					So(err, ShouldBeNil)
+					So(payload.Text(), ShouldEqual, "world")
+
+					f, _ := requests.Recv(ctx)
+					So(f.(*frame.RequestStreamFrame).Data, ShouldResemble, []byte("hello"))
+				})
+			})
+		})
+
+		Convey("When the tap consumer is slow", func() {
+			for i := 0; i < 3; i++ {
+				So(requester.FireAndForget(ctx, Text("hello")), ShouldBeNil)
+			}
+
+			Convey("Then the frames beyond the capacity should be dropped", func() {
+				So(requester.Tap(), ShouldHaveLength, 2)
+				So(requests.C, ShouldHaveLength, 3)
+			})
+		})
+	})
+}
@@ -3,37 +3,182 @@ package transport
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/flier/rsocket-go/pkg/rsocket/frame"
 	"github.com/flier/rsocket-go/pkg/rsocket/proto"
 	"go.uber.org/zap"
 )
 
+// SocketOption tunes the socket of TCP connections.
+type SocketOption func(*socketOptions)
+
+// DialFunc connects to the address on the named network, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+type socketOptions struct {
+	noDelay     bool                 // Disable the Nagle's algorithm, which delays the small control frames.
+	keepAlive   time.Duration        // Period of TCP keep-alive probes, 0 for the system default, or negative if disabled.
+	readBuffer  int                  // Size of the receive buffer, or 0 for the system default.
+	writeBuffer int                  // Size of the send buffer, or 0 for the system default.
+	dial        DialFunc             // Dial the connection, or nil to use net.Dialer.
+	allocator   frame.Allocator      // Allocates the buffers of frames read, or nil to allocate from heap.
+	metadata    *frame.MetadataLimit // Rejects the frames read with metadata exceeds the limit, or nil if unlimited.
+}
+
+func newSocketOptions(opts ...SocketOption) *socketOptions {
+	options := &socketOptions{true, 0, 0, 0, nil, nil, nil}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
+// WithNoDelay controls whether to disable the Nagle's algorithm (TCP_NODELAY), which is enabled by default.
+func WithNoDelay(noDelay bool) SocketOption {
+	return func(options *socketOptions) {
+		options.noDelay = noDelay
+	}
+}
+
+// WithKeepAlive enables TCP keep-alive (SO_KEEPALIVE) probes with the period, or disables if the period is negative.
+func WithKeepAlive(period time.Duration) SocketOption {
+	return func(options *socketOptions) {
+		options.keepAlive = period
+	}
+}
+
+// WithReadBuffer sets the size of the receive buffer (SO_RCVBUF).
+func WithReadBuffer(size int) SocketOption {
+	return func(options *socketOptions) {
+		options.readBuffer = size
+	}
+}
+
+// WithWriteBuffer sets the size of the send buffer (SO_SNDBUF).
+func WithWriteBuffer(size int) SocketOption {
+	return func(options *socketOptions) {
+		options.writeBuffer = size
+	}
+}
+
+// WithDialer dials the connections with the function instead of net.Dialer, e.g. through a proxy,
+// the socket options only apply if the connection is a *net.TCPConn.
+func WithDialer(dial DialFunc) SocketOption {
+	return func(options *socketOptions) {
+		options.dial = dial
+	}
+}
+
+// WithAllocator allocates the buffers of frames read with the allocator,
+// e.g. a frame.BudgetAllocator shared across connections bounds the payloads received but not consumed.
+func WithAllocator(allocator frame.Allocator) SocketOption {
+	return func(options *socketOptions) {
+		options.allocator = allocator
+	}
+}
+
+// WithMetadataLimit rejects the frames read with metadata exceeds the limit before the frames buffered.
+func WithMetadataLimit(limit *frame.MetadataLimit) SocketOption {
+	return func(options *socketOptions) {
+		options.metadata = limit
+	}
+}
+
+// tcpSocket is the socket-level interface of *net.TCPConn.
+type tcpSocket interface {
+	SetNoDelay(noDelay bool) error
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
+func (options *socketOptions) apply(socket tcpSocket) error {
+	if err := socket.SetNoDelay(options.noDelay); err != nil {
+		return err
+	}
+
+	if options.keepAlive < 0 {
+		if err := socket.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+
+	if options.keepAlive > 0 {
+		if err := socket.SetKeepAlive(true); err != nil {
+			return err
+		}
+
+		if err := socket.SetKeepAlivePeriod(options.keepAlive); err != nil {
+			return err
+		}
+	}
+
+	if options.readBuffer > 0 {
+		if err := socket.SetReadBuffer(options.readBuffer); err != nil {
+			return err
+		}
+	}
+
+	if options.writeBuffer > 0 {
+		if err := socket.SetWriteBuffer(options.writeBuffer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type tcpTransport struct {
 	*zap.Logger
 	network string
 	address string
+	options *socketOptions
+}
+
+// NewTCPTransport creates a Transport connects to the address with the socket options.
+func NewTCPTransport(logger *zap.Logger, network, address string, opts ...SocketOption) Transport {
+	return &tcpTransport{logger, network, address, newSocketOptions(opts...)}
 }
 
 func (transport *tcpTransport) Connect(ctx context.Context) (proto.Conn, error) {
-	dialer := new(net.Dialer)
+	dial := transport.options.dial
 
-	conn, err := dialer.DialContext(ctx, transport.network, transport.address)
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: transport.options.keepAlive}).DialContext
+	}
+
+	conn, err := dial(ctx, transport.network, transport.address)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if socket, ok := conn.(tcpSocket); ok {
+		if err := transport.options.apply(socket); err != nil {
+			conn.Close()
+
+			return nil, err
+		}
+	}
+
+	framer := proto.NewFramer(transport.Logger, conn)
+	framer.Allocator = transport.options.allocator
+	framer.MetadataLimit = transport.options.metadata
+
 	return &tcpConn{
 		transport.Logger,
-		conn.(*net.TCPConn),
-		proto.NewFramer(transport.Logger, conn),
+		conn,
+		framer,
 	}, nil
 }
 
 type tcpConn struct {
 	*zap.Logger
-	*net.TCPConn
+	net.Conn
 	*proto.Framer
 }
 
@@ -46,6 +191,13 @@ func (conn *tcpConn) Send(ctx context.Context, f frame.Frame) error {
 
 	bytesSent.Add(float64(n))
 
+	if err != nil && conn.Framer.Err() != nil {
+		// The connection may be left with a partial frame, which is unrecoverable.
+		conn.Warn("send frame failed, close connection", zap.Error(err))
+
+		conn.Conn.Close()
+	}
+
 	return err
 }
 
@@ -56,9 +208,9 @@ func (conn *tcpConn) Recv(ctx context.Context) (frame.Frame, error) {
 		conn.Info("receive frame failed", zap.Error(err))
 	} else {
 		conn.Info("received frame", zap.Stringer("type", f.Type()), zap.Stringer("stream", f.StreamID()))
-	}
 
-	bytesRecv.Add(float64(f.Size()))
+		bytesRecv.Add(float64(f.Size()))
+	}
 
 	return f, err
 }
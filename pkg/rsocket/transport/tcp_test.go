@@ -0,0 +1,260 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/frame"
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+)
+
+type recordingSocket struct {
+	noDelay     bool
+	keepAlive   bool
+	period      time.Duration
+	readBuffer  int
+	writeBuffer int
+}
+
+func (socket *recordingSocket) SetNoDelay(noDelay bool) error {
+	socket.noDelay = noDelay
+	return nil
+}
+
+func (socket *recordingSocket) SetKeepAlive(keepalive bool) error {
+	socket.keepAlive = keepalive
+	return nil
+}
+
+func (socket *recordingSocket) SetKeepAlivePeriod(d time.Duration) error {
+	socket.period = d
+	return nil
+}
+
+func (socket *recordingSocket) SetReadBuffer(bytes int) error {
+	socket.readBuffer = bytes
+	return nil
+}
+
+func (socket *recordingSocket) SetWriteBuffer(bytes int) error {
+	socket.writeBuffer = bytes
+	return nil
+}
+
+func TestSocketOptions(t *testing.T) {
+	Convey("Given the default socket options", t, func() {
+		socket := new(recordingSocket)
+
+		So(newSocketOptions().apply(socket), ShouldBeNil)
+
+		Convey("Then TCP_NODELAY should be enabled", func() {
+			So(socket, ShouldResemble, &recordingSocket{noDelay: true})
+		})
+	})
+
+	Convey("Given the socket options", t, func() {
+		socket := new(recordingSocket)
+		options := newSocketOptions(
+			WithNoDelay(false), WithKeepAlive(time.Minute), WithReadBuffer(4096), WithWriteBuffer(8192))
+
+		So(options.apply(socket), ShouldBeNil)
+
+		Convey("Then the options should be applied to socket", func() {
+			So(socket, ShouldResemble, &recordingSocket{false, true, time.Minute, 4096, 8192})
+		})
+	})
+
+	Convey("Given the socket options disable keep-alive", t, func() {
+		socket := &recordingSocket{keepAlive: true}
+
+		So(newSocketOptions(WithKeepAlive(-1)).apply(socket), ShouldBeNil)
+
+		Convey("Then TCP keep-alive should be disabled", func() {
+			So(socket, ShouldResemble, &recordingSocket{noDelay: true})
+		})
+	})
+
+	Convey("Given a TCP listener", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+
+		Convey("When connect with the socket options", func() {
+			transport := NewTCPTransport(zap.NewNop(), "tcp", listener.Addr().String(),
+				WithKeepAlive(time.Minute), WithReadBuffer(4096), WithWriteBuffer(4096))
+
+			conn, err := transport.Connect(ctx)
+
+			Convey("Then the connection should be established", func() {
+				So(err, ShouldBeNil)
+				So(conn.Close(), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestTCPTransportWithDialer(t *testing.T) {
+	Convey("Given a TCP transport with a custom dialer", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var network, address string
+
+		client, server := net.Pipe()
+		defer server.Close()
+
+		transport := NewTCPTransport(zap.NewNop(), "tcp", "example.com:7878",
+			WithDialer(func(ctx context.Context, n, addr string) (net.Conn, error) {
+				network, address = n, addr
+
+				return client, nil
+			}))
+
+		Convey("When connect to the address", func() {
+			conn, err := transport.Connect(ctx)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			Convey("Then the dialer should be called with the address", func() {
+				So(network, ShouldEqual, "tcp")
+				So(address, ShouldEqual, "example.com:7878")
+
+				Convey("And the frames should be sent over the connection", func() {
+					go conn.Send(ctx, frame.NewKeepaliveFrame(true, 0, nil))
+
+					f, err := proto.NewFramer(zap.NewNop(), server).ReadFrame()
+					So(err, ShouldBeNil)
+					So(f.Type(), ShouldEqual, frame.TypeKeepalive)
+				})
+			})
+		})
+	})
+}
+
+func TestTCPConnFramesWithLengthPrefix(t *testing.T) {
+	Convey("Given a TCP connection over a pipe", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client, server := net.Pipe()
+		defer server.Close()
+
+		transport := NewTCPTransport(zap.NewNop(), "tcp", "localhost:7878",
+			WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+				return client, nil
+			}))
+
+		conn, err := transport.Connect(ctx)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("When send a frame", func() {
+			f := frame.NewRequestNFrame(1, 8)
+
+			go conn.Send(ctx, f)
+
+			Convey("Then the frame should be prefixed with the 24-bit length", func() {
+				buf := make([]byte, frame.FrameLengthSize+f.Size())
+
+				_, err := io.ReadFull(server, buf)
+				So(err, ShouldBeNil)
+
+				encoded, err := frame.Encode(f)
+				So(err, ShouldBeNil)
+
+				So(buf[:frame.FrameLengthSize], ShouldResemble, []byte{0, 0, byte(f.Size())})
+				So(buf[frame.FrameLengthSize:], ShouldResemble, encoded)
+			})
+		})
+
+		Convey("When receive a frame prefixed with the length", func() {
+			encoded, err := frame.Encode(frame.NewCancelFrame(3))
+			So(err, ShouldBeNil)
+
+			go server.Write(append([]byte{0, 0, byte(len(encoded))}, encoded...))
+
+			Convey("Then the frame should be decoded", func() {
+				f, err := conn.Recv(ctx)
+				So(err, ShouldBeNil)
+				So(f.Type(), ShouldEqual, frame.TypeCancel)
+				So(f.StreamID(), ShouldEqual, frame.StreamID(3))
+			})
+		})
+	})
+}
+
+func TestTCPTransportWithAllocator(t *testing.T) {
+	Convey("Given a TCP transport with an allocator", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client, server := net.Pipe()
+		defer server.Close()
+
+		allocator := frame.NewBudgetAllocator(1024)
+		transport := NewTCPTransport(zap.NewNop(), "tcp", "localhost:7878",
+			WithAllocator(allocator),
+			WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+				return client, nil
+			}))
+
+		conn, err := transport.Connect(ctx)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("When receive a PAYLOAD frame", func() {
+			go proto.NewFramer(zap.NewNop(), server).WriteFrame(
+				frame.NewPayloadFrame(1, false, false, true, false, nil, []byte("hello")))
+
+			f, err := conn.Recv(ctx)
+			So(err, ShouldBeNil)
+			So(f.Type(), ShouldEqual, frame.TypePayload)
+
+			Convey("Then the buffer should be held until the frame released", func() {
+				So(allocator.Used(), ShouldBeGreaterThan, 0)
+
+				frame.Release(f)
+				So(allocator.Used(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestTCPTransportWithMetadataLimit(t *testing.T) {
+	Convey("Given a TCP transport with a metadata limit", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		client, server := net.Pipe()
+		defer server.Close()
+
+		transport := NewTCPTransport(zap.NewNop(), "tcp", "localhost:7878",
+			WithMetadataLimit(&frame.MetadataLimit{MaxSize: 8}),
+			WithDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+				return client, nil
+			}))
+
+		conn, err := transport.Connect(ctx)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("When receive a frame with metadata exceeds the limit", func() {
+			go proto.NewFramer(zap.NewNop(), server).WriteFrame(
+				frame.NewMetadataPushFrame(frame.Metadata("metadata exceeds the limit")))
+
+			Convey("Then the frame should be rejected", func() {
+				_, err := conn.Recv(ctx)
+				So(err, ShouldEqual, frame.ErrMetadataTooLarge)
+			})
+		})
+	})
+}
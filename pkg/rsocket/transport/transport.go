@@ -45,11 +45,11 @@ type Transport interface {
 	Connect(ctx context.Context) (proto.Conn, error)
 }
 
-// ForURI creates transport for the target URL
-func ForURI(logger *zap.Logger, target *url.URL) (transport Transport, err error) {
+// ForURI creates transport for the target URL, the socket options only apply to the TCP transport.
+func ForURI(logger *zap.Logger, target *url.URL, opts ...SocketOption) (transport Transport, err error) {
 	switch target.Scheme {
 	case "tcp":
-		transport = &tcpTransport{logger.Named("tcp"), "tcp", target.Host}
+		transport = NewTCPTransport(logger.Named("tcp"), "tcp", target.Host, opts...)
 	case "ws":
 	default:
 		err = ErrUnknownScheme
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/flier/rsocket-go/pkg/rsocket/proto"
+	ws "github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// WSServerOption configures a WSServer.
+type WSServerOption func(*WSServer)
+
+// WithAllowedOrigins configures the origins allowed to connect, "*" allows any origin.
+//
+// The origin must be the same host of request if no origins allowed.
+func WithAllowedOrigins(origins []string) WSServerOption {
+	return func(server *WSServer) {
+		server.AllowedOrigins = origins
+	}
+}
+
+// WithSubprotocol configures the WebSocket subprotocol the clients must request.
+func WithSubprotocol(subprotocol string) WSServerOption {
+	return func(server *WSServer) {
+		server.Subprotocol = subprotocol
+	}
+}
+
+// WSServer accepts the RSocket connections over WebSocket.
+type WSServer struct {
+	*zap.Logger
+	AllowedOrigins []string
+	Subprotocol    string
+	upgrader       ws.Upgrader
+	conns          chan proto.Conn
+}
+
+var _ http.Handler = (*WSServer)(nil)
+
+// NewWSServer creates a WSServer, which upgrades the HTTP requests to RSocket connections.
+func NewWSServer(logger *zap.Logger, opts ...WSServerOption) *WSServer {
+	server := &WSServer{
+		Logger: logger.Named("ws"),
+		conns:  make(chan proto.Conn),
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	if server.Subprotocol != "" {
+		server.upgrader.Subprotocols = []string{server.Subprotocol}
+	}
+
+	if len(server.AllowedOrigins) > 0 {
+		server.upgrader.CheckOrigin = server.checkOrigin
+	}
+
+	return server
+}
+
+func (server *WSServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	for _, allowed := range server.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (server *WSServer) hasSubprotocol(r *http.Request) bool {
+	for _, subprotocol := range ws.Subprotocols(r) {
+		if subprotocol == server.Subprotocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServeHTTP upgrades the HTTP request to a RSocket connection.
+func (server *WSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if server.Subprotocol != "" && !server.hasSubprotocol(r) {
+		server.Info("reject connection without subprotocol", zap.String("remote", r.RemoteAddr), zap.String("subprotocol", server.Subprotocol))
+
+		http.Error(w, "websocket: subprotocol "+server.Subprotocol+" required", http.StatusBadRequest)
+
+		return
+	}
+
+	conn, err := server.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		server.Info("upgrade connection failed", zap.String("remote", r.RemoteAddr), zap.Error(err))
+
+		return
+	}
+
+	select {
+	case <-r.Context().Done():
+		conn.Close()
+	case server.conns <- &wsConn{conn}:
+	}
+}
+
+// Accept waits for and returns the next connection.
+func (server *WSServer) Accept(ctx context.Context) (proto.Conn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case conn := <-server.conns:
+		return conn, nil
+	}
+}
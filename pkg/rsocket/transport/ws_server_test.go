@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func TestWSServerHandshake(t *testing.T) {
+	Convey("Given a WebSocket server with allowed origins and subprotocol", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		server := NewWSServer(zap.NewNop(), WithAllowedOrigins([]string{"https://example.com"}), WithSubprotocol("rsocket"))
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		target := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+		dialer := &ws.Dialer{Subprotocols: []string{"rsocket"}}
+
+		Convey("When a client connects from a disallowed origin", func() {
+			_, resp, err := dialer.Dial(target, http.Header{"Origin": {"https://evil.com"}})
+
+			Convey("Then the handshake should be forbidden", func() {
+				So(err, ShouldEqual, ws.ErrBadHandshake)
+				So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("When a client connects without the subprotocol", func() {
+			_, resp, err := ws.DefaultDialer.Dial(target, http.Header{"Origin": {"https://example.com"}})
+
+			Convey("Then the handshake should be rejected", func() {
+				So(err, ShouldEqual, ws.ErrBadHandshake)
+				So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When a client connects from an allowed origin", func() {
+			go func() {
+				if conn, err := server.Accept(ctx); err == nil {
+					conn.Close()
+				}
+			}()
+
+			conn, resp, err := dialer.Dial(target, http.Header{"Origin": {"https://example.com"}})
+
+			Convey("Then the connection should be upgraded", func() {
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusSwitchingProtocols)
+				So(conn.Subprotocol(), ShouldEqual, "rsocket")
+
+				conn.Close()
+			})
+		})
+	})
+}